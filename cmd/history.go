@@ -0,0 +1,93 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/junchaw/kubekraken/pkg/executor"
+	"github.com/junchaw/kubekraken/pkg/utils"
+	"github.com/spf13/cobra"
+)
+
+func NewHistoryCmd(opts *KrakenOptions) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "history",
+		Short: "List and compare saved runs",
+		// history doesn't need kubeconfig files, this replaces the root pre-run which parses them
+		PersistentPreRun: func(cmd *cobra.Command, args []string) {
+			if opts.HistoryDir == "" {
+				logger.Fatalf("history directory is not set, see --history-dir")
+			}
+		},
+	}
+
+	cmd.AddCommand(newHistoryListCmd(opts))
+	cmd.AddCommand(newHistoryDiffCmd(opts))
+
+	return cmd
+}
+
+func newHistoryListCmd(opts *KrakenOptions) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "list",
+		Short: "List saved runs, from the oldest to the latest",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			entries, err := executor.NewHistoryStore(opts.HistoryDir, opts.HistoryLimit).List()
+			if err != nil {
+				logger.Fatalf("failed to list history: %v", err)
+			}
+			if len(entries) == 0 {
+				fmt.Printf("No runs in history %s\n", opts.HistoryDir)
+				return
+			}
+
+			rows := make([][]string, 0, len(entries))
+			for _, entry := range entries {
+				rows = append(rows, []string{
+					entry.RunID,
+					entry.StartedAt.Local().Format("2006-01-02 15:04:05"),
+					fmt.Sprint(entry.TotalCount),
+					fmt.Sprint(entry.ErrorCount),
+					fmt.Sprint(entry.WarningCount),
+					utils.ShellJoin(entry.Args),
+				})
+			}
+			fmt.Print(utils.RenderTable([]string{"RUN ID", "STARTED AT", "TARGETS", "ERRORS", "WARNINGS", "ARGS"}, rows))
+		},
+	}
+
+	return cmd
+}
+
+func newHistoryDiffCmd(opts *KrakenOptions) *cobra.Command {
+	var ignoreVolatile bool
+
+	cmd := &cobra.Command{
+		Use:   "diff <runA> <runB>",
+		Short: "Show per-target changes of status and stdout between two saved runs",
+		Long: strings.TrimSpace(`
+Show per-target changes of status and stdout between two saved runs, new and missing targets, and unified diffs of stdout.
+
+A run is referred to by its run ID, a unique prefix of it, "latest", or "latest~N" for the Nth run before the latest,
+e.g. "kubekraken history diff latest~1 latest" shows what changed in the latest run.`),
+		Args: cobra.ExactArgs(2),
+		Run: func(cmd *cobra.Command, args []string) {
+			store := executor.NewHistoryStore(opts.HistoryDir, opts.HistoryLimit)
+			a, err := store.Load(args[0])
+			if err != nil {
+				logger.Fatalf("failed to load run: %v", err)
+			}
+			b, err := store.Load(args[1])
+			if err != nil {
+				logger.Fatalf("failed to load run: %v", err)
+			}
+			executor.PrintRunDiff(os.Stdout, a, b, executor.DiffRuns(a, b, ignoreVolatile))
+		},
+	}
+
+	cmd.Flags().BoolVar(&ignoreVolatile, "ignore-volatile", false, "Ignore volatile columns (e.g. AGE) and timestamps when comparing stdout")
+
+	return cmd
+}
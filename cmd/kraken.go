@@ -3,6 +3,7 @@ package cmd
 import (
 	"os"
 	"regexp"
+	"text/template"
 
 	"github.com/junchaw/kubekraken/pkg/executor"
 	"github.com/sirupsen/logrus"
@@ -37,11 +38,51 @@ type KrakenOptions struct {
 	Workers int
 
 	OutputDir        string
+	CleanOutputDir   bool
 	OutputFile       string
 	OutputFormat     string
+	CSVExpandLines   bool
+	JUnitReport      string
+	MarkdownMaxBytes int
+	MetricsFile      string
+	HistoryDir       string
+	HistoryLimit     int
+	NotifyWebhook    string
+	NotifyTemplate   string
+	NotifyOn         []string
+	NotifyRetries    int
+	MetricsPushURL   string
 	NoStdout         bool
 	NoStderr         bool
+	SuppressWarnings []string
 	OutputConditions string
+	NoRedact         bool
+	RedactPatterns   []string
+	Grep             string
+	GrepInvert       string
+	SpillThreshold   int
+	Ordered          bool
+	OrderBy          string
+
+	MergeTable             bool
+	MergeTableTargetColumn string
+	MergeTableSortBy       []string
+	MergeTableColumns      []string
+
+	GroupIdentical      bool
+	GroupIgnoreVolatile bool
+
+	Query        string
+	QueryCombine bool
+
+	Aggregate string
+
+	ResultTemplate  string
+	SummaryTemplate string
+
+	SummaryView        string
+	SummarySortBy      []string
+	SummaryHideSuccess bool
 
 	// KubeconfigFilterRegex is the regex filter for kubeconfig files, parsed after reading arguments and before running commands
 	KubeconfigFilterRegex *regexp.Regexp
@@ -55,6 +96,12 @@ type KrakenOptions struct {
 	// ContextExcludeRegex is the regex exclude filter for context names, parsed after reading arguments and before running commands
 	ContextExcludeRegex *regexp.Regexp
 
+	// GrepRegex is the regex of --grep, parsed after reading arguments and before running commands
+	GrepRegex *regexp.Regexp
+
+	// GrepInvertRegex is the regex of --grep-v, parsed after reading arguments and before running commands
+	GrepInvertRegex *regexp.Regexp
+
 	// Targets is a list of contexts, parsed after reading arguments and before running commands
 	Targets []executor.Target
 }
@@ -96,6 +143,8 @@ func NewKrakenCmd() *cobra.Command {
 				opts.ContextExcludeRegex = re
 			}
 
+			parseGrepOptions(&opts)
+
 			opts.Targets = []executor.Target{}
 
 			for _, kubeconfigFileOrDir := range opts.KubeconfigFiles {
@@ -128,16 +177,111 @@ func NewKrakenCmd() *cobra.Command {
 
 	cmd.PersistentFlags().IntVar(&opts.Workers, "workers", 99, "Number of workers to run concurrently")
 
-	cmd.PersistentFlags().StringVar(&opts.OutputDir, "output-dir", "", "Output directory for the results, kubekraken will save stdout/stderr/error to files under this directory")
-	cmd.PersistentFlags().StringVar(&opts.OutputFile, "output-file", "", "Output file for the results, kubekraken will save stdout/stderr/error to this file")
-	cmd.PersistentFlags().StringVar(&opts.OutputFormat, "output-format", "text", "Output format for the results (text, json)")
+	cmd.PersistentFlags().StringVar(&opts.OutputDir, "output-dir", "", "Output directory for the results, kubekraken will save stdout/stderr/error to files under a subdirectory named after the run ID, and link it as \"latest\"")
+	cmd.PersistentFlags().BoolVar(&opts.CleanOutputDir, "clean-output-dir", false, "Empty the output directory and save results to it directly instead of to a subdirectory, only directories created by kubekraken can be cleaned")
+	cmd.PersistentFlags().StringVar(&opts.OutputFile, "output-file", "", "Output file for the results, kubekraken will save stdout/stderr/error to this file, \"-\" writes to stdout and prints everything else to stderr")
+	cmd.PersistentFlags().StringVar(&opts.OutputFormat, "output-format", "text", "Output format for the results (text, json, yaml, ndjson, csv, tsv, html, markdown), ndjson writes one result per line as each target finishes, csv/tsv write one row per target, formats other than text are written to stdout if there is no --output-file")
+	cmd.PersistentFlags().StringVar(&opts.JUnitReport, "junit-report", "", "Write a JUnit XML report to this file, each target is a testcase, which fails on error or when the output condition matches")
+	cmd.PersistentFlags().StringVar(&opts.HistoryDir, "history-dir", "", "Directory of the run history, each run is saved to it with the full outputs if it's set, see the history command (e.g. ~/.kubekraken/history)")
+	cmd.PersistentFlags().IntVar(&opts.HistoryLimit, "history-limit", 20, "Max number of runs kept in the history, older runs are removed, 0 means no limit")
+	cmd.PersistentFlags().StringVar(&opts.NotifyWebhook, "notify-webhook", "", "POST a JSON notification to this URL when the run finishes, with summary counts, failing targets, args and run ID")
+	cmd.PersistentFlags().StringVar(&opts.NotifyTemplate, "notify-template", executor.NotifyTemplateGeneric, "Payload template of the notification (generic, slack), slack works with Slack incoming webhooks")
+	cmd.PersistentFlags().StringSliceVar(&opts.NotifyOn, "notify-on", []string{executor.NotifyOnAlways}, "When to send the notification (always, failure, match), failure means any target has an error, match means any target matches the output condition")
+	cmd.PersistentFlags().IntVar(&opts.NotifyRetries, "notify-retries", 3, "Number of retries of the notification on network errors, 429 and 5xx responses, with exponential backoff")
+	cmd.PersistentFlags().StringVar(&opts.MetricsFile, "metrics-file", "", "Write Prometheus metrics of the run to this file, in node-exporter textfile collector format (e.g. /var/lib/node_exporter/kubekraken.prom)")
+	cmd.PersistentFlags().StringVar(&opts.MetricsPushURL, "metrics-push-url", "", "Push Prometheus metrics of the run to this URL with a PUT request (e.g. http://pushgateway:9091/metrics/job/kubekraken)")
+	cmd.PersistentFlags().IntVar(&opts.MarkdownMaxBytes, "markdown-max-bytes", 60000, "Max size of the markdown report, details of failing targets are omitted first, then table rows, 0 to disable, used with --output-format markdown")
+	cmd.PersistentFlags().BoolVar(&opts.CSVExpandLines, "csv-expand-lines", false, "Write one csv/tsv row per output line instead of one row per target, used with --output-format csv or tsv")
 	cmd.PersistentFlags().BoolVar(&opts.NoStdout, "no-stdout", false, "Do not print kubectl stdout")
 	cmd.PersistentFlags().BoolVar(&opts.NoStderr, "no-stderr", false, "Do not print kubectl stderr")
+	cmd.PersistentFlags().StringSliceVar(&opts.SuppressWarnings, "suppress-warnings", nil, "Categories of kubectl warnings not to print (deprecation, throttling, other), errors are always printed, targets without any other stderr are not counted as with warnings")
 	cmd.PersistentFlags().StringVar(&opts.OutputConditions, "output-conditions", "", "Output conditions for the results, see document for more details")
+	cmd.PersistentFlags().BoolVar(&opts.NoRedact, "no-redact", false, "Do not mask secrets in outputs, by default values of Secret data and stringData, kubeconfig credentials, bearer tokens, JWTs and private keys are masked")
+	cmd.PersistentFlags().StringArrayVar(&opts.RedactPatterns, "redact-pattern", nil, "Regex of custom secrets to mask in outputs, can be repeated, only capture groups are masked if there are any (e.g. 'password=(\\S+)')")
+	cmd.PersistentFlags().StringVar(&opts.Grep, "grep", "", "Regex filter for stdout lines, table headers are always kept, targets without any matching line are not printed (e.g. CrashLoop)")
+	cmd.PersistentFlags().StringVar(&opts.GrepInvert, "grep-v", "", "Regex exclude filter for stdout lines, table headers are always kept, targets without any remaining line are not printed (e.g. Running)")
+	cmd.PersistentFlags().BoolVar(&opts.Ordered, "ordered", false, "Print results in target order instead of completion order, each result is printed as soon as all targets before it have finished")
+	cmd.PersistentFlags().StringVar(&opts.OrderBy, "order-by", "", "Sort targets before running them (index, id, kubeconfig, context), by default targets are kept in the order they are found")
+	cmd.PersistentFlags().BoolVar(&opts.MergeTable, "merge-table", false, "Merge kubectl table outputs (default and -o wide) of all targets into one table with a leading cluster column")
+	cmd.PersistentFlags().StringVar(&opts.MergeTableTargetColumn, "merge-table-target-column", "context", "Leading column of the merged table, context (CLUSTER) or id (TARGET)")
+	cmd.PersistentFlags().StringSliceVar(&opts.MergeTableSortBy, "merge-table-sort-by", nil, "Columns to sort the merged table by (e.g. STATUS,NAME)")
+	cmd.PersistentFlags().StringSliceVar(&opts.MergeTableColumns, "merge-table-columns", nil, "Columns to keep in the merged table, in order (e.g. NAME,STATUS,RESTARTS)")
+	cmd.PersistentFlags().BoolVar(&opts.GroupIdentical, "group-identical", false, "Print each distinct stdout once with the list of targets which produced it, biggest group first")
+	cmd.PersistentFlags().BoolVar(&opts.GroupIgnoreVolatile, "group-ignore-volatile", false, "Ignore volatile columns (e.g. AGE) and timestamps when grouping identical outputs, used with --group-identical")
+	cmd.PersistentFlags().StringVar(&opts.Query, "query", "", "jq-like expression evaluated with the JSON output of each target, kubectl is run with -o json (e.g. '.items[] | select(.status.phase != \"Running\") | .metadata.name'), variables, reduce, foreach, try/catch and def are not supported")
+	cmd.PersistentFlags().BoolVar(&opts.QueryCombine, "query-combine", false, "Combine query results of all targets into one JSON array, each element is tagged with the target ID, used with --query")
+	cmd.PersistentFlags().StringVar(&opts.Aggregate, "aggregate", "", "Compute a value per target from its JSON output and print them as a table with the fleet-wide total, one of count, count:<path>, sum:<path>, distinct:<path>, min:<path>, max:<path>, paths are jq-like or kubectl JSONPath (e.g. 'sum:.items[].status.containerStatuses[]?.restartCount'), kubectl is run with -o json")
+	cmd.PersistentFlags().StringVar(&opts.ResultTemplate, "result-template", "", "Go template to print each target with instead of the styled output, with helpers indent, truncate, color, toJson and lines (e.g. '{{.TaskItem.Context}}: {{.Stdout | lines | len}}')")
+	cmd.PersistentFlags().StringVar(&opts.SummaryTemplate, "summary-template", "", "Go template to print the summary with instead of the styled output, with the same helpers as --result-template (e.g. '{{.ErrorCount}}/{{.TotalCount}} failed')")
+	cmd.PersistentFlags().StringVar(&opts.SummaryView, "summary-view", "text", "How the summary is printed, text, or table with one row per target (status, exit code, duration, stdout lines, stderr category, condition matched)")
+	cmd.PersistentFlags().StringSliceVar(&opts.SummarySortBy, "summary-sort-by", nil, "Columns to sort the summary table by, prefix with - for descending order (e.g. -STATUS,DURATION), used with --summary-view table")
+	cmd.PersistentFlags().BoolVar(&opts.SummaryHideSuccess, "summary-hide-success", false, "Hide successful targets in the summary table, used with --summary-view table")
+	cmd.PersistentFlags().IntVar(&opts.SpillThreshold, "spill-threshold", 8<<20, "Outputs larger than this number of bytes are spilled to files in a private temporary directory instead of kept in memory, 0 to disable")
 
 	// Add subcommands
 	cmd.AddCommand(NewListContextsCmd(&opts))
 	cmd.AddCommand(NewKubectlCmd(&opts))
+	cmd.AddCommand(NewHistoryCmd(&opts))
+	cmd.AddCommand(NewReportCmd(&opts))
 
 	return cmd
 }
+
+// parseGrepOptions compiles the regexes of --grep and --grep-v
+func parseGrepOptions(opts *KrakenOptions) {
+	if opts.Grep != "" {
+		re, err := regexp.Compile(opts.Grep)
+		if err != nil {
+			logger.Fatalf("failed to compile grep: %v", err)
+		}
+		opts.GrepRegex = re
+	}
+
+	if opts.GrepInvert != "" {
+		re, err := regexp.Compile(opts.GrepInvert)
+		if err != nil {
+			logger.Fatalf("failed to compile grep-v: %v", err)
+		}
+		opts.GrepInvertRegex = re
+	}
+}
+
+// newAggregate parses the aggregate option, nil means no aggregate
+func newAggregate(opts *KrakenOptions) *executor.Aggregate {
+	if opts.Aggregate == "" {
+		return nil
+	}
+	aggregate, err := executor.ParseAggregate(opts.Aggregate)
+	if err != nil {
+		logger.Fatalf("failed to parse aggregate: %v", err)
+	}
+	return aggregate
+}
+
+// newTemplate parses a template option, nil means no template
+func newTemplate(name, text string) *template.Template {
+	if text == "" {
+		return nil
+	}
+	t, err := executor.ParseTemplate(name, text)
+	if err != nil {
+		logger.Fatalf("failed to parse %s template: %v", name, err)
+	}
+	return t
+}
+
+// newRedactor compiles the regexes of --redact-pattern, nil is returned with --no-redact
+func newRedactor(opts *KrakenOptions) *executor.Redactor {
+	if opts.NoRedact {
+		return nil
+	}
+	patterns := make([]*regexp.Regexp, 0, len(opts.RedactPatterns))
+	for _, pattern := range opts.RedactPatterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			logger.Fatalf("failed to compile redact pattern: %v", err)
+		}
+		patterns = append(patterns, re)
+	}
+	return executor.NewRedactor(patterns)
+}
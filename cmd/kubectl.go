@@ -1,9 +1,8 @@
 package cmd
 
 import (
-	"strings"
-
 	"github.com/junchaw/kubekraken/pkg/executor"
+	"github.com/junchaw/kubekraken/pkg/query"
 	"github.com/spf13/cobra"
 )
 
@@ -13,27 +12,77 @@ func NewKubectlCmd(opts *KrakenOptions) *cobra.Command {
 		Aliases: []string{"k"},
 		Short:   "Run kubectl commands",
 		Run: func(cmd *cobra.Command, args []string) {
-			outputConditions := []executor.OutputCondition{}
+			var outputCondition *executor.OutputCondition
 			if opts.OutputConditions != "" {
-				for condition := range strings.SplitSeq(opts.OutputConditions, ",") {
-					parts := strings.SplitN(condition, ":", 2)
-					outputConditions = append(outputConditions, executor.OutputCondition{
-						Operator: parts[0],
-						Value:    parts[1],
-					})
+				var err error
+				if outputCondition, err = executor.ParseOutputCondition(opts.OutputConditions); err != nil {
+					logger.Fatalf("failed to parse output conditions: %v", err)
+				}
+			}
+			var q *query.Query
+			if opts.Query != "" {
+				var err error
+				if q, err = query.Parse(opts.Query); err != nil {
+					logger.Fatalf("failed to parse query: %v", err)
 				}
 			}
+			// formats other than text are written to stdout if there is no output file, so that they can be piped to other tools,
+			// styled text is printed to stderr instead
+			outputFile := opts.OutputFile
+			if outputFile == "" && opts.OutputFormat != "" && opts.OutputFormat != "text" {
+				outputFile = executor.OutputFileStdout
+			}
 			kr := executor.NewRun(&executor.RunOptions{
 				Targets:          opts.Targets,
 				Args:             args,
 				Workers:          opts.Workers,
 				OutputDir:        opts.OutputDir,
-				OutputFile:       opts.OutputFile,
+				CleanOutputDir:   opts.CleanOutputDir,
+				OutputFile:       outputFile,
 				OutputFormat:     opts.OutputFormat,
+				CSVExpandLines:   opts.CSVExpandLines,
+				JUnitReport:      opts.JUnitReport,
+				MarkdownMaxBytes: opts.MarkdownMaxBytes,
+				MetricsFile:      opts.MetricsFile,
+				HistoryDir:       opts.HistoryDir,
+				HistoryLimit:     opts.HistoryLimit,
+				NotifyWebhook:    opts.NotifyWebhook,
+				NotifyTemplate:   opts.NotifyTemplate,
+				NotifyOn:         opts.NotifyOn,
+				NotifyRetries:    opts.NotifyRetries,
+				MetricsPushURL:   opts.MetricsPushURL,
 				PrintStdout:      !opts.NoStdout,
 				PrintStderr:      !opts.NoStderr,
-				OutputConditions: outputConditions,
-				Logger:           logger,
+				SuppressWarnings: opts.SuppressWarnings,
+				OutputCondition:  outputCondition,
+				Grep:             opts.GrepRegex,
+				GrepInvert:       opts.GrepInvertRegex,
+				Redactor:         newRedactor(opts),
+				SpillThreshold:   opts.SpillThreshold,
+				Ordered:          opts.Ordered,
+				OrderBy:          opts.OrderBy,
+
+				MergeTable:             opts.MergeTable,
+				MergeTableTargetColumn: opts.MergeTableTargetColumn,
+				MergeTableSortBy:       opts.MergeTableSortBy,
+				MergeTableColumns:      opts.MergeTableColumns,
+
+				GroupIdentical:      opts.GroupIdentical,
+				GroupIgnoreVolatile: opts.GroupIgnoreVolatile,
+
+				Query:        q,
+				QueryCombine: opts.QueryCombine,
+
+				Aggregate: newAggregate(opts),
+
+				ResultTemplate:  newTemplate("result", opts.ResultTemplate),
+				SummaryTemplate: newTemplate("summary", opts.SummaryTemplate),
+
+				SummaryView:        opts.SummaryView,
+				SummarySortBy:      opts.SummarySortBy,
+				SummaryHideSuccess: opts.SummaryHideSuccess,
+
+				Logger: logger,
 			})
 			if err := kr.Run(); err != nil {
 				logger.Fatalf("failed to run kubectl: %v", err)
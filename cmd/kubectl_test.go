@@ -0,0 +1,68 @@
+package cmd
+
+import (
+	"encoding/json"
+	"os"
+	"path"
+	"testing"
+)
+
+func TestKubectlCmdGrep(t *testing.T) {
+	dir := t.TempDir()
+	stdout := "NAME    STATUS\nweb-1   Running\nweb-2   Pending\ndns-1   Running\n"
+	if err := os.WriteFile(path.Join(dir, "stdout"), []byte(stdout), 0600); err != nil {
+		t.Fatal(err)
+	}
+	script := "#!/bin/sh\ncat " + path.Join(dir, "stdout") + "\n"
+	if err := os.WriteFile(path.Join(dir, "kubectl"), []byte(script), 0700); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	kubeconfig := path.Join(dir, "kubeconfig.yaml")
+	if err := os.WriteFile(kubeconfig, []byte("contexts:\n- name: a\n  context:\n    cluster: a\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		args []string
+		want string
+	}{
+		{name: "grep", args: []string{"--grep", "Running"}, want: "NAME    STATUS\nweb-1   Running\ndns-1   Running\n"},
+		{name: "grep-v", args: []string{"--grep-v", "^dns-"}, want: "NAME    STATUS\nweb-1   Running\nweb-2   Pending\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts = KrakenOptions{}
+			outputFile := path.Join(t.TempDir(), "results.json")
+			root := NewKrakenCmd()
+			args := append([]string{"--kubeconfig-files", kubeconfig, "--output-format", "json", "--output-file", outputFile}, tt.args...)
+			root.SetArgs(append(args, "k", "--", "get", "pods"))
+			if err := root.Execute(); err != nil {
+				t.Fatal(err)
+			}
+
+			content, err := os.ReadFile(outputFile)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var output struct {
+				Results map[string]struct {
+					Stdout string `json:"stdout"`
+				} `json:"results"`
+			}
+			if err := json.Unmarshal(content, &output); err != nil {
+				t.Fatalf("failed to parse %s: %v", content, err)
+			}
+			if len(output.Results) != 1 {
+				t.Fatalf("%d results are saved, want 1", len(output.Results))
+			}
+			for _, result := range output.Results {
+				if result.Stdout != tt.want {
+					t.Errorf("stdout = %q, want %q", result.Stdout, tt.want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,66 @@
+package cmd
+
+import (
+	"strings"
+
+	"github.com/junchaw/kubekraken/pkg/executor"
+	"github.com/spf13/cobra"
+)
+
+func NewReportCmd(opts *KrakenOptions) *cobra.Command {
+	var from, format string
+
+	cmd := &cobra.Command{
+		Use:   "report",
+		Short: "Render a run saved as JSON again, without running kubectl",
+		Long: strings.TrimSpace(`
+Render a run saved as JSON (with --output-format json, or in the history directory) again, without running kubectl.
+
+Results are filtered again with --output-conditions, --grep and --grep-v, the ones of the saved run are not kept,
+but stdout saved by it is already filtered. The report is printed to stdout, or saved to --output-file.`),
+		Args: cobra.NoArgs,
+		// report doesn't need kubeconfig files, this replaces the root pre-run which parses them
+		PersistentPreRun: func(cmd *cobra.Command, args []string) {
+			parseGrepOptions(opts)
+		},
+		Run: func(cmd *cobra.Command, args []string) {
+			var outputCondition *executor.OutputCondition
+			if opts.OutputConditions != "" {
+				var err error
+				if outputCondition, err = executor.ParseOutputCondition(opts.OutputConditions); err != nil {
+					logger.Fatalf("failed to parse output conditions: %v", err)
+				}
+			}
+			record, err := executor.LoadRunRecord(from)
+			if err != nil {
+				logger.Fatalf("failed to load run: %v", err)
+			}
+			err = executor.Report(record, &executor.RunOptions{
+				OutputFile:       opts.OutputFile,
+				OutputFormat:     format,
+				CSVExpandLines:   opts.CSVExpandLines,
+				MarkdownMaxBytes: opts.MarkdownMaxBytes,
+				PrintStdout:      !opts.NoStdout,
+				PrintStderr:      !opts.NoStderr,
+				SuppressWarnings: opts.SuppressWarnings,
+				OutputCondition:  outputCondition,
+				Redactor:         newRedactor(opts),
+				Aggregate:        newAggregate(opts),
+				ResultTemplate:   newTemplate("result", opts.ResultTemplate),
+				SummaryTemplate:  newTemplate("summary", opts.SummaryTemplate),
+				Grep:             opts.GrepRegex,
+				GrepInvert:       opts.GrepInvertRegex,
+				Logger:           logger,
+			})
+			if err != nil {
+				logger.Fatalf("failed to render report: %v", err)
+			}
+		},
+	}
+
+	cmd.Flags().StringVar(&from, "from", "", "The run saved as JSON, e.g. results.json, or a run file in the history directory")
+	cmd.Flags().StringVar(&format, "format", "text", "Format of the report (text, csv, tsv, html, markdown)")
+	_ = cmd.MarkFlagRequired("from")
+
+	return cmd
+}
@@ -0,0 +1,257 @@
+package executor
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/junchaw/kubekraken/pkg/query"
+	"github.com/junchaw/kubekraken/pkg/utils"
+)
+
+const (
+	AggregateCount    = "count"
+	AggregateSum      = "sum"
+	AggregateDistinct = "distinct"
+	AggregateMin      = "min"
+	AggregateMax      = "max"
+)
+
+// Aggregate computes a value per target from its JSON output, values of all targets are combined into a fleet-wide one
+type Aggregate struct {
+	expr string
+
+	// Func is one of Aggregate*
+	Func string
+
+	// Path is evaluated with the JSON output, nil means the items of a List, or the output itself if it's not a List
+	Path *query.Query
+}
+
+// AggregateValue is the value of an aggregate for a target, or for all targets
+type AggregateValue struct {
+	// Number is the count, sum, minimum or maximum, or the number of distinct values
+	Number float64 `json:"number" yaml:"number"`
+
+	// Values are the distinct values sorted, only set for distinct
+	Values []string `json:"values,omitempty" yaml:"values,omitempty"`
+}
+
+// AggregateSummary is the fleet-wide value of an aggregate
+type AggregateSummary struct {
+	Expr string `json:"expr" yaml:"expr"`
+
+	// Func is one of Aggregate*
+	Func string `json:"func" yaml:"func"`
+
+	// Total is the sum of counts or sums of all targets, the minimum or maximum of all targets, or the distinct values of all targets
+	Total AggregateValue `json:"total" yaml:"total"`
+
+	// TargetCount is the number of targets with a value, targets with errors, or without any number for min and max, have no value
+	TargetCount int `json:"targetCount" yaml:"targetCount"`
+}
+
+// ParseAggregate parses "count", "count:<path>", "sum:<path>", "distinct:<path>", "min:<path>" or "max:<path>",
+// paths are jq-like (see package query),
+// kubectl JSONPath without filters is accepted too, e.g. "{.items[*].metadata.name}" is the same as ".items[].metadata.name".
+func ParseAggregate(expr string) (*Aggregate, error) {
+	fn, path, _ := strings.Cut(expr, ":")
+	aggregate := &Aggregate{expr: expr, Func: strings.TrimSpace(fn)}
+	switch aggregate.Func {
+	case AggregateCount:
+	case AggregateSum, AggregateDistinct, AggregateMin, AggregateMax:
+		if strings.TrimSpace(path) == "" {
+			return nil, fmt.Errorf("aggregate %s requires a path, e.g. %s:.items[].metadata.name", aggregate.Func, aggregate.Func)
+		}
+	default:
+		return nil, fmt.Errorf("unknown aggregate function %q, must be one of: %s, %s, %s, %s, %s",
+			aggregate.Func, AggregateCount, AggregateSum, AggregateDistinct, AggregateMin, AggregateMax)
+	}
+
+	if path = strings.TrimSpace(path); path != "" {
+		if strings.HasPrefix(path, "{") && strings.HasSuffix(path, "}") { // kubectl JSONPath
+			path = strings.ReplaceAll(path[1:len(path)-1], "[*]", "[]")
+		}
+		q, err := query.Parse(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse aggregate path: %v", err)
+		}
+		aggregate.Path = q
+	}
+	return aggregate, nil
+}
+
+// String returns the original expression
+func (a *Aggregate) String() string {
+	return a.expr
+}
+
+// Evaluate computes the value of a target from its JSON output, nil is returned for min and max without any number
+func (a *Aggregate) Evaluate(stdout string) (*AggregateValue, error) {
+	var document any
+	if err := json.Unmarshal([]byte(stdout), &document); err != nil {
+		return nil, fmt.Errorf("failed to parse output as json: %v", err)
+	}
+
+	outputs := []any{document}
+	if a.Path != nil {
+		var err error
+		if outputs, err = a.Path.Run(document); err != nil {
+			return nil, fmt.Errorf("failed to evaluate aggregate path: %v", err)
+		}
+	} else if list, ok := document.(map[string]any); ok {
+		if items, ok := list["items"].([]any); ok {
+			outputs = items
+		}
+	}
+
+	value := &AggregateValue{}
+	switch a.Func {
+	case AggregateCount:
+		value.Number = float64(len(outputs))
+	case AggregateSum:
+		for _, output := range outputs {
+			if output == nil { // missing fields, e.g. .status.restartCount?
+				continue
+			}
+			n, ok := output.(float64)
+			if !ok {
+				return nil, fmt.Errorf("failed to sum: %s is not a number", formatAggregateOutput(output))
+			}
+			value.Number += n
+		}
+	case AggregateDistinct:
+		seen := map[string]bool{}
+		for _, output := range outputs {
+			seen[formatAggregateOutput(output)] = true
+		}
+		value.Values = sortedKeys(seen)
+		value.Number = float64(len(value.Values))
+	case AggregateMin, AggregateMax:
+		found := false
+		for _, output := range outputs {
+			if output == nil {
+				continue
+			}
+			n, ok := output.(float64)
+			if !ok {
+				return nil, fmt.Errorf("failed to compute %s: %s is not a number", a.Func, formatAggregateOutput(output))
+			}
+			if !found || (a.Func == AggregateMin && n < value.Number) || (a.Func == AggregateMax && n > value.Number) {
+				value.Number = n
+				found = true
+			}
+		}
+		if !found { // there is no minimum or maximum, which is not the same as 0
+			return nil, nil
+		}
+	}
+	return value, nil
+}
+
+// Summarize combines values of results into the fleet-wide value
+func (a *Aggregate) Summarize(results []TaskResult) *AggregateSummary {
+	summary := &AggregateSummary{Expr: a.expr, Func: a.Func}
+	seen := map[string]bool{}
+	for _, result := range results {
+		if result.AggregateValue == nil {
+			continue
+		}
+		summary.TargetCount++
+		n := result.AggregateValue.Number
+		switch a.Func {
+		case AggregateMin:
+			if summary.TargetCount == 1 || n < summary.Total.Number {
+				summary.Total.Number = n
+			}
+		case AggregateMax:
+			if summary.TargetCount == 1 || n > summary.Total.Number {
+				summary.Total.Number = n
+			}
+		default:
+			summary.Total.Number += n
+		}
+		for _, v := range result.AggregateValue.Values {
+			seen[v] = true
+		}
+	}
+	if a.Func == AggregateDistinct {
+		summary.Total.Values = sortedKeys(seen)
+		summary.Total.Number = float64(len(summary.Total.Values))
+	}
+	return summary
+}
+
+// ToText renders the value of each target as a table, followed by the fleet-wide value
+func (s *AggregateSummary) ToText(results []TaskResult) string {
+	distinct := s.Func == AggregateDistinct
+	header := []string{"TARGET", "VALUE"}
+	if distinct {
+		header = []string{"TARGET", "COUNT", "VALUES"}
+	}
+
+	rows := make([][]string, 0, len(results)+1)
+	for _, result := range results {
+		row := []string{result.TaskItem.ID, "-"}
+		if distinct {
+			row = append(row, "")
+		}
+		if result.AggregateValue != nil {
+			row[1] = formatAggregateNumber(result.AggregateValue.Number)
+			if distinct {
+				row[2] = strings.Join(result.AggregateValue.Values, ", ")
+			}
+		}
+		rows = append(rows, row)
+	}
+	total := []string{"TOTAL", formatAggregateNumber(s.Total.Number)}
+	if s.Func == AggregateMin || s.Func == AggregateMax {
+		total[0] = strings.ToUpper(s.Func)
+		if s.TargetCount == 0 {
+			total[1] = "-"
+		}
+	}
+	if distinct {
+		total = append(total, strings.Join(s.Total.Values, ", "))
+	}
+	rows = append(rows, total)
+
+	return fmt.Sprintf("AGGREGATE: %s (%d targets)\n%s", s.Expr, s.TargetCount, utils.RenderTable(header, rows))
+}
+
+// printAggregate prints the value of each target and the fleet-wide value
+func (r *Run) printAggregate(summary *RunSummary) {
+	fmt.Fprintln(r.Out)
+	fmt.Fprintln(r.Out, utils.Style.Dim.Render("---"))
+	for _, line := range strings.Split(strings.TrimRight(summary.Aggregate.ToText(summary.Results()), "\n"), "\n") {
+		fmt.Fprintln(r.Out, utils.Style.Info.Render(line)) // rendered line by line, otherwise short lines are padded
+	}
+	fmt.Fprintln(r.Out, utils.Style.Dim.Render("---"))
+}
+
+// formatAggregateOutput formats an output of the path, strings are kept as is, other values are formatted as JSON
+func formatAggregateOutput(output any) string {
+	if s, ok := output.(string); ok {
+		return s
+	}
+	content, err := json.Marshal(output)
+	if err != nil {
+		return fmt.Sprint(output)
+	}
+	return string(content)
+}
+
+func formatAggregateNumber(n float64) string {
+	return strconv.FormatFloat(n, 'f', -1, 64)
+}
+
+func sortedKeys(m map[string]bool) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
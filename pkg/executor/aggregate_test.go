@@ -0,0 +1,161 @@
+package executor
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// aggregatePods is a kubectl List output with a pending pod without containerStatuses
+const aggregatePods = `{"kind":"List","items":[
+  {"metadata":{"name":"web-1"},"spec":{"nodeName":"node-a"},"status":{"containerStatuses":[{"restartCount":1},{"restartCount":4}]}},
+  {"metadata":{"name":"web-2"},"spec":{},"status":{"phase":"Pending"}},
+  {"metadata":{"name":"web-3"},"spec":{"nodeName":"node-b"},"status":{"containerStatuses":[{"restartCount":2}]}},
+  {"metadata":{"name":"web-4"},"spec":{"nodeName":"node-a"},"status":{"containerStatuses":[{}]}}
+]}`
+
+func TestParseAggregate(t *testing.T) {
+	tests := []struct {
+		expr     string
+		wantFunc string
+		wantPath string
+		wantErr  string
+	}{
+		{expr: "count", wantFunc: AggregateCount},
+		{expr: "count:.items[].spec.nodeName", wantFunc: AggregateCount, wantPath: ".items[].spec.nodeName"},
+		{expr: "sum: .items[].status.containerStatuses[]?.restartCount ", wantFunc: AggregateSum, wantPath: ".items[].status.containerStatuses[]?.restartCount"},
+		{expr: "distinct:{.items[*].spec.nodeName}", wantFunc: AggregateDistinct, wantPath: ".items[].spec.nodeName"},
+		{expr: "min:.items[].status.containerStatuses[]?.restartCount", wantFunc: AggregateMin, wantPath: ".items[].status.containerStatuses[]?.restartCount"},
+		{expr: "max:.items[].status.containerStatuses[]?.restartCount", wantFunc: AggregateMax, wantPath: ".items[].status.containerStatuses[]?.restartCount"},
+		{expr: "sum", wantErr: "aggregate sum requires a path"},
+		{expr: "max: ", wantErr: "aggregate max requires a path"},
+		{expr: "avg:.items", wantErr: `unknown aggregate function "avg", must be one of: count, sum, distinct, min, max`},
+		{expr: "sum:.items[", wantErr: "failed to parse aggregate path"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			a, err := ParseAggregate(tt.expr)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("ParseAggregate() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			path := ""
+			if a.Path != nil {
+				path = a.Path.String()
+			}
+			if a.Func != tt.wantFunc || path != tt.wantPath || a.String() != tt.expr {
+				t.Errorf("ParseAggregate() = %s %q (%s), want %s %q", a.Func, path, a.String(), tt.wantFunc, tt.wantPath)
+			}
+		})
+	}
+}
+
+func TestAggregateEvaluate(t *testing.T) {
+	tests := []struct {
+		expr    string
+		stdout  string
+		want    *AggregateValue
+		wantErr string
+	}{
+		{expr: "count", stdout: aggregatePods, want: &AggregateValue{Number: 4}},
+		{expr: "count", stdout: `{"kind":"Pod","metadata":{"name":"web-1"}}`, want: &AggregateValue{Number: 1}},
+		{expr: "count:.items[].spec.nodeName // empty", stdout: aggregatePods, want: &AggregateValue{Number: 3}},
+		// missing fields and missing containerStatuses are skipped, not counted as errors
+		{expr: "sum:.items[].status.containerStatuses[]?.restartCount", stdout: aggregatePods, want: &AggregateValue{Number: 7}},
+		{expr: "sum:.items[].metadata.name", stdout: aggregatePods, wantErr: `failed to sum: web-1 is not a number`},
+		{expr: "sum:.items[].status.containerStatuses[].restartCount", stdout: aggregatePods, wantErr: "cannot iterate over null"},
+		{expr: "distinct:{.items[*].spec.nodeName}", stdout: aggregatePods, want: &AggregateValue{Number: 3, Values: []string{"node-a", "node-b", "null"}}},
+		{expr: "min:.items[].status.containerStatuses[]?.restartCount", stdout: aggregatePods, want: &AggregateValue{Number: 1}},
+		{expr: "max:.items[].status.containerStatuses[]?.restartCount", stdout: aggregatePods, want: &AggregateValue{Number: 4}},
+		{expr: "min:.items[].status.missing", stdout: aggregatePods, want: nil},
+		{expr: "max:.items[].metadata", stdout: aggregatePods, wantErr: "failed to compute max"},
+		{expr: "count", stdout: "NAME READY\n", wantErr: "failed to parse output as json"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			a, err := ParseAggregate(tt.expr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := a.Evaluate(tt.stdout)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Evaluate() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Evaluate() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAggregateSummarize(t *testing.T) {
+	outputs := map[string]string{
+		"kc@a": `{"kind":"List","items":[{"restarts":3},{"restarts":5}]}`,
+		"kc@b": `{"kind":"List","items":[{"restarts":2}]}`,
+		"kc@c": `{"kind":"List","items":[]}`,
+	}
+	tests := []struct {
+		expr            string
+		wantTotal       AggregateValue
+		wantTargetCount int
+		wantTotalRow    string
+	}{
+		{expr: "count", wantTotal: AggregateValue{Number: 3}, wantTargetCount: 3, wantTotalRow: "TOTAL"},
+		{expr: "sum:.items[].restarts", wantTotal: AggregateValue{Number: 10}, wantTargetCount: 3, wantTotalRow: "TOTAL"},
+		{expr: "distinct:.items[].restarts", wantTotal: AggregateValue{Number: 3, Values: []string{"2", "3", "5"}}, wantTargetCount: 3, wantTotalRow: "TOTAL"},
+		// kc@c has no restarts, and kc@err failed, neither of them is a minimum of 0
+		{expr: "min:.items[].restarts", wantTotal: AggregateValue{Number: 2}, wantTargetCount: 2, wantTotalRow: "MIN"},
+		{expr: "max:.items[].restarts", wantTotal: AggregateValue{Number: 5}, wantTargetCount: 2, wantTotalRow: "MAX"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			a, err := ParseAggregate(tt.expr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			r := NewRun(&RunOptions{Aggregate: a})
+			var results []TaskResult
+			for _, id := range []string{"kc@a", "kc@b", "kc@c"} {
+				result := &TaskResult{TaskItem: &Target{ID: id}, Stdout: outputs[id], HasStdout: true}
+				r.filterResult(result)
+				results = append(results, *result)
+			}
+			failed := &TaskResult{TaskItem: &Target{ID: "kc@err"}, Err: "exit status 1", ExitCode: 1, HasErr: true}
+			r.filterResult(failed)
+			if failed.AggregateValue != nil {
+				t.Fatalf("failed target has a value %+v", failed.AggregateValue)
+			}
+			results = append(results, *failed)
+
+			summary := a.Summarize(results)
+			if !reflect.DeepEqual(summary.Total, tt.wantTotal) || summary.TargetCount != tt.wantTargetCount {
+				t.Errorf("Summarize() = %+v of %d targets, want %+v of %d targets", summary.Total, summary.TargetCount, tt.wantTotal, tt.wantTargetCount)
+			}
+
+			text := summary.ToText(results)
+			rows := map[string][]string{}
+			for _, line := range strings.Split(text, "\n") {
+				if fields := strings.Fields(line); len(fields) > 1 {
+					rows[fields[0]] = fields[1:]
+				}
+			}
+			if rows["kc@err"][0] != "-" {
+				t.Errorf("the failed target has a value in\n%s", text)
+			}
+			if rows[tt.wantTotalRow] == nil {
+				t.Errorf("there is no %s row in\n%s", tt.wantTotalRow, text)
+			}
+		})
+	}
+}
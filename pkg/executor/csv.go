@@ -0,0 +1,95 @@
+package executor
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/junchaw/kubekraken/pkg/utils"
+)
+
+// resultRowsHeader is the header of csv/tsv output, the "output" column is stdout, or the query result when running with a query
+var resultRowsHeader = []string{"id", "kubeconfig", "context", "status", "exitCode", "duration", "error", "output"}
+
+// WriteResultRows writes the header and one row per target in target order as csv/tsv,
+// with CSVExpandLines there is one row per output line instead, with a leading line number column.
+// Rows are written target by target, so that only the output of one target is in memory at a time.
+// Cells are guarded against formula injection, see escapeFormula.
+func (r *Run) WriteResultRows(w io.Writer, format string) error {
+	cw := utils.NewDelimitedWriter(w, format)
+	header := resultRowsHeader
+	if r.Options.CSVExpandLines {
+		header = append(append([]string{}, resultRowsHeader[:len(resultRowsHeader)-1]...), "line", "output")
+	}
+	if err := cw.Write(header); err != nil {
+		return fmt.Errorf("failed to write %s: %v", format, err)
+	}
+
+	for _, result := range r.sortedResults() {
+		fields := []string{
+			result.TaskItem.ID,
+			result.TaskItem.Kubeconfig,
+			result.TaskItem.Context,
+			result.Status(),
+			fmt.Sprint(result.ExitCode),
+			fmt.Sprintf("%.3f", result.Duration.Seconds()),
+			result.Err,
+		}
+
+		output := ""
+		if result.NeedToPrintStdout {
+			output = strings.TrimRight(resultOutput(result), "\n")
+		}
+		if !r.Options.CSVExpandLines {
+			if err := cw.Write(escapeFormulas(append(fields, output))); err != nil {
+				return fmt.Errorf("failed to write %s: %v", format, err)
+			}
+			continue
+		}
+		for i, line := range strings.Split(output, "\n") {
+			if err := cw.Write(escapeFormulas(append(append([]string{}, fields...), fmt.Sprint(i+1), line))); err != nil {
+				return fmt.Errorf("failed to write %s: %v", format, err)
+			}
+		}
+	}
+
+	cw.Flush()
+	if err := cw.Error(); err != nil {
+		return fmt.Errorf("failed to write %s: %v", format, err)
+	}
+	return nil
+}
+
+// escapeFormula prefixes the cell with a single quote if it starts with =, +, - or @, so that spreadsheets show it as text
+// instead of evaluating it as a formula, kubectl outputs and error messages may have text controlled by anyone in the cluster
+func escapeFormula(cell string) string {
+	if cell != "" && strings.ContainsRune("=+-@", rune(cell[0])) {
+		return "'" + cell
+	}
+	return cell
+}
+
+// escapeFormulas escapes all cells of the row in place, see escapeFormula
+func escapeFormulas(row []string) []string {
+	for i, cell := range row {
+		row[i] = escapeFormula(cell)
+	}
+	return row
+}
+
+// resultOutput returns the query results in compact JSON one per line, or the full stdout if there is no query
+func resultOutput(result *TaskResult) string {
+	if result.QueryResults == nil {
+		return result.FullStdout()
+	}
+	lines := make([]string, 0, len(result.QueryResults))
+	for _, v := range result.QueryResults {
+		content, err := json.Marshal(v)
+		if err != nil {
+			content = fmt.Appendf(nil, "%v", v)
+		}
+		lines = append(lines, string(content))
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,56 @@
+package executor
+
+import (
+	"bytes"
+	"encoding/csv"
+	"slices"
+	"testing"
+)
+
+func TestWriteResultRowsEscapesFormulas(t *testing.T) {
+	tests := []struct {
+		name        string
+		expandLines bool
+		want        [][]string
+	}{
+		{
+			name: "one row per target",
+			want: [][]string{
+				resultRowsHeader,
+				{`'=HYPERLINK("http://example.com")`, "kc.yaml", "'-ctx", "error", "1", "0.000", "'@SUM(1+1)", "'+1+1\n-2\n=3"},
+			},
+		},
+		{
+			name:        "one row per line",
+			expandLines: true,
+			want: [][]string{
+				{"id", "kubeconfig", "context", "status", "exitCode", "duration", "error", "line", "output"},
+				{`'=HYPERLINK("http://example.com")`, "kc.yaml", "'-ctx", "error", "1", "0.000", "'@SUM(1+1)", "1", "'+1+1"},
+				{`'=HYPERLINK("http://example.com")`, "kc.yaml", "'-ctx", "error", "1", "0.000", "'@SUM(1+1)", "2", "'-2"},
+				{`'=HYPERLINK("http://example.com")`, "kc.yaml", "'-ctx", "error", "1", "0.000", "'@SUM(1+1)", "3", "'=3"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewRun(&RunOptions{CSVExpandLines: tt.expandLines})
+			target := &Target{ID: `=HYPERLINK("http://example.com")`, Kubeconfig: "kc.yaml", Context: "-ctx"}
+			r.Results[target.ID] = TaskResult{
+				TaskItem: target, Err: "@SUM(1+1)", ExitCode: 1, Stdout: "+1+1\n-2\n=3\n",
+				HasErr: true, NeedToPrintErr: true, NeedToPrintStdout: true, NeedToPrintAnything: true,
+			}
+
+			var buf bytes.Buffer
+			if err := r.WriteResultRows(&buf, "csv"); err != nil {
+				t.Fatal(err)
+			}
+			got, err := csv.NewReader(&buf).ReadAll()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.EqualFunc(got, tt.want, slices.Equal) {
+				t.Errorf("WriteResultRows() rows =\n%q\nwant\n%q", got, tt.want)
+			}
+		})
+	}
+}
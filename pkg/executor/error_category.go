@@ -0,0 +1,120 @@
+package executor
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+)
+
+const (
+	ErrorCategoryKubectlMissing = "kubectl-missing"
+	ErrorCategoryAuth           = "auth"
+	ErrorCategoryForbidden      = "forbidden"
+	ErrorCategoryTLS            = "tls"
+	ErrorCategoryTimeout        = "timeout"
+	ErrorCategoryNetwork        = "network"
+	ErrorCategoryNotFound       = "not-found"
+	ErrorCategoryOther          = "other"
+)
+
+// errorCategoryRules are checked in order against the lowercased error message and stderr, the first matching rule wins
+var errorCategoryRules = []struct {
+	Category string
+	Patterns []string
+}{
+	{ErrorCategoryAuth, []string{"unauthorized", "you must be logged in", "provide credentials", "invalid bearer token", "token has expired", "getting credentials"}},
+	{ErrorCategoryForbidden, []string{"forbidden"}},
+	{ErrorCategoryTLS, []string{"x509:", "tls:", "certificate signed by", "certificate has expired", "certificate is valid for"}},
+	{ErrorCategoryTimeout, []string{"timeout", "timed out", "deadline exceeded"}},
+	{ErrorCategoryNetwork, []string{"no such host", "connection refused", "was refused", "connection reset", "network is unreachable", "no route to host", "unable to connect to the server", "dial tcp", ": eof", "unexpected eof"}},
+	{ErrorCategoryNotFound, []string{"notfound", "not found", "doesn't have a resource type", "does not exist"}},
+}
+
+var (
+	// klogPrefixRegex matches the prefix of klog lines, e.g. "E1019 02:00:00.123456   12345 memcache.go:265] "
+	klogPrefixRegex = regexp.MustCompile(`^[IWEF]\d{4} \d{2}:\d{2}:\d{2}\.\d+\s+\d+ [^\]]+\] `)
+
+	errorURLRegex    = regexp.MustCompile(`\bhttps?://\S+`)
+	errorHostRegex   = regexp.MustCompile(`\blookup \S+`)
+	errorIPRegex     = regexp.MustCompile(`\b\d{1,3}(\.\d{1,3}){3}(:\d+)?\b`)
+	errorQuotedRegex = regexp.MustCompile(`"[^"]*"`)
+	errorNumberRegex = regexp.MustCompile(`\b\d+\b`)
+)
+
+// ErrorGroup is a group of failed targets with the same error category and normalized message
+type ErrorGroup struct {
+	Category string   `json:"category" yaml:"category"`
+	Message  string   `json:"message" yaml:"message"`
+	Targets  []string `json:"targets" yaml:"targets"`
+}
+
+// ClassifyError returns the error category of a failed result, one of ErrorCategory*, by its exit code, error and stderr
+func ClassifyError(result *TaskResult) string {
+	return classifyError(result, result.FullStderr())
+}
+
+// classifyError classifies the error of the result with stderr which is already read
+func classifyError(result *TaskResult, stderr string) string {
+	if result.ExitCode == -1 && strings.Contains(result.Err, "executable file not found") {
+		return ErrorCategoryKubectlMissing
+	}
+	// URLs are removed as they may have misleading parts, e.g. "?timeout=32s" in requests of failed DNS lookups
+	text := strings.ToLower(errorURLRegex.ReplaceAllString(result.Err+"\n"+stderr, "<url>"))
+	for _, rule := range errorCategoryRules {
+		for _, pattern := range rule.Patterns {
+			if strings.Contains(text, pattern) {
+				return rule.Category
+			}
+		}
+	}
+	return ErrorCategoryOther
+}
+
+// ErrorMessage returns the line of stderr which explains the error, which is the last one except warnings,
+// or the error if stderr is empty
+func (r *TaskResult) ErrorMessage() string {
+	lines := strings.Split(strings.TrimSpace(r.FullStderr()), "\n")
+	for i := len(lines) - 1; i >= 0; i-- {
+		if message, warning := stderrWarning(lines[i]); message != "" && !warning {
+			return message
+		}
+	}
+	return r.Err
+}
+
+// normalizeErrorMessage replaces the parts of an error message which differ between clusters,
+// e.g. URLs, hosts, IPs, quoted names and numbers, so that the same error of different clusters can be grouped
+func normalizeErrorMessage(message string) string {
+	message = errorURLRegex.ReplaceAllString(message, "<url>")
+	message = errorHostRegex.ReplaceAllString(message, "lookup <host>")
+	message = errorIPRegex.ReplaceAllString(message, "<ip>")
+	message = errorQuotedRegex.ReplaceAllString(message, `"<name>"`)
+	return errorNumberRegex.ReplaceAllString(message, "<n>")
+}
+
+// groupErrors groups failed results by error category and normalized message, biggest group first
+func groupErrors(results []TaskResult) []ErrorGroup {
+	groups := []ErrorGroup{}
+	groupIndexes := map[string]int{} // category + message -> index in groups
+	for _, result := range results {
+		category := result.ErrorCategory
+		if category == "" {
+			category = ClassifyError(&result)
+		}
+		message := normalizeErrorMessage(result.ErrorMessage())
+
+		key := category + "\n" + message
+		i, ok := groupIndexes[key]
+		if !ok {
+			groups = append(groups, ErrorGroup{Category: category, Message: message})
+			i = len(groups) - 1
+			groupIndexes[key] = i
+		}
+		groups[i].Targets = append(groups[i].Targets, result.TaskItem.ID)
+	}
+
+	sort.SliceStable(groups, func(i, j int) bool {
+		return len(groups[i].Targets) > len(groups[j].Targets)
+	})
+	return groups
+}
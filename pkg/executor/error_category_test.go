@@ -0,0 +1,125 @@
+package executor
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestClassifyError(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      string
+		exitCode int
+		stderr   string
+		want     string
+	}{
+		{
+			name:     "kubectl missing",
+			err:      `exec: "kubectl": executable file not found in $PATH`,
+			exitCode: -1,
+			want:     ErrorCategoryKubectlMissing,
+		},
+		{
+			name:   "unauthorized",
+			stderr: "error: You must be logged in to the server (Unauthorized)\n",
+			want:   ErrorCategoryAuth,
+		},
+		{
+			name:   "expired exec credentials",
+			stderr: "E1019 02:00:00.123456   12345 memcache.go:265] couldn't get current server API group list: Get \"https://10.0.0.1/api?timeout=32s\": getting credentials: exec: executable aws failed with exit code 255\n",
+			want:   ErrorCategoryAuth,
+		},
+		{
+			name:   "forbidden",
+			stderr: "Error from server (Forbidden): pods is forbidden: User \"dev\" cannot list resource \"pods\" in API group \"\" in the namespace \"kube-system\"\n",
+			want:   ErrorCategoryForbidden,
+		},
+		{
+			name:   "unknown certificate authority",
+			stderr: "Unable to connect to the server: x509: certificate signed by unknown authority\n",
+			want:   ErrorCategoryTLS,
+		},
+		{
+			name: "connection refused",
+			stderr: "E1019 02:00:00.123456   12345 memcache.go:265] couldn't get current server API group list: Get \"https://127.0.0.1:6443/api?timeout=32s\": dial tcp 127.0.0.1:6443: connect: connection refused\n" +
+				"The connection to the server 127.0.0.1:6443 was refused - did you specify the right host or port?\n",
+			want: ErrorCategoryNetwork,
+		},
+		{
+			name:   "connection refused without klog",
+			stderr: "The connection to the server 10.0.0.1:6443 was refused - did you specify the right host or port?\n",
+			want:   ErrorCategoryNetwork,
+		},
+		{
+			name:   "no such host is not a timeout because of the url",
+			stderr: "Unable to connect to the server: dial tcp: lookup api.example.com on 10.0.0.2:53: no such host\nGet \"https://api.example.com/api?timeout=32s\": failed\n",
+			want:   ErrorCategoryNetwork,
+		},
+		{
+			name:   "client timeout",
+			stderr: "Unable to connect to the server: net/http: request canceled while waiting for connection (Client.Timeout exceeded while awaiting headers)\n",
+			want:   ErrorCategoryTimeout,
+		},
+		{
+			name:   "context deadline exceeded",
+			stderr: "Unable to connect to the server: context deadline exceeded\n",
+			want:   ErrorCategoryTimeout,
+		},
+		{
+			name: "context deadline exceeded of the run timeout",
+			err:  "context deadline exceeded",
+			want: ErrorCategoryTimeout,
+		},
+		{
+			name:   "not found",
+			stderr: "Error from server (NotFound): pods \"web-0\" not found\n",
+			want:   ErrorCategoryNotFound,
+		},
+		{
+			name:   "unknown resource type",
+			stderr: "error: the server doesn't have a resource type \"widgets\"\n",
+			want:   ErrorCategoryNotFound,
+		},
+		{
+			name:   "unknown",
+			stderr: "error: unknown flag: --bogus\nSee 'kubectl get --help' for usage.\n",
+			want:   ErrorCategoryOther,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.err
+			if err == "" {
+				err = "exit status 1"
+			}
+			exitCode := tt.exitCode
+			if exitCode == 0 {
+				exitCode = 1
+			}
+			result := &TaskResult{Err: err, ExitCode: exitCode, Stderr: tt.stderr, HasErr: true}
+			if got := ClassifyError(result); got != tt.want {
+				t.Errorf("ClassifyError() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGroupErrors(t *testing.T) {
+	refused := func(ip string) string {
+		return "The connection to the server " + ip + ":6443 was refused - did you specify the right host or port?\n"
+	}
+	results := []TaskResult{
+		{TaskItem: &Target{ID: "kc@a"}, Err: "exit status 1", ExitCode: 1, Stderr: refused("10.0.0.1")},
+		{TaskItem: &Target{ID: "kc@b"}, Err: "exit status 1", ExitCode: 1, Stderr: "Warning: v1 ComponentStatus is deprecated in v1.19+\nerror: You must be logged in to the server (Unauthorized)\n"},
+		{TaskItem: &Target{ID: "kc@c"}, Err: "exit status 1", ExitCode: 1, Stderr: refused("10.0.0.2")},
+		{TaskItem: &Target{ID: "kc@d"}, Err: "exit status 1", ExitCode: 1, Stderr: "Error from server (NotFound): pods \"web-0\" not found\n", ErrorCategory: ErrorCategoryNotFound},
+	}
+	want := []ErrorGroup{
+		{Category: ErrorCategoryNetwork, Message: "The connection to the server <ip> was refused - did you specify the right host or port?", Targets: []string{"kc@a", "kc@c"}},
+		{Category: ErrorCategoryAuth, Message: "error: You must be logged in to the server (Unauthorized)", Targets: []string{"kc@b"}},
+		{Category: ErrorCategoryNotFound, Message: `Error from server (NotFound): pods "<name>" not found`, Targets: []string{"kc@d"}},
+	}
+	if got := groupErrors(results); !reflect.DeepEqual(got, want) {
+		t.Errorf("groupErrors() = %+v\nwant %+v", got, want)
+	}
+}
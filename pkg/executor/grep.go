@@ -0,0 +1,100 @@
+package executor
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/junchaw/kubekraken/pkg/utils"
+)
+
+// grepLines keeps lines matching grep and not matching grepInvert (either can be nil),
+// header rows of kubectl tables are always kept, blocks without any matching line are dropped with their headers,
+// and remaining blocks are still separated by blank lines, the filtered output and the number of matching lines are returned.
+func grepLines(output string, grep, grepInvert *regexp.Regexp) (string, int) {
+	var blocks []string
+	var kept []string
+	matches, blockMatches := 0, 0
+	atBlockStart := true // a header row is the first line of a table, tables are separated by blank lines
+
+	endBlock := func() {
+		if blockMatches > 0 {
+			blocks = append(blocks, strings.Join(kept, "\n"))
+		}
+		kept, blockMatches = nil, 0
+	}
+
+	for line := range strings.SplitSeq(strings.TrimRight(output, "\n"), "\n") {
+		if strings.TrimSpace(line) == "" {
+			if !atBlockStart {
+				endBlock()
+			}
+			atBlockStart = true
+			continue
+		}
+		isHeader := atBlockStart && isTableHeader(line)
+		atBlockStart = false
+
+		if isHeader {
+			kept = append(kept, line)
+			continue
+		}
+		if grep != nil && !grep.MatchString(line) {
+			continue
+		}
+		if grepInvert != nil && grepInvert.MatchString(line) {
+			continue
+		}
+		kept = append(kept, line)
+		blockMatches++
+		matches++
+	}
+	endBlock()
+
+	if matches == 0 {
+		return "", 0
+	}
+	return strings.Join(blocks, "\n\n") + "\n", matches
+}
+
+// isTableHeader returns true if the line looks like a kubectl table header, e.g. "NAME   READY   STATUS"
+func isTableHeader(line string) bool {
+	hasLetter := false
+	for _, r := range line {
+		if unicode.IsLower(r) {
+			return false
+		}
+		if unicode.IsUpper(r) {
+			hasLetter = true
+		}
+	}
+	return hasLetter
+}
+
+// highlightGrepMatches styles the output for terminal, matches of grep are highlighted
+func (r *Run) highlightGrepMatches(output string) string {
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	atBlockStart := true
+	for i, line := range lines {
+		isHeader := atBlockStart && isTableHeader(line)
+		atBlockStart = strings.TrimSpace(line) == ""
+		if r.Options.Grep == nil || isHeader {
+			lines[i] = utils.Style.Info.Render(line)
+			continue
+		}
+
+		highlighted := strings.Builder{}
+		last := 0
+		for _, match := range r.Options.Grep.FindAllStringIndex(line, -1) {
+			if match[0] == match[1] {
+				continue
+			}
+			highlighted.WriteString(utils.Style.Info.Render(line[last:match[0]]))
+			highlighted.WriteString(utils.Style.Error.Render(line[match[0]:match[1]]))
+			last = match[1]
+		}
+		highlighted.WriteString(utils.Style.Info.Render(line[last:]))
+		lines[i] = highlighted.String()
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,114 @@
+package executor
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/junchaw/kubekraken/pkg/utils"
+	"github.com/muesli/termenv"
+)
+
+func TestGrepLines(t *testing.T) {
+	pods := "NAME   STATUS\n" +
+		"a      Running\n" +
+		"b      CrashLoopBackOff\n"
+	multi := "NAME    READY\n" +
+		"pod/a   1/1\n" +
+		"pod/b   0/1\n" +
+		"\n" +
+		"NAME        TYPE\n" +
+		"service/a   ClusterIP\n" +
+		"\n" +
+		"NAME           READY\n" +
+		"deployment/a   1/1\n"
+
+	tests := []struct {
+		name        string
+		output      string
+		grep        string
+		grepInvert  string
+		want        string
+		wantMatches int
+	}{
+		{"header is kept", pods, "Crash", "", "NAME   STATUS\nb      CrashLoopBackOff\n", 1},
+		{"invert", pods, "", "Crash", "NAME   STATUS\na      Running\n", 1},
+		{"grep and invert", pods, "a|b", "Running", "NAME   STATUS\nb      CrashLoopBackOff\n", 1},
+		{"no match", pods, "Pending", "", "", 0},
+		{
+			name: "blocks are separated by blank lines", output: multi, grep: "/a",
+			want: "NAME    READY\npod/a   1/1\n\nNAME        TYPE\nservice/a   ClusterIP\n\nNAME           READY\ndeployment/a   1/1\n", wantMatches: 3,
+		},
+		{
+			name: "blocks without matches are dropped", output: multi, grep: "pod/|deployment/",
+			want: "NAME    READY\npod/a   1/1\npod/b   0/1\n\nNAME           READY\ndeployment/a   1/1\n", wantMatches: 3,
+		},
+		{"plain lines", "a\nb\nab\n", "a", "", "a\nab\n", 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var grep, grepInvert *regexp.Regexp
+			if tt.grep != "" {
+				grep = regexp.MustCompile(tt.grep)
+			}
+			if tt.grepInvert != "" {
+				grepInvert = regexp.MustCompile(tt.grepInvert)
+			}
+			got, matches := grepLines(tt.output, grep, grepInvert)
+			if got != tt.want || matches != tt.wantMatches {
+				t.Errorf("grepLines() = %q, %d, want %q, %d", got, matches, tt.want, tt.wantMatches)
+			}
+		})
+	}
+}
+
+func TestHighlightGrepMatches(t *testing.T) {
+	r := NewRun(&RunOptions{Grep: regexp.MustCompile("RUNNING")})
+	lipgloss.SetColorProfile(termenv.ANSI)
+	defer lipgloss.SetColorProfile(termenv.Ascii)
+
+	// the data row looks like a header, but only the first line of a block is a header
+	lines := strings.Split(r.highlightGrepMatches("NAME    STATUS\nPOD-A   RUNNING\n\nNAME    STATUS\nPOD-B   RUNNING\n"), "\n")
+	match := utils.Style.Error.Render("RUNNING")
+	for _, i := range []int{1, 4} {
+		if !strings.Contains(lines[i], match) {
+			t.Errorf("line %d %q is not highlighted", i, lines[i])
+		}
+	}
+	for _, i := range []int{0, 3} {
+		if strings.Contains(lines[i], match) || lines[i] != utils.Style.Info.Render("NAME    STATUS") {
+			t.Errorf("header line %d %q is highlighted", i, lines[i])
+		}
+	}
+}
+
+func TestPrintResultGrepSpilledOutput(t *testing.T) {
+	var lines []string
+	for i := range 500 {
+		lines = append(lines, fmt.Sprintf("pod-%03d   Running", i))
+	}
+	stdout := "NAME      STATUS\n" + strings.Join(lines, "\n") + "\n"
+	spillFile := path.Join(t.TempDir(), "a.stdout.spill")
+	if err := os.WriteFile(spillFile, []byte(stdout), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	r := NewRun(&RunOptions{Grep: regexp.MustCompile("Running"), PrintStdout: true})
+	out := &bytes.Buffer{}
+	r.Out = out
+	r.printResult(&TaskResult{
+		TaskItem:          &Target{ID: "a", Index: 1},
+		Stdout:            stdout[:SpillPreviewSize],
+		StdoutFile:        spillFile,
+		HasStdout:         true,
+		NeedToPrintStdout: true,
+	})
+	if !strings.Contains(out.String(), "pod-499   Running") {
+		t.Errorf("the spilled part of stdout is not printed:\n%s", out.String()[max(0, out.Len()-200):])
+	}
+}
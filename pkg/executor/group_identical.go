@@ -0,0 +1,146 @@
+package executor
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/junchaw/kubekraken/pkg/utils"
+)
+
+// volatileColumns are table columns which differ between clusters or runs even if the resources are the same
+var volatileColumns = []string{"AGE", "LAST SEEN", "FIRST SEEN", "CREATED", "CREATED AT", "LAST SCHEDULE", "DURATION"}
+
+var (
+	timestampRegex   = regexp.MustCompile(`\d{4}-\d{2}-\d{2}[T ]\d{2}:\d{2}:\d{2}(\.\d+)?(Z|[+-]\d{2}:?\d{2})?`)
+	relativeAgeRegex = regexp.MustCompile(`\(\d+[smhdy](\d+[smhd])? ago\)`)
+)
+
+// OutputGroup is a group of targets which produced identical stdout after normalization
+type OutputGroup struct {
+	Fingerprint string
+
+	// Output is the stdout of the first target of the group, as it was printed by kubectl
+	Output  string
+	Targets []*Target
+}
+
+// GroupIdenticalOutputs groups successful results by their normalized stdout, biggest group first,
+// groups of the same size are sorted by the index of their first target.
+func (r *Run) GroupIdenticalOutputs() []OutputGroup {
+	var groups []OutputGroup
+	groupIndexes := map[string]int{} // fingerprint -> index in groups
+
+	for _, result := range r.sortedResults() {
+		if result.HasErr || !result.NeedToPrintStdout {
+			continue
+		}
+
+		stdout := result.FullStdout()
+		sum := sha256.Sum256([]byte(normalizeOutput(stdout, r.Options.GroupIgnoreVolatile)))
+		fingerprint := hex.EncodeToString(sum[:])[:12]
+
+		i, ok := groupIndexes[fingerprint]
+		if !ok {
+			groups = append(groups, OutputGroup{Fingerprint: fingerprint, Output: strings.Trim(stdout, "\r\n")})
+			i = len(groups) - 1
+			groupIndexes[fingerprint] = i
+		}
+		groups[i].Targets = append(groups[i].Targets, result.TaskItem)
+	}
+
+	sort.SliceStable(groups, func(i, j int) bool {
+		return len(groups[i].Targets) > len(groups[j].Targets)
+	})
+	return groups
+}
+
+// normalizeOutput removes differences which don't matter when comparing outputs: line endings, trailing spaces
+// and blank lines around the output, if ignoreVolatile is true, timestamps are removed too, and volatile columns
+// of table outputs, other outputs (e.g. YAML) are kept as is otherwise.
+func normalizeOutput(output string, ignoreVolatile bool) string {
+	output = strings.ReplaceAll(output, "\r\n", "\n")
+
+	if ignoreVolatile {
+		output = timestampRegex.ReplaceAllString(output, "<timestamp>")
+		output = relativeAgeRegex.ReplaceAllString(output, "(<age> ago)")
+		if isTableOutput(output) {
+			output = dropVolatileColumns(output)
+		}
+	}
+
+	lines := strings.Split(output, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(line, " \t")
+	}
+	return strings.Trim(strings.Join(lines, "\n"), "\n")
+}
+
+// isTableOutput returns true if each block of the output, separated by blank lines, starts with a kubectl table header
+func isTableOutput(output string) bool {
+	found := false
+	atBlockStart := true
+	for line := range strings.SplitSeq(output, "\n") {
+		if strings.TrimSpace(line) == "" {
+			atBlockStart = true
+			continue
+		}
+		if atBlockStart {
+			if !isTableHeader(line) {
+				return false
+			}
+			found = true
+		}
+		atBlockStart = false
+	}
+	return found
+}
+
+// dropVolatileColumns re-renders table outputs without volatile columns, at any position of the header
+func dropVolatileColumns(output string) string {
+	tables := utils.ParseTables(output)
+	rendered := make([]string, 0, len(tables))
+	for _, table := range tables {
+		var indexes []int
+		for i, column := range table.Header {
+			if !containsFold(volatileColumns, column) {
+				indexes = append(indexes, i)
+			}
+		}
+		rows := make([][]string, 0, len(table.Rows))
+		for _, row := range table.Rows {
+			rows = append(rows, pick(row, indexes))
+		}
+		rendered = append(rendered, utils.RenderTable(pick(table.Header, indexes), rows))
+	}
+	return strings.Join(rendered, "\n")
+}
+
+// printOutputGroups prints each distinct output once, with the targets which produced it
+func (r *Run) printOutputGroups() {
+	groups := r.GroupIdenticalOutputs()
+
+	fmt.Fprintln(r.Out)
+	fmt.Fprintln(r.Out, utils.Style.Dim.Render("---"))
+	fmt.Fprintln(r.Out, utils.Style.Text.Render(fmt.Sprintf("IDENTICAL OUTPUT GROUPS: %d distinct outputs", len(groups))))
+	for i, group := range groups {
+		ids := make([]string, 0, len(group.Targets))
+		for _, target := range group.Targets {
+			ids = append(ids, target.ID)
+		}
+
+		fmt.Fprintln(r.Out, utils.Style.Dim.Render("---"))
+		fmt.Fprintln(r.Out, utils.Style.Text.Render(fmt.Sprintf("GROUP %d/%d: %d targets (fingerprint %s)", i+1, len(groups), len(group.Targets), group.Fingerprint)))
+		fmt.Fprintln(r.Out, utils.Style.Text.Render("TARGETS: "+strings.Join(ids, ", ")))
+		fmt.Fprintln(r.Out, utils.Style.Info.Render("STDOUT:"))
+		if group.Output == "" {
+			fmt.Fprintln(r.Out, utils.Style.Dim.Render("(empty)"))
+		} else {
+			fmt.Fprintln(r.Out, utils.Style.Info.Render(group.Output))
+		}
+	}
+	fmt.Fprintln(r.Out, utils.Style.Dim.Render("---"))
+}
@@ -0,0 +1,104 @@
+package executor
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestNormalizeOutput(t *testing.T) {
+	tests := []struct {
+		name           string
+		output         string
+		ignoreVolatile bool
+		want           string
+	}{
+		{
+			name:   "line endings, trailing spaces and surrounding blank lines",
+			output: "\r\nNAME   READY  \r\na      1/1\r\n\r\n",
+			want:   "NAME   READY\na      1/1",
+		},
+		{
+			name:           "volatile column in the middle",
+			output:         "NAME   READY   AGE   IP\na      1/1     5d    10.0.0.1\n",
+			ignoreVolatile: true,
+			want:           "NAME   READY   IP\na      1/1     10.0.0.1",
+		},
+		{
+			name: "volatile column first",
+			output: "LAST SEEN   TYPE      REASON    OBJECT\n" +
+				"2m          Warning   BackOff   pod/a\n",
+			ignoreVolatile: true,
+			want:           "TYPE      REASON    OBJECT\nWarning   BackOff   pod/a",
+		},
+		{
+			name:           "yaml keeps indentation",
+			output:         "metadata:\n  name: x\n  creationTimestamp: \"2024-01-02T03:04:05Z\"\n",
+			ignoreVolatile: true,
+			want:           "metadata:\n  name: x\n  creationTimestamp: \"<timestamp>\"",
+		},
+		{
+			name:           "json keeps indentation",
+			output:         "{\n  \"kind\": \"List\"\n}\n",
+			ignoreVolatile: true,
+			want:           "{\n  \"kind\": \"List\"\n}",
+		},
+		{
+			name:           "relative ages of restarts",
+			output:         "NAME   RESTARTS\na      3 (2m ago)\n",
+			ignoreVolatile: true,
+			want:           "NAME   RESTARTS\na      3 (<age> ago)",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := normalizeOutput(tt.output, tt.ignoreVolatile); got != tt.want {
+				t.Errorf("normalizeOutput() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGroupIdenticalOutputs(t *testing.T) {
+	r := NewRun(&RunOptions{GroupIgnoreVolatile: true})
+	outputs := []string{
+		"NAME   AGE\nfoo    5d\n",
+		"NAME   AGE\nfoo    12d\n",
+		"NAME   AGE\nbar    5d\n",
+	}
+	for i, output := range outputs {
+		target := &Target{ID: string(rune('a' + i)), Index: i + 1}
+		r.Results[target.ID] = TaskResult{TaskItem: target, Stdout: output, HasStdout: true, NeedToPrintStdout: true}
+	}
+
+	groups := r.GroupIdenticalOutputs()
+	if len(groups) != 2 {
+		t.Fatalf("got %d groups, want 2", len(groups))
+	}
+	if len(groups[0].Targets) != 2 || groups[0].Targets[0].ID != "a" || groups[0].Targets[1].ID != "b" {
+		t.Errorf("first group has targets %v, want a and b", groups[0].Targets)
+	}
+	// the output of the first target is printed, not the normalized one
+	if want := "NAME   AGE\nfoo    5d"; groups[0].Output != want {
+		t.Errorf("first group output = %q, want %q", groups[0].Output, want)
+	}
+}
+
+func TestDiffRunsIgnoreVolatile(t *testing.T) {
+	record := func(runID, stdout string) *RunRecord {
+		return &RunRecord{RunID: runID, Results: map[string]TaskResult{
+			"a": {TaskItem: &Target{ID: "a", Index: 1}, Stdout: stdout},
+		}}
+	}
+
+	events := "LAST SEEN   TYPE      REASON\n%s          Warning   BackOff\n"
+	diffs := DiffRuns(record("1", fmt.Sprintf(events, "2m")), record("2", fmt.Sprintf(events, "5m")), true)
+	if diffs[0].Change != TargetChangeUnchanged {
+		t.Errorf("events with different LAST SEEN: change = %s, diff:\n%s", diffs[0].Change, diffs[0].Diff)
+	}
+
+	diffs = DiffRuns(record("1", "metadata:\n  name: x\n"), record("2", "metadata:\n  name: y\n"), true)
+	if diffs[0].Change != TargetChangeChanged || !strings.Contains(diffs[0].Diff, "+  name: y") {
+		t.Errorf("yaml diff lost indentation:\n%s", diffs[0].Diff)
+	}
+}
@@ -0,0 +1,368 @@
+package executor
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/junchaw/kubekraken/pkg/utils"
+)
+
+// HistoryIndexFile is the file in the history directory which lists saved runs, one JSON entry per line
+const HistoryIndexFile = "index.ndjson"
+
+// HistoryRefLatest refers to the latest run in the history, "latest~N" refers to the Nth run before it
+const HistoryRefLatest = "latest"
+
+// RunRecord is a saved run, it's the document written with --output-format json and to the history store
+type RunRecord struct {
+	RunID     string                `json:"runId"`
+	StartedAt time.Time             `json:"startedAt"`
+	Args      []string              `json:"args"`
+	Results   map[string]TaskResult `json:"results"`
+	Query     []CombinedQueryResult `json:"query,omitempty"`
+	Summary   RunSummary            `json:"summary"`
+}
+
+// LoadRunRecord loads a run saved as a JSON document, the summary is rebuilt from the results
+func LoadRunRecord(file string) (*RunRecord, error) {
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read run %s: %v", file, err)
+	}
+	record := &RunRecord{}
+	if err := json.Unmarshal(content, record); err != nil {
+		return nil, fmt.Errorf("failed to parse run %s: %v", file, err)
+	}
+	if record.Results == nil {
+		return nil, fmt.Errorf("failed to parse run %s: no results, is it saved with --output-format json?", file)
+	}
+	record.Summary = NewRunSummary(record.SortedResults())
+	return record, nil
+}
+
+// SortedResults returns all results sorted by target index, then by target ID for runs saved without indexes
+func (rec *RunRecord) SortedResults() []*TaskResult {
+	results := make([]*TaskResult, 0, len(rec.Results))
+	for id := range rec.Results {
+		result := rec.Results[id]
+		if result.TaskItem == nil {
+			result.TaskItem = &Target{ID: id}
+		}
+		results = append(results, &result)
+	}
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].TaskItem.Index != results[j].TaskItem.Index {
+			return results[i].TaskItem.Index < results[j].TaskItem.Index
+		}
+		return results[i].TaskItem.ID < results[j].TaskItem.ID
+	})
+	return results
+}
+
+// HistoryEntry is one line of the history index
+type HistoryEntry struct {
+	RunID        string    `json:"runId"`
+	StartedAt    time.Time `json:"startedAt"`
+	Args         []string  `json:"args"`
+	TotalCount   int       `json:"totalCount"`
+	ErrorCount   int       `json:"errorCount"`
+	WarningCount int       `json:"warningCount"`
+}
+
+// HistoryStore saves runs to a local directory, each run is a JSON document named after the run ID,
+// and the index lists saved runs from the oldest to the latest.
+type HistoryStore struct {
+	Dir string
+
+	// Limit is the max number of runs kept, older runs are removed when a run is saved, 0 means no limit
+	Limit int
+}
+
+func NewHistoryStore(dir string, limit int) *HistoryStore {
+	return &HistoryStore{Dir: dir, Limit: limit}
+}
+
+func (s *HistoryStore) runFile(runID string) string {
+	return path.Join(s.Dir, runID+".json")
+}
+
+// Save saves the run and adds it to the index, then removes runs beyond the limit
+func (s *HistoryStore) Save(r *Run, summary RunSummary) error {
+	// runs have the full outputs of all targets, so the history is only readable by the user
+	if err := os.MkdirAll(s.Dir, 0700); err != nil {
+		return fmt.Errorf("failed to create history directory: %v", err)
+	}
+
+	// the run is written to a temporary file first, so that the history never has a partial run
+	tmpFile := s.runFile(r.RunID) + ".tmp"
+	f, err := os.OpenFile(tmpFile, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to create history file: %v", err)
+	}
+	if err := r.writeJSONDocument(f, summary); err != nil {
+		f.Close()
+		os.Remove(tmpFile)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("failed to close history file: %v", err)
+	}
+	if err := os.Rename(tmpFile, s.runFile(r.RunID)); err != nil {
+		return fmt.Errorf("failed to rename history file: %v", err)
+	}
+
+	entry, err := json.Marshal(HistoryEntry{
+		RunID:        r.RunID,
+		StartedAt:    r.StartedAt,
+		Args:         r.Options.Args,
+		TotalCount:   summary.TotalCount,
+		ErrorCount:   summary.ErrorCount,
+		WarningCount: summary.WarningCount,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal history entry to json: %v", err)
+	}
+	index, err := os.OpenFile(path.Join(s.Dir, HistoryIndexFile), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open history index: %v", err)
+	}
+	defer index.Close()
+	if _, err := index.Write(append(entry, '\n')); err != nil {
+		return fmt.Errorf("failed to write history index: %v", err)
+	}
+
+	return s.prune()
+}
+
+// prune removes the oldest runs beyond the limit, and rewrites the index without them
+func (s *HistoryStore) prune() error {
+	entries, err := s.List()
+	if err != nil {
+		return err
+	}
+	if s.Limit <= 0 || len(entries) <= s.Limit {
+		return nil
+	}
+
+	removed := entries[:len(entries)-s.Limit]
+	for _, entry := range removed {
+		if err := os.Remove(s.runFile(entry.RunID)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("failed to remove run %s from history: %v", entry.RunID, err)
+		}
+	}
+
+	tmpIndex := path.Join(s.Dir, HistoryIndexFile+".tmp")
+	f, err := os.OpenFile(tmpIndex, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to create history index: %v", err)
+	}
+	for _, entry := range entries[len(removed):] {
+		content, err := json.Marshal(entry)
+		if err != nil {
+			f.Close()
+			return fmt.Errorf("failed to marshal history entry to json: %v", err)
+		}
+		if _, err := f.Write(append(content, '\n')); err != nil {
+			f.Close()
+			return fmt.Errorf("failed to write history index: %v", err)
+		}
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("failed to close history index: %v", err)
+	}
+	if err := os.Rename(tmpIndex, path.Join(s.Dir, HistoryIndexFile)); err != nil {
+		return fmt.Errorf("failed to rename history index: %v", err)
+	}
+	return nil
+}
+
+// List returns saved runs from the oldest to the latest
+func (s *HistoryStore) List() ([]HistoryEntry, error) {
+	f, err := os.Open(path.Join(s.Dir, HistoryIndexFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return []HistoryEntry{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open history index: %v", err)
+	}
+	defer f.Close()
+
+	entries := []HistoryEntry{}
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 16<<20)
+	for scanner.Scan() {
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+		var entry HistoryEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return nil, fmt.Errorf("failed to parse history index: %v", err)
+		}
+		entries = append(entries, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read history index: %v", err)
+	}
+	return entries, nil
+}
+
+// Resolve returns the run ID of a reference, which is "latest", "latest~N", a run ID or a unique prefix of it
+func (s *HistoryStore) Resolve(ref string) (string, error) {
+	entries, err := s.List()
+	if err != nil {
+		return "", err
+	}
+
+	if ref == HistoryRefLatest || strings.HasPrefix(ref, HistoryRefLatest+"~") {
+		back := 0
+		if ref != HistoryRefLatest {
+			if back, err = strconv.Atoi(strings.TrimPrefix(ref, HistoryRefLatest+"~")); err != nil || back < 0 {
+				return "", fmt.Errorf("invalid run reference %q, must be like %s~1", ref, HistoryRefLatest)
+			}
+		}
+		if back >= len(entries) {
+			return "", fmt.Errorf("run %s not found, there are %d runs in history", ref, len(entries))
+		}
+		return entries[len(entries)-1-back].RunID, nil
+	}
+
+	var matches []string
+	for _, entry := range entries {
+		if entry.RunID == ref {
+			return ref, nil
+		}
+		if strings.HasPrefix(entry.RunID, ref) {
+			matches = append(matches, entry.RunID)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return "", fmt.Errorf("run %s not found in history", ref)
+	case 1:
+		return matches[0], nil
+	default:
+		return "", fmt.Errorf("run %s is ambiguous, it matches: %s", ref, strings.Join(matches, ", "))
+	}
+}
+
+// Load loads the run of a reference, see Resolve
+func (s *HistoryStore) Load(ref string) (*RunRecord, error) {
+	runID, err := s.Resolve(ref)
+	if err != nil {
+		return nil, err
+	}
+	return LoadRunRecord(s.runFile(runID))
+}
+
+const (
+	TargetChangeNew       = "new"
+	TargetChangeMissing   = "missing"
+	TargetChangeChanged   = "changed"
+	TargetChangeUnchanged = "unchanged"
+)
+
+// TargetDiff is the change of a target between two runs
+type TargetDiff struct {
+	ID     string `json:"id"`
+	Change string `json:"change"`
+
+	// StatusA and StatusB are the statuses in both runs, see TaskStatus*, empty if the target is not in the run
+	StatusA string `json:"statusA,omitempty"`
+	StatusB string `json:"statusB,omitempty"`
+
+	// Diff is the unified diff of stdout, empty if stdout is the same
+	Diff string `json:"diff,omitempty"`
+}
+
+// DiffRuns compares the targets of two runs, in the target order of run b followed by targets only in run a,
+// with ignoreVolatile, volatile table columns and timestamps are ignored when comparing stdout.
+func DiffRuns(a, b *RunRecord, ignoreVolatile bool) []TargetDiff {
+	var ids []string
+	seen := map[string]bool{}
+	for _, result := range b.SortedResults() {
+		ids = append(ids, result.TaskItem.ID)
+		seen[result.TaskItem.ID] = true
+	}
+	for _, result := range a.SortedResults() {
+		if !seen[result.TaskItem.ID] {
+			ids = append(ids, result.TaskItem.ID)
+		}
+	}
+
+	diffs := make([]TargetDiff, 0, len(ids))
+	for _, id := range ids {
+		resultA, inA := a.Results[id]
+		resultB, inB := b.Results[id]
+		diff := TargetDiff{ID: id}
+		switch {
+		case !inA:
+			diff.Change = TargetChangeNew
+			diff.StatusB = resultB.Status()
+		case !inB:
+			diff.Change = TargetChangeMissing
+			diff.StatusA = resultA.Status()
+		default:
+			diff.StatusA, diff.StatusB = resultA.Status(), resultB.Status()
+			diff.Diff = utils.UnifiedDiff(
+				normalizeOutput(resultA.FullStdout(), ignoreVolatile)+"\n",
+				normalizeOutput(resultB.FullStdout(), ignoreVolatile)+"\n",
+				a.RunID+"/"+id, b.RunID+"/"+id, 3)
+			diff.Change = TargetChangeUnchanged
+			if diff.StatusA != diff.StatusB || diff.Diff != "" {
+				diff.Change = TargetChangeChanged
+			}
+		}
+		diffs = append(diffs, diff)
+	}
+	return diffs
+}
+
+// PrintRunDiff prints the changed, new and missing targets between two runs, and counts of each kind of change
+func PrintRunDiff(out io.Writer, a, b *RunRecord, diffs []TargetDiff) {
+	fmt.Fprintln(out, utils.Style.Text.Render(fmt.Sprintf("DIFF: %s (%s) -> %s (%s)",
+		a.RunID, utils.ShellJoin(a.Args), b.RunID, utils.ShellJoin(b.Args))))
+
+	counts := map[string]int{}
+	for _, diff := range diffs {
+		counts[diff.Change]++
+		switch diff.Change {
+		case TargetChangeNew:
+			fmt.Fprintln(out, utils.Style.Success.Render(fmt.Sprintf("+ %s: new target (%s)", diff.ID, diff.StatusB)))
+		case TargetChangeMissing:
+			fmt.Fprintln(out, utils.Style.Error.Render(fmt.Sprintf("- %s: missing target (was %s)", diff.ID, diff.StatusA)))
+		case TargetChangeChanged:
+			fmt.Fprintln(out, utils.Style.Dim.Render("---"))
+			if diff.StatusA != diff.StatusB {
+				fmt.Fprintln(out, utils.Style.Warning.Render(fmt.Sprintf("~ %s: status %s -> %s", diff.ID, diff.StatusA, diff.StatusB)))
+			} else {
+				fmt.Fprintln(out, utils.Style.Warning.Render(fmt.Sprintf("~ %s: stdout changed", diff.ID)))
+			}
+			for _, line := range strings.Split(strings.TrimSuffix(diff.Diff, "\n"), "\n") {
+				switch {
+				case line == "":
+				case strings.HasPrefix(line, "+++"), strings.HasPrefix(line, "---"), strings.HasPrefix(line, "@@"):
+					fmt.Fprintln(out, utils.Style.Dim.Render(line))
+				case strings.HasPrefix(line, "+"):
+					fmt.Fprintln(out, utils.Style.Success.Render(line))
+				case strings.HasPrefix(line, "-"):
+					fmt.Fprintln(out, utils.Style.Error.Render(line))
+				default:
+					fmt.Fprintln(out, utils.Style.Info.Render(line))
+				}
+			}
+		}
+	}
+
+	fmt.Fprintln(out, utils.Style.Dim.Render("---"))
+	fmt.Fprintln(out, utils.Style.Text.Render(fmt.Sprintf("%d changed, %d new, %d missing, %d unchanged",
+		counts[TargetChangeChanged], counts[TargetChangeNew], counts[TargetChangeMissing], counts[TargetChangeUnchanged])))
+}
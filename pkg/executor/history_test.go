@@ -0,0 +1,68 @@
+package executor
+
+import (
+	"os"
+	"path"
+	"testing"
+	"time"
+)
+
+func TestHistoryStoreSave(t *testing.T) {
+	dir := path.Join(t.TempDir(), "history")
+	store := NewHistoryStore(dir, 2)
+
+	var runIDs []string
+	for i := range 3 {
+		r := NewRun(&RunOptions{Args: []string{"get", "pods"}})
+		r.StartedAt = time.Date(2024, 1, 2, 3, 4, i, 0, time.UTC)
+		r.RunID = newRunID(r.StartedAt)
+		target := &Target{ID: "a", Context: "a", Index: 1}
+		r.Results[target.ID] = TaskResult{TaskItem: target, Stdout: "secret output\n", Duration: time.Second}
+		if err := store.Save(r, NewRunSummary(r.sortedResults())); err != nil {
+			t.Fatal(err)
+		}
+		runIDs = append(runIDs, r.RunID)
+	}
+
+	// runs have full outputs, so nothing is readable by other users
+	info, err := os.Stat(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := info.Mode().Perm(); perm != 0700 {
+		t.Errorf("history directory mode = %o, want 700", perm)
+	}
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range files {
+		info, err := file.Info()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if perm := info.Mode().Perm(); perm != 0600 {
+			t.Errorf("%s mode = %o, want 600", file.Name(), perm)
+		}
+	}
+
+	// the oldest run is pruned
+	entries, err := store.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 || entries[0].RunID != runIDs[1] || entries[1].RunID != runIDs[2] {
+		t.Errorf("entries = %+v, want the last 2 runs", entries)
+	}
+	if _, err := os.Stat(store.runFile(runIDs[0])); !os.IsNotExist(err) {
+		t.Errorf("pruned run file still exists: %v", err)
+	}
+
+	record, err := store.Load("latest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result := record.Results["a"]; result.Stdout != "secret output\n" || result.Duration != time.Second {
+		t.Errorf("loaded result = %+v", result)
+	}
+}
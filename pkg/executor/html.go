@@ -0,0 +1,132 @@
+package executor
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/junchaw/kubekraken/pkg/utils"
+)
+
+type htmlReport struct {
+	Command   string
+	StartedAt string
+	Summary   *RunSummary
+}
+
+type htmlTarget struct {
+	ID       string
+	Command  string
+	Status   string
+	ExitCode int
+	Duration string
+	Err      string
+	Stdout   string
+	Stderr   string
+}
+
+// WriteHTML writes the summary as a self-contained HTML page, styles and scripts are inlined so that it loads no external assets,
+// kubectlArgs are the args passed to kubectl after the kubeconfig and context flags.
+// Targets are rendered one by one, so that only the output of one target is in memory at a time.
+func (s *RunSummary) WriteHTML(w io.Writer, kubectlArgs []string, startedAt time.Time) error {
+	report := htmlReport{
+		Command:   "kubectl " + utils.ShellJoin(kubectlArgs),
+		StartedAt: startedAt.Format(time.RFC3339),
+		Summary:   s,
+	}
+	if err := htmlReportTemplate.ExecuteTemplate(w, "head", report); err != nil {
+		return fmt.Errorf("failed to render html report: %v", err)
+	}
+	for i := range s.results {
+		result := &s.results[i]
+		target := htmlTarget{
+			ID:       result.TaskItem.ID,
+			Command:  "kubectl " + utils.ShellJoin(append([]string{"--kubeconfig", result.TaskItem.Kubeconfig, "--context", result.TaskItem.Context}, kubectlArgs...)),
+			Status:   result.Status(),
+			ExitCode: result.ExitCode,
+			Duration: fmt.Sprintf("%.3fs", result.Duration.Seconds()),
+			Err:      result.Err,
+			Stderr:   strings.TrimRight(result.FullStderr(), "\n"),
+		}
+		if result.NeedToPrintStdout {
+			target.Stdout = strings.TrimRight(resultOutput(result), "\n")
+		}
+		if err := htmlReportTemplate.ExecuteTemplate(w, "target", target); err != nil {
+			return fmt.Errorf("failed to render html report: %v", err)
+		}
+	}
+	if err := htmlReportTemplate.ExecuteTemplate(w, "tail", nil); err != nil {
+		return fmt.Errorf("failed to render html report: %v", err)
+	}
+	return nil
+}
+
+var htmlReportTemplate = template.Must(template.New("report").Parse(`{{define "head"}}<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>kubekraken: {{.Command}}</title>
+<style>
+body { font-family: -apple-system, BlinkMacSystemFont, "Segoe UI", Helvetica, Arial, sans-serif; margin: 2em; color: #24292f; }
+code, pre { font-family: ui-monospace, SFMono-Regular, Menlo, Consolas, monospace; font-size: 12px; }
+pre { background: #f6f8fa; padding: 8px; overflow-x: auto; margin: 4px 0; }
+.counts span { display: inline-block; margin-right: 1.5em; font-weight: bold; }
+.filters { margin: 1em 0; }
+.filters input[type=text] { width: 24em; padding: 4px; }
+.target { border: 1px solid #d0d7de; border-radius: 6px; margin: 6px 0; padding: 4px 8px; }
+.target > summary { cursor: pointer; }
+.status { display: inline-block; min-width: 5em; font-weight: bold; }
+.status-success .status { color: #1a7f37; }
+.status-warning .status { color: #9a6700; }
+.status-error { border-color: #cf222e; background: #fff5f5; }
+.status-error .status, .error { color: #cf222e; }
+.meta { color: #57606a; margin-left: 1em; }
+</style>
+</head>
+<body>
+<h1>kubekraken report</h1>
+<p>Command: <code>{{.Command}}</code></p>
+<p>Started at: {{.StartedAt}}</p>
+<p class="counts">
+<span>{{.Summary.TotalCount}} total</span>
+<span class="status-success"><span class="status">{{.Summary.SuccessCount}} successful</span></span>
+<span class="status-warning"><span class="status">{{.Summary.WarningCount}} with warnings</span></span>
+<span class="status-error"><span class="status">{{.Summary.ErrorCount}} error</span></span>
+</p>
+<div class="filters">
+<input id="filter" type="text" placeholder="Filter targets by id">
+<label><input class="status-filter" type="checkbox" value="success" checked> success</label>
+<label><input class="status-filter" type="checkbox" value="warning" checked> warning</label>
+<label><input class="status-filter" type="checkbox" value="error" checked> error</label>
+</div>
+{{end}}{{define "target"}}
+<details class="target status-{{.Status}}" data-id="{{.ID}}" data-status="{{.Status}}"{{if eq .Status "error"}} open{{end}}>
+<summary><span class="status">{{.Status}}</span> <code>{{.ID}}</code><span class="meta">exit code {{.ExitCode}}, {{.Duration}}</span></summary>
+<p>Command: <code>{{.Command}}</code></p>
+{{if .Err}}<pre class="error">{{.Err}}</pre>{{end}}
+{{if .Stdout}}<details open><summary>stdout</summary><pre>{{.Stdout}}</pre></details>{{end}}
+{{if .Stderr}}<details{{if eq .Status "error"}} open{{end}}><summary>stderr</summary><pre{{if eq .Status "error"}} class="error"{{end}}>{{.Stderr}}</pre></details>{{end}}
+</details>
+{{end}}{{define "tail"}}
+<script>
+(function () {
+  var filter = document.getElementById("filter");
+  var statuses = document.querySelectorAll(".status-filter");
+  function apply() {
+    var text = filter.value.toLowerCase();
+    var shown = {};
+    statuses.forEach(function (s) { shown[s.value] = s.checked; });
+    document.querySelectorAll(".target").forEach(function (t) {
+      var visible = shown[t.dataset.status] && t.dataset.id.toLowerCase().indexOf(text) >= 0;
+      t.style.display = visible ? "" : "none";
+    });
+  }
+  filter.addEventListener("input", apply);
+  statuses.forEach(function (s) { s.addEventListener("change", apply); });
+})();
+</script>
+</body>
+</html>
+{{end}}`))
@@ -0,0 +1,176 @@
+package executor
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/junchaw/kubekraken/pkg/utils"
+)
+
+// junitTestSuites and junitTestSuite are only used to read reports back, e.g. in tests,
+// reports are written by WriteJUnit, which encodes test cases one by one
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Errors   int              `xml:"errors,attr"`
+	Time     string           `xml:"time,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name      string          `xml:"name,attr"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	Errors    int             `xml:"errors,attr"`
+	Time      string          `xml:"time,attr"`
+	Timestamp string          `xml:"timestamp,attr"`
+	Cases     []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Error     *junitFailure `xml:"error,omitempty"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+	SystemOut *junitOutput  `xml:"system-out,omitempty"`
+	SystemErr *junitOutput  `xml:"system-err,omitempty"`
+}
+
+// junitOutput is written as CDATA, so that outputs stay readable in the report,
+// encoding/xml splits "]]>" in the text into two CDATA sections
+type junitOutput struct {
+	Text string `xml:",cdata"`
+}
+
+// ansiEscapeRegex matches terminal escape sequences, e.g. colors of kubectl plugins
+var ansiEscapeRegex = regexp.MustCompile(`\x1b\[[0-9;?]*[ -/]*[@-~]|\x1b[@-Z\\-_]`)
+
+// junitText removes terminal escape sequences and characters which are not allowed in XML 1.0 (e.g. control bytes),
+// CDATA is not escaped, so these would make the report unparsable
+func junitText(s string) string {
+	s = ansiEscapeRegex.ReplaceAllString(s, "")
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r == '\t' || r == '\n' || r == '\r':
+			return r
+		case r < 0x20, r >= 0xD800 && r <= 0xDFFF, r == 0xFFFE, r == 0xFFFF:
+			return -1
+		}
+		return r // invalid UTF-8 is mapped to U+FFFD, which is allowed
+	}, s)
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// WriteJUnit writes the summary as a JUnit XML report with one testcase per target,
+// a testcase has an error if kubectl failed, and a failure if the output condition matched, i.e. the target is offending.
+// Test cases are encoded one by one, so that only the output of one target is in memory at a time.
+func (s *RunSummary) WriteJUnit(w io.Writer, name string, timestamp time.Time) error {
+	var total time.Duration
+	failureCount, errorCount := 0, 0
+	for i := range s.results {
+		result := &s.results[i]
+		total += result.Duration
+		if result.HasErr {
+			errorCount++
+		} else if result.ConditionMatched {
+			failureCount++
+		}
+	}
+	counts := []xml.Attr{
+		{Name: xml.Name{Local: "tests"}, Value: fmt.Sprint(len(s.results))},
+		{Name: xml.Name{Local: "failures"}, Value: fmt.Sprint(failureCount)},
+		{Name: xml.Name{Local: "errors"}, Value: fmt.Sprint(errorCount)},
+		{Name: xml.Name{Local: "time"}, Value: junitSeconds(total)},
+	}
+	suites := xml.StartElement{Name: xml.Name{Local: "testsuites"}, Attr: counts}
+	suite := xml.StartElement{Name: xml.Name{Local: "testsuite"}, Attr: append([]xml.Attr{{Name: xml.Name{Local: "name"}, Value: name}}, append(counts,
+		xml.Attr{Name: xml.Name{Local: "timestamp"}, Value: timestamp.Format("2006-01-02T15:04:05")})...)}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return fmt.Errorf("failed to write junit report: %v", err)
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.EncodeToken(suites); err != nil {
+		return fmt.Errorf("failed to marshal junit report: %v", err)
+	}
+	if err := enc.EncodeToken(suite); err != nil {
+		return fmt.Errorf("failed to marshal junit report: %v", err)
+	}
+	for i := range s.results {
+		if err := enc.EncodeElement(junitCase(&s.results[i]), xml.StartElement{Name: xml.Name{Local: "testcase"}}); err != nil {
+			return fmt.Errorf("failed to marshal junit report: %v", err)
+		}
+	}
+	if err := enc.EncodeToken(suite.End()); err != nil {
+		return fmt.Errorf("failed to marshal junit report: %v", err)
+	}
+	if err := enc.EncodeToken(suites.End()); err != nil {
+		return fmt.Errorf("failed to marshal junit report: %v", err)
+	}
+	if err := enc.Flush(); err != nil {
+		return fmt.Errorf("failed to write junit report: %v", err)
+	}
+	if _, err := io.WriteString(w, "\n"); err != nil {
+		return fmt.Errorf("failed to write junit report: %v", err)
+	}
+	return nil
+}
+
+// junitCase returns the testcase of a target, with its full stdout and stderr
+func junitCase(result *TaskResult) junitTestCase {
+	testCase := junitTestCase{
+		Name:      result.TaskItem.ID,
+		ClassName: result.TaskItem.Context,
+		Time:      junitSeconds(result.Duration),
+	}
+	if stdout := result.FullStdout(); stdout != "" {
+		testCase.SystemOut = &junitOutput{Text: junitText(stdout)}
+	}
+	if stderr := result.FullStderr(); stderr != "" {
+		testCase.SystemErr = &junitOutput{Text: junitText(stderr)}
+	}
+	if result.HasErr {
+		message := junitText(result.Err)
+		testCase.Error = &junitFailure{Message: message, Type: result.ErrorCategory, Text: message}
+	} else if result.ConditionMatched {
+		testCase.Failure = &junitFailure{Message: "output condition matched", Type: "condition"}
+	}
+	return testCase
+}
+
+func junitSeconds(d time.Duration) string {
+	return fmt.Sprintf("%.3f", d.Seconds())
+}
+
+// writeJUnitReport writes the JUnit report of the summary, the test suite is named after the kubectl command
+func (r *Run) writeJUnitReport(summary RunSummary) error {
+	if err := os.MkdirAll(path.Dir(r.Options.JUnitReport), 0755); err != nil {
+		return fmt.Errorf("failed to create junit report directory: %v", err)
+	}
+	f, err := os.OpenFile(r.Options.JUnitReport, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to write junit report: %v", err)
+	}
+	defer f.Close()
+	if err := summary.WriteJUnit(f, "kubectl "+utils.ShellJoin(r.KubectlArgs), r.StartedAt); err != nil {
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("failed to write junit report: %v", err)
+	}
+	return nil
+}
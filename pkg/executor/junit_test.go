@@ -0,0 +1,51 @@
+package executor
+
+import (
+	"bytes"
+	"encoding/xml"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestToJUnit(t *testing.T) {
+	results := []*TaskResult{
+		{TaskItem: &Target{ID: "a", Context: "a", Index: 1}, Stdout: "\x1b[31mred\x1b[0m ok\x00\x07\n]]> end\n", Duration: 1500 * time.Millisecond},
+		{TaskItem: &Target{ID: "b", Context: "b", Index: 2}, Err: "exit status 1\x1b[0m", Stderr: "error: \x08bad\xff\n", HasErr: true, ErrorCategory: ErrorCategoryAuth, NeedToPrintErr: true},
+		{TaskItem: &Target{ID: "c", Context: "c", Index: 3}, Stdout: "CrashLoopBackOff\n", ConditionMatched: true},
+	}
+	summary := NewRunSummary(results)
+	var buf bytes.Buffer
+	if err := summary.WriteJUnit(&buf, "kubectl get pods", time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)); err != nil {
+		t.Fatal(err)
+	}
+	content := buf.Bytes()
+
+	var report junitTestSuites
+	if err := xml.Unmarshal(content, &report); err != nil {
+		t.Fatalf("report is not valid xml: %v\n%s", err, content)
+	}
+	if report.Tests != 3 || report.Errors != 1 || report.Failures != 1 {
+		t.Errorf("tests=%d errors=%d failures=%d, want 3, 1, 1", report.Tests, report.Errors, report.Failures)
+	}
+
+	cases := report.Suites[0].Cases
+	if got, want := cases[0].SystemOut.Text, "red ok\n]]> end\n"; got != want {
+		t.Errorf("system-out = %q, want %q", got, want)
+	}
+	if got, want := cases[1].SystemErr.Text, "error: bad�\n"; got != want {
+		t.Errorf("system-err = %q, want %q", got, want)
+	}
+	if cases[1].Error == nil || cases[1].Error.Message != "exit status 1" || cases[1].Error.Type != ErrorCategoryAuth {
+		t.Errorf("error = %+v", cases[1].Error)
+	}
+	if cases[2].Failure == nil || cases[2].Failure.Type != "condition" {
+		t.Errorf("failure = %+v", cases[2].Failure)
+	}
+	if cases[0].Time != "1.500" {
+		t.Errorf("time = %s, want 1.500", cases[0].Time)
+	}
+	if strings.Count(string(content), "<![CDATA[") < 4 { // "]]>" splits the stdout of a into two sections
+		t.Errorf("]]> is not split into CDATA sections:\n%s", content)
+	}
+}
@@ -0,0 +1,150 @@
+package executor
+
+import (
+	"fmt"
+	"html"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/junchaw/kubekraken/pkg/utils"
+)
+
+// markdownShortOutputSize is the max number of characters of the output shown in the markdown table
+const markdownShortOutputSize = 80
+
+// WriteMarkdown writes the summary as markdown, with a table of all targets and the details of failing targets,
+// a target is failing if it has an error or matches the output condition. The report is truncated to maxBytes,
+// table rows are kept before details, and a note tells what was omitted; 0 means no limit.
+// The command in the title is shortened if the head doesn't fit, an error is returned if maxBytes is too small for it.
+// Details are rendered one by one, so that only the output of one target is in memory at a time.
+func (s *RunSummary) WriteMarkdown(w io.Writer, kubectlArgs []string, startedAt time.Time, maxBytes int) error {
+	command := utils.ShellJoin(kubectlArgs)
+	head := s.markdownHead(command, startedAt)
+
+	// rows are short, so they are collected to know how many fit, details are rendered only when they are written
+	var rows []string
+	var failing []*TaskResult
+	for i := range s.results {
+		result := &s.results[i]
+		rows = append(rows, fmt.Sprintf("| `%s` | %s | %s |\n", result.TaskItem.ID, result.Status(), markdownShortOutput(result)))
+		if result.HasErr || result.ConditionMatched {
+			failing = append(failing, result)
+		}
+	}
+
+	// the note is reserved up front, so that the report with the note still fits in maxBytes
+	const noteTemplate = "\n_Truncated to %d bytes: %d of %d table rows and %d of %d failure details are omitted._\n"
+	budget := maxBytes - len(head) - len(fmt.Sprintf(noteTemplate, maxBytes, len(rows), len(rows), len(failing), len(failing)))
+	if maxBytes > 0 && budget < 0 {
+		// the command is the only part of the head which can be long
+		n := len(command) + budget - len("...")
+		if n < 0 {
+			return fmt.Errorf("markdown report can't fit in %d bytes", maxBytes)
+		}
+		head = s.markdownHead(utils.HeadUTF8(command, n)+"...", startedAt)
+		budget = maxBytes - len(head) - len(fmt.Sprintf(noteTemplate, maxBytes, len(rows), len(rows), len(failing), len(failing)))
+	}
+
+	if _, err := io.WriteString(w, head); err != nil {
+		return fmt.Errorf("failed to write markdown report: %v", err)
+	}
+	keptRows, keptDetails := 0, 0
+	for _, row := range rows {
+		if maxBytes > 0 && len(row) > budget {
+			break
+		}
+		if _, err := io.WriteString(w, row); err != nil {
+			return fmt.Errorf("failed to write markdown report: %v", err)
+		}
+		budget -= len(row)
+		keptRows++
+	}
+	if keptRows == len(rows) && len(failing) > 0 {
+		if _, err := io.WriteString(w, "\n"); err != nil {
+			return fmt.Errorf("failed to write markdown report: %v", err)
+		}
+		for _, result := range failing {
+			d := markdownDetails(result)
+			if maxBytes > 0 && len(d) > budget {
+				break
+			}
+			if _, err := io.WriteString(w, d); err != nil {
+				return fmt.Errorf("failed to write markdown report: %v", err)
+			}
+			budget -= len(d)
+			keptDetails++
+		}
+	}
+
+	if keptRows < len(rows) || keptDetails < len(failing) {
+		if _, err := fmt.Fprintf(w, noteTemplate, maxBytes, len(rows)-keptRows, len(rows), len(failing)-keptDetails, len(failing)); err != nil {
+			return fmt.Errorf("failed to write markdown report: %v", err)
+		}
+	}
+	return nil
+}
+
+// markdownHead renders the title, the counts and the table header
+func (s *RunSummary) markdownHead(command string, startedAt time.Time) string {
+	head := &strings.Builder{}
+	fmt.Fprintf(head, "### kubekraken: `kubectl %s`\n\n", command)
+	fmt.Fprintf(head, "Started at %s: **%d** successful (%d with warnings), **%d** error, %d total\n\n",
+		startedAt.Format(time.RFC3339), s.SuccessCount(), s.WarningCount, s.ErrorCount, s.TotalCount)
+	head.WriteString("| Target | Status | Output |\n| --- | --- | --- |\n")
+	return head.String()
+}
+
+// markdownShortOutput returns the first line of the error, or the first line of stdout which is not a table header,
+// escaped to be used in a table cell
+func markdownShortOutput(result *TaskResult) string {
+	var lines []string
+	if result.HasErr {
+		lines = strings.Split(strings.TrimSpace(result.FullStderr()+"\n"+result.Err), "\n")
+	} else if result.NeedToPrintStdout {
+		for line := range strings.SplitSeq(strings.TrimSpace(resultOutput(result)), "\n") {
+			if len(lines) == 0 && isTableHeader(line) {
+				continue
+			}
+			lines = append(lines, line)
+		}
+	}
+	if len(lines) == 0 || strings.TrimSpace(lines[0]) == "" {
+		return ""
+	}
+
+	short := truncate(strings.Join(strings.Fields(lines[0]), " "), markdownShortOutputSize)
+	short = "`" + strings.ReplaceAll(strings.ReplaceAll(short, "`", "'"), "|", "\\|") + "`"
+	if len(lines) > 1 {
+		short += fmt.Sprintf(" (+%d lines)", len(lines)-1)
+	}
+	return short
+}
+
+// markdownDetails renders error, stderr and stdout of a failing target in a collapsed block
+func markdownDetails(result *TaskResult) string {
+	b := &strings.Builder{}
+	fmt.Fprintf(b, "<details><summary><code>%s</code>: %s</summary>\n\n", html.EscapeString(result.TaskItem.ID), result.Status())
+	if result.Err != "" {
+		fmt.Fprintf(b, "Error:\n\n%s\n", markdownCodeBlock(result.Err))
+	}
+	if stderr := strings.TrimSpace(result.FullStderr()); stderr != "" {
+		fmt.Fprintf(b, "Stderr:\n\n%s\n", markdownCodeBlock(stderr))
+	}
+	if result.NeedToPrintStdout {
+		if stdout := strings.TrimSpace(resultOutput(result)); stdout != "" {
+			fmt.Fprintf(b, "Stdout:\n\n%s\n", markdownCodeBlock(stdout))
+		}
+	}
+	b.WriteString("</details>\n\n")
+	return b.String()
+}
+
+// markdownCodeBlock fences the content with enough backticks so that backticks in the content don't close it
+func markdownCodeBlock(content string) string {
+	fence := "```"
+	for strings.Contains(content, fence) {
+		fence += "`"
+	}
+	return fence + "\n" + content + "\n" + fence + "\n"
+}
@@ -0,0 +1,167 @@
+package executor
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/junchaw/kubekraken/pkg/utils"
+)
+
+const (
+	MergeTableTargetColumnContext = "context"
+	MergeTableTargetColumnID      = "id"
+)
+
+// MergeTables parses the kubectl table output of each result and merges tables with the same header into one table,
+// with a leading CLUSTER (context) or TARGET (target ID) column, results are merged in target order.
+func (r *Run) MergeTables() ([]utils.Table, error) {
+	targetHeader, targetValue, err := r.mergeTableTargetColumn()
+	if err != nil {
+		return nil, err
+	}
+
+	var merged []utils.Table
+	tableIndexes := map[string]int{} // header signature -> index in merged
+
+	for _, result := range r.sortedResults() {
+		if !result.NeedToPrintStdout {
+			continue
+		}
+		for _, table := range utils.ParseTables(result.FullStdout()) {
+			signature := strings.Join(table.Header, "\t")
+			i, ok := tableIndexes[signature]
+			if !ok {
+				merged = append(merged, utils.Table{
+					Header: append([]string{targetHeader}, table.Header...),
+					Rows:   [][]string{},
+				})
+				i = len(merged) - 1
+				tableIndexes[signature] = i
+			}
+			for _, row := range table.Rows {
+				merged[i].Rows = append(merged[i].Rows, append([]string{targetValue(result.TaskItem)}, row...))
+			}
+		}
+	}
+
+	for i := range merged {
+		sortTableRows(&merged[i], r.Options.MergeTableSortBy)
+		merged[i] = selectTableColumns(merged[i], r.Options.MergeTableColumns)
+	}
+
+	return merged, nil
+}
+
+// mergeTableTargetColumn returns the header and the value function of the leading target column
+func (r *Run) mergeTableTargetColumn() (string, func(t *Target) string, error) {
+	switch r.Options.MergeTableTargetColumn {
+	case "", MergeTableTargetColumnContext:
+		return "CLUSTER", func(t *Target) string { return t.Context }, nil
+	case MergeTableTargetColumnID:
+		return "TARGET", func(t *Target) string { return t.ID }, nil
+	default:
+		return "", nil, fmt.Errorf("unknown merge table target column %q, must be one of: %s, %s",
+			r.Options.MergeTableTargetColumn, MergeTableTargetColumnContext, MergeTableTargetColumnID)
+	}
+}
+
+// sortedResults returns all results sorted by target index
+func (r *Run) sortedResults() []*TaskResult {
+	results := make([]*TaskResult, 0, len(r.Results))
+	for id := range r.Results {
+		result := r.Results[id]
+		results = append(results, &result)
+	}
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].TaskItem.Index < results[j].TaskItem.Index
+	})
+	return results
+}
+
+// sortTableRows sorts rows by the given columns in order, columns not in the table are ignored,
+// the sort is stable so rows keep the target order when they are equal.
+func sortTableRows(table *utils.Table, columns []string) {
+	var indexes []int
+	for _, column := range columns {
+		if i := table.ColumnIndex(column); i >= 0 {
+			indexes = append(indexes, i)
+		}
+	}
+	if len(indexes) == 0 {
+		return
+	}
+
+	sort.SliceStable(table.Rows, func(a, b int) bool {
+		for _, i := range indexes {
+			if c := utils.CompareNatural(table.Rows[a][i], table.Rows[b][i]); c != 0 {
+				return c < 0
+			}
+		}
+		return false
+	})
+}
+
+// selectTableColumns keeps only the given columns in the given order, columns not in the table are ignored,
+// the leading target column is always kept unless it's selected explicitly at another position.
+func selectTableColumns(table utils.Table, columns []string) utils.Table {
+	if len(columns) == 0 {
+		return table
+	}
+
+	var indexes []int
+	if !containsFold(columns, table.Header[0]) {
+		indexes = append(indexes, 0)
+	}
+	for _, column := range columns {
+		if i := table.ColumnIndex(column); i >= 0 {
+			indexes = append(indexes, i)
+		}
+	}
+
+	selected := utils.Table{Header: pick(table.Header, indexes), Rows: make([][]string, 0, len(table.Rows))}
+	for _, row := range table.Rows {
+		selected.Rows = append(selected.Rows, pick(row, indexes))
+	}
+	return selected
+}
+
+func pick(row []string, indexes []int) []string {
+	picked := make([]string, 0, len(indexes))
+	for _, i := range indexes {
+		picked = append(picked, row[i])
+	}
+	return picked
+}
+
+func containsFold(items []string, s string) bool {
+	for _, item := range items {
+		if strings.EqualFold(item, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// printMergedTables prints the merged tables of all results
+func (r *Run) printMergedTables() error {
+	tables, err := r.MergeTables()
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintln(r.Out)
+	fmt.Fprintln(r.Out, utils.Style.Dim.Render("---"))
+	fmt.Fprintln(r.Out, utils.Style.Text.Render("MERGED TABLE:"))
+	if len(tables) == 0 {
+		fmt.Fprintln(r.Out, utils.Style.Dim.Render("(no table output)"))
+	}
+	for i, table := range tables {
+		if i > 0 {
+			fmt.Fprintln(r.Out)
+		}
+		fmt.Fprintln(r.Out, utils.Style.Info.Render(strings.TrimSuffix(utils.RenderTable(table.Header, table.Rows), "\n")))
+	}
+	fmt.Fprintln(r.Out, utils.Style.Dim.Render("---"))
+	return nil
+}
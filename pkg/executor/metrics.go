@@ -0,0 +1,123 @@
+package executor
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/junchaw/kubekraken/pkg/utils"
+)
+
+// MetricsContentType is the content type of the Prometheus text exposition format
+const MetricsContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// MetricsPushTimeout is the timeout for pushing metrics to the push URL
+const MetricsPushTimeout = 30 * time.Second
+
+// ToPrometheus renders the summary as metrics in the Prometheus text format, which can be read by the node-exporter textfile collector,
+// there are per-target metrics labeled with the target, and run totals.
+func (s *RunSummary) ToPrometheus(kubectlArgs []string, startedAt time.Time, duration time.Duration) string {
+	b := &strings.Builder{}
+	gauge := func(name, help string) {
+		fmt.Fprintf(b, "# HELP %s %s\n# TYPE %s gauge\n", name, help, name)
+	}
+	targetLabels := func(t *Target) string {
+		return fmt.Sprintf(`id="%s",kubeconfig="%s",context="%s"`, metricLabelValue(t.ID), metricLabelValue(t.Kubeconfig), metricLabelValue(t.Context))
+	}
+
+	gauge("kubekraken_target_success", "Whether kubectl succeeded for the target (1) or failed (0).")
+	for i := range s.results {
+		fmt.Fprintf(b, "kubekraken_target_success{%s} %d\n", targetLabels(s.results[i].TaskItem), metricBool(!s.results[i].HasErr))
+	}
+	gauge("kubekraken_target_duration_seconds", "How long kubectl ran for the target.")
+	for i := range s.results {
+		fmt.Fprintf(b, "kubekraken_target_duration_seconds{%s} %.3f\n", targetLabels(s.results[i].TaskItem), s.results[i].Duration.Seconds())
+	}
+	gauge("kubekraken_target_exit_code", "Exit code of kubectl for the target, -1 if kubectl didn't run or was killed.")
+	for i := range s.results {
+		fmt.Fprintf(b, "kubekraken_target_exit_code{%s} %d\n", targetLabels(s.results[i].TaskItem), s.results[i].ExitCode)
+	}
+	gauge("kubekraken_target_condition_matched", "Whether the output of the target matched the output condition (1) or not (0).")
+	for i := range s.results {
+		fmt.Fprintf(b, "kubekraken_target_condition_matched{%s} %d\n", targetLabels(s.results[i].TaskItem), metricBool(s.results[i].ConditionMatched))
+	}
+
+	gauge("kubekraken_run_info", "Information about the run, the value is always 1.")
+	fmt.Fprintf(b, "kubekraken_run_info{command=\"%s\"} 1\n", metricLabelValue("kubectl "+utils.ShellJoin(kubectlArgs)))
+	gauge("kubekraken_run_targets", "Number of targets in the run.")
+	fmt.Fprintf(b, "kubekraken_run_targets %d\n", s.TotalCount)
+	gauge("kubekraken_run_errors", "Number of targets with errors in the run.")
+	fmt.Fprintf(b, "kubekraken_run_errors %d\n", s.ErrorCount)
+	gauge("kubekraken_run_warnings", "Number of targets with stderr output in the run.")
+	fmt.Fprintf(b, "kubekraken_run_warnings %d\n", s.WarningCount)
+	gauge("kubekraken_run_start_timestamp_seconds", "Unix time when the run started.")
+	fmt.Fprintf(b, "kubekraken_run_start_timestamp_seconds %d\n", startedAt.Unix())
+	gauge("kubekraken_run_duration_seconds", "How long the run took.")
+	fmt.Fprintf(b, "kubekraken_run_duration_seconds %.3f\n", duration.Seconds())
+
+	return b.String()
+}
+
+func metricBool(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// metricLabelValue escapes backslashes, double quotes and line feeds in label values
+func metricLabelValue(v string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(v)
+}
+
+// writeMetrics writes the metrics file and pushes metrics to the push URL, the file is written to a temporary file first and then renamed,
+// so that the textfile collector never reads a partial file, duration is how long the run took.
+func (r *Run) writeMetrics(summary RunSummary, duration time.Duration) error {
+	content := summary.ToPrometheus(r.KubectlArgs, r.StartedAt, duration)
+
+	if r.Options.MetricsFile != "" {
+		if err := os.MkdirAll(path.Dir(r.Options.MetricsFile), 0755); err != nil {
+			return fmt.Errorf("failed to create metrics directory: %v", err)
+		}
+		tmpFile := r.Options.MetricsFile + ".tmp"
+		if err := os.WriteFile(tmpFile, []byte(content), 0644); err != nil {
+			return fmt.Errorf("failed to write metrics file: %v", err)
+		}
+		if err := os.Rename(tmpFile, r.Options.MetricsFile); err != nil {
+			return fmt.Errorf("failed to rename metrics file: %v", err)
+		}
+		fmt.Fprintf(r.Out, "%s\n", utils.Style.Success.Render(fmt.Sprintf("Metrics are saved to file %s", r.Options.MetricsFile)))
+	}
+
+	if r.Options.MetricsPushURL != "" {
+		if err := pushMetrics(r.Options.MetricsPushURL, content); err != nil {
+			return err
+		}
+		fmt.Fprintf(r.Out, "%s\n", utils.Style.Success.Render(fmt.Sprintf("Metrics are pushed to %s", r.Options.MetricsPushURL)))
+	}
+	return nil
+}
+
+// pushMetrics sends metrics with a PUT request, which replaces all metrics of the group in a Prometheus Pushgateway
+func pushMetrics(url, content string) error {
+	req, err := http.NewRequest(http.MethodPut, url, bytes.NewBufferString(content))
+	if err != nil {
+		return fmt.Errorf("failed to create metrics push request: %v", err)
+	}
+	req.Header.Set("Content-Type", MetricsContentType)
+
+	client := &http.Client{Timeout: MetricsPushTimeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to push metrics: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("failed to push metrics: unexpected status %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,104 @@
+package executor
+
+import (
+	"flag"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+)
+
+var updateGolden = flag.Bool("update", false, "update golden files in testdata")
+
+func metricsRun(t *testing.T, opts *RunOptions) (*Run, RunSummary) {
+	t.Helper()
+	opts.Args = []string{"get", "pods", "-l", `app="web"`}
+	r := NewRun(opts)
+	r.Out = io.Discard
+	r.StartedAt = time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	summary := NewRunSummary([]*TaskResult{
+		{TaskItem: &Target{ID: "kc@a", Kubeconfig: "/home/me/.kube/config", Context: "a", Index: 1}, Duration: 1234 * time.Millisecond},
+		{TaskItem: &Target{ID: "kc@b", Kubeconfig: "/home/me/.kube/config", Context: `b"\`, Index: 2}, Duration: 50 * time.Millisecond,
+			Err: "exit status 1", ExitCode: 1, HasErr: true, NeedToPrintErr: true},
+		{TaskItem: &Target{ID: "kc@c", Kubeconfig: "/home/me/.kube/config", Context: "c", Index: 3}, Duration: 2 * time.Second,
+			Stderr: "Warning: deprecated\n", HasStderr: true, NeedToPrintStderr: true, ConditionMatched: true},
+	})
+	return r, summary
+}
+
+func TestWriteMetricsFile(t *testing.T) {
+	metricsFile := path.Join(t.TempDir(), "textfile", "kubekraken.prom")
+	r, summary := metricsRun(t, &RunOptions{MetricsFile: metricsFile})
+	if err := r.writeMetrics(summary, 3500*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := os.ReadFile(metricsFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	golden := path.Join("testdata", "metrics.prom")
+	if *updateGolden {
+		if err := os.WriteFile(golden, got, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != string(want) {
+		t.Errorf("metrics file differs from %s, run with -update to update it:\n%s", golden, got)
+	}
+
+	if _, err := os.Stat(metricsFile + ".tmp"); !os.IsNotExist(err) {
+		t.Errorf("temporary metrics file is left: %v", err)
+	}
+}
+
+func TestPushMetrics(t *testing.T) {
+	var method, requestPath, contentType, body string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		content, _ := io.ReadAll(req.Body)
+		method, requestPath, contentType, body = req.Method, req.URL.Path, req.Header.Get("Content-Type"), string(content)
+	}))
+	defer server.Close()
+
+	r, summary := metricsRun(t, &RunOptions{MetricsPushURL: server.URL + "/metrics/job/kubekraken/instance/ci"})
+	if err := r.writeMetrics(summary, 3500*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+
+	if method != http.MethodPut {
+		t.Errorf("method = %s, want PUT", method)
+	}
+	if requestPath != "/metrics/job/kubekraken/instance/ci" {
+		t.Errorf("path = %s, want /metrics/job/kubekraken/instance/ci", requestPath)
+	}
+	if contentType != MetricsContentType {
+		t.Errorf("content type = %q, want %q", contentType, MetricsContentType)
+	}
+	want, err := os.ReadFile(path.Join("testdata", "metrics.prom"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body != string(want) {
+		t.Errorf("pushed body differs from the metrics file:\n%s", body)
+	}
+}
+
+func TestPushMetricsError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	err := pushMetrics(server.URL, "kubekraken_run_targets 1\n")
+	if err == nil || !strings.Contains(err.Error(), "unexpected status 400 Bad Request") {
+		t.Errorf("pushMetrics() error = %v, want unexpected status", err)
+	}
+}
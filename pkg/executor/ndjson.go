@@ -0,0 +1,40 @@
+package executor
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+const (
+	NDJSONRecordResult  = "result"
+	NDJSONRecordQuery   = "query"
+	NDJSONRecordSummary = "summary"
+)
+
+// NDJSONRecord is one line of ndjson output, a result record is written as soon as a target finishes,
+// query and summary records are written after all targets finish, the summary record is always the last line.
+type NDJSONRecord struct {
+	Type string `json:"type"`
+
+	Result  *TaskResult           `json:"result,omitempty"`
+	Query   []CombinedQueryResult `json:"query,omitempty"`
+	Summary *RunSummary           `json:"summary,omitempty"`
+}
+
+// writeNDJSONRecord writes the record to the output file as one line, full outputs are loaded from spill files,
+// the caller must hold the lock or make sure no worker is running.
+func (r *Run) writeNDJSONRecord(record NDJSONRecord) error {
+	if record.Result != nil {
+		full := record.Result.WithFullOutput()
+		record.Result = &full
+	}
+	content, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to marshal %s record to json: %v", record.Type, err)
+	}
+	// one write per line, so that a reader never sees a partial record unless the process crashes
+	if _, err := r.OutputWriter.Write(append(content, '\n')); err != nil {
+		return fmt.Errorf("failed to write %s record: %v", record.Type, err)
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+package executor
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+)
+
+func TestRunNDJSON(t *testing.T) {
+	stdout := "NAME    STATUS\n" + strings.Repeat("pod-a   Running\n", 10)
+	fakeKubectl(t, stdout)
+
+	outputFile := path.Join(t.TempDir(), "results.ndjson")
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	r := NewRun(&RunOptions{
+		Targets:        []Target{NewTarget("kc.yaml", "a"), NewTarget("kc.yaml", "b"), NewTarget("kc.yaml", "c")},
+		Args:           []string{"get", "pods"},
+		Workers:        3,
+		OutputFile:     outputFile,
+		OutputFormat:   "ndjson",
+		SpillThreshold: 32, // the output is spilled, records still have all of it
+		PrintStdout:    true,
+		Logger:         logger,
+	})
+	r.Out = io.Discard
+	if err := r.Run(); err != nil {
+		t.Fatal(err)
+	}
+
+	content, err := os.ReadFile(outputFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSuffix(string(content), "\n"), "\n")
+	if len(lines) != 4 {
+		t.Fatalf("ndjson output has %d lines, want 3 results and the summary:\n%s", len(lines), content)
+	}
+
+	ids := map[string]bool{}
+	for i, line := range lines {
+		var record NDJSONRecord
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatalf("line %d is not a json record: %v\n%s", i+1, err, line)
+		}
+		if i == len(lines)-1 {
+			if record.Type != NDJSONRecordSummary || record.Summary == nil || record.Summary.TotalCount != 3 {
+				t.Errorf("last line = %s, want the summary of 3 targets", line)
+			}
+			continue
+		}
+		if record.Type != NDJSONRecordResult || record.Result == nil {
+			t.Fatalf("line %d = %s, want a result record", i+1, line)
+		}
+		if record.Result.Stdout != stdout || record.Result.StdoutFile != "" {
+			t.Errorf("result of %s has stdout %q in %q, want the full output", record.Result.TaskItem.ID, record.Result.Stdout, record.Result.StdoutFile)
+		}
+		ids[record.Result.TaskItem.ID] = true
+	}
+	if len(ids) != 3 {
+		t.Errorf("results are of targets %v, want one record per target", ids)
+	}
+}
@@ -0,0 +1,238 @@
+package executor
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/junchaw/kubekraken/pkg/utils"
+)
+
+const (
+	NotifyTemplateGeneric = "generic"
+	NotifyTemplateSlack   = "slack"
+)
+
+const (
+	NotifyOnAlways  = "always"
+	NotifyOnFailure = "failure"
+	NotifyOnMatch   = "match"
+)
+
+// NotifyErrorSize is the max number of characters of each error in notifications
+const NotifyErrorSize = 300
+
+// NotifyTimeout is the timeout of each notification request
+const NotifyTimeout = 30 * time.Second
+
+// NotifyPayload is the payload of the generic webhook template
+type NotifyPayload struct {
+	RunID     string    `json:"runId"`
+	StartedAt time.Time `json:"startedAt"`
+	Args      []string  `json:"args"`
+
+	TotalCount   int `json:"totalCount"`
+	SuccessCount int `json:"successCount"`
+	WarningCount int `json:"warningCount"`
+	ErrorCount   int `json:"errorCount"`
+	MatchCount   int `json:"matchCount"`
+
+	FailingTargets []NotifyTarget `json:"failingTargets"`
+	MatchedTargets []NotifyTarget `json:"matchedTargets"`
+}
+
+type NotifyTarget struct {
+	ID         string `json:"id"`
+	Kubeconfig string `json:"kubeconfig"`
+	Context    string `json:"context"`
+	ExitCode   int    `json:"exitCode"`
+	Err        string `json:"err,omitempty"`
+}
+
+// NewNotifyPayload creates the notification payload of the summary, errors with the end of stderr are truncated to NotifyErrorSize
+func NewNotifyPayload(runID string, startedAt time.Time, args []string, summary *RunSummary) *NotifyPayload {
+	payload := &NotifyPayload{
+		RunID:          runID,
+		StartedAt:      startedAt,
+		Args:           args,
+		TotalCount:     summary.TotalCount,
+		SuccessCount:   summary.SuccessCount(),
+		WarningCount:   summary.WarningCount,
+		ErrorCount:     summary.ErrorCount,
+		FailingTargets: []NotifyTarget{},
+		MatchedTargets: []NotifyTarget{},
+	}
+	for _, result := range summary.Results() {
+		target := NotifyTarget{
+			ID:         result.TaskItem.ID,
+			Kubeconfig: result.TaskItem.Kubeconfig,
+			Context:    result.TaskItem.Context,
+			ExitCode:   result.ExitCode,
+		}
+		if result.HasErr {
+			// the end of stderr is kept, as kubectl prints the error after warnings
+			stderr := truncateStart(strings.TrimSpace(result.FullStderr()), NotifyErrorSize-len([]rune(result.Err))-1)
+			target.Err = truncate(strings.TrimSpace(result.Err+"\n"+stderr), NotifyErrorSize)
+			payload.FailingTargets = append(payload.FailingTargets, target)
+		} else if result.ConditionMatched {
+			payload.MatchedTargets = append(payload.MatchedTargets, target)
+		}
+	}
+	payload.MatchCount = len(payload.MatchedTargets)
+	return payload
+}
+
+// ShouldNotify returns true if the payload matches any of the notify-on options, see NotifyOn*
+func (p *NotifyPayload) ShouldNotify(notifyOn []string) bool {
+	for _, on := range notifyOn {
+		switch on {
+		case NotifyOnAlways:
+			return true
+		case NotifyOnFailure:
+			if p.ErrorCount > 0 {
+				return true
+			}
+		case NotifyOnMatch:
+			if p.MatchCount > 0 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// SlackMessage renders the payload as a Slack incoming webhook message
+func (p *NotifyPayload) SlackMessage() map[string]any {
+	lines := []string{
+		fmt.Sprintf("*kubekraken* `%s` (run %s)", utils.ShellJoin(p.Args), p.RunID),
+		fmt.Sprintf("%d successful (%d with warnings), %d error, %d total", p.SuccessCount, p.WarningCount, p.ErrorCount, p.TotalCount),
+	}
+	for _, target := range p.FailingTargets {
+		lines = append(lines, fmt.Sprintf("• :x: `%s`: %s", target.ID, strings.ReplaceAll(target.Err, "\n", " ")))
+	}
+	for _, target := range p.MatchedTargets {
+		lines = append(lines, fmt.Sprintf("• :warning: `%s`: output condition matched", target.ID))
+	}
+	return map[string]any{"text": strings.Join(lines, "\n")}
+}
+
+// WebhookNotifier posts notification payloads to a webhook URL, requests are retried on network errors, 429 and 5xx responses
+type WebhookNotifier struct {
+	URL      string
+	Template string
+	Retries  int
+
+	// Backoff is the wait before the first retry, it's doubled for each following retry
+	Backoff time.Duration
+
+	Client *http.Client
+}
+
+func NewWebhookNotifier(url, template string, retries int) *WebhookNotifier {
+	return &WebhookNotifier{
+		URL:      url,
+		Template: template,
+		Retries:  retries,
+		Backoff:  time.Second,
+		Client:   &http.Client{Timeout: NotifyTimeout},
+	}
+}
+
+func (n *WebhookNotifier) Notify(payload *NotifyPayload) error {
+	var body any
+	switch n.Template {
+	case "", NotifyTemplateGeneric:
+		body = payload
+	case NotifyTemplateSlack:
+		body = payload.SlackMessage()
+	default:
+		return fmt.Errorf("unknown notify template %q, must be one of: %s, %s", n.Template, NotifyTemplateGeneric, NotifyTemplateSlack)
+	}
+	content, err := json.Marshal(body)
+	if err != nil {
+		return fmt.Errorf("failed to marshal notification to json: %v", err)
+	}
+
+	backoff := n.Backoff
+	for attempt := 0; ; attempt++ {
+		retryable, err := n.post(content)
+		if err == nil {
+			return nil
+		}
+		if !retryable || attempt >= n.Retries {
+			return fmt.Errorf("failed to send notification after %d attempts: %v", attempt+1, err)
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// post sends the notification once, it returns whether the request can be retried if it failed
+func (n *WebhookNotifier) post(content []byte) (bool, error) {
+	resp, err := n.Client.Post(n.URL, "application/json", bytes.NewReader(content))
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 == 2 {
+		return false, nil
+	}
+	retryable := resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+	return retryable, fmt.Errorf("unexpected status %s", resp.Status)
+}
+
+// validateNotifyOptions returns an error if the template or any notify-on option is unknown
+func validateNotifyOptions(template string, notifyOn []string) error {
+	switch template {
+	case "", NotifyTemplateGeneric, NotifyTemplateSlack:
+	default:
+		return fmt.Errorf("unknown notify template %q, must be one of: %s, %s", template, NotifyTemplateGeneric, NotifyTemplateSlack)
+	}
+	for _, on := range notifyOn {
+		switch on {
+		case NotifyOnAlways, NotifyOnFailure, NotifyOnMatch:
+		default:
+			return fmt.Errorf("unknown notify-on option %q, must be one of: %s, %s, %s", on, NotifyOnAlways, NotifyOnFailure, NotifyOnMatch)
+		}
+	}
+	return nil
+}
+
+// notify sends the notification of the run if it matches the notify-on options
+func (r *Run) notify(summary *RunSummary) error {
+	payload := NewNotifyPayload(r.RunID, r.StartedAt, r.Options.Args, summary)
+	if !payload.ShouldNotify(r.Options.NotifyOn) {
+		r.Logger.Infof("notification is skipped, run doesn't match: %s", strings.Join(r.Options.NotifyOn, ", "))
+		return nil
+	}
+	notifier := NewWebhookNotifier(r.Options.NotifyWebhook, r.Options.NotifyTemplate, r.Options.NotifyRetries)
+	if err := notifier.Notify(payload); err != nil {
+		return err
+	}
+	fmt.Fprintf(r.Out, "%s\n", utils.Style.Success.Render(fmt.Sprintf("Notification is sent to %s", r.Options.NotifyWebhook)))
+	return nil
+}
+
+// truncate truncates s to n characters, with "..." at the end if it's truncated
+func truncate(s string, n int) string {
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+	return string(runes[:n-3]) + "..."
+}
+
+// truncateStart truncates s to its last n characters, with "..." at the start if it's truncated
+func truncateStart(s string, n int) string {
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+	if n <= 3 {
+		return ""
+	}
+	return "..." + string(runes[len(runes)-n+3:])
+}
@@ -0,0 +1,279 @@
+package executor
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// webhookServer records the requests to it, and responds with the statuses in order, 200 after them,
+// a status of 0 closes the connection without a response
+type webhookServer struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	statuses []int
+	bodies   []string
+	times    []time.Time
+}
+
+func newWebhookServer(t *testing.T, statuses ...int) *webhookServer {
+	t.Helper()
+	s := &webhookServer{statuses: statuses}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := io.ReadAll(req.Body)
+		if req.Method != http.MethodPost || req.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("request is %s with content type %q, want a json POST", req.Method, req.Header.Get("Content-Type"))
+		}
+
+		s.mu.Lock()
+		s.bodies = append(s.bodies, string(body))
+		s.times = append(s.times, time.Now())
+		status := http.StatusOK
+		if len(s.statuses) > 0 {
+			status, s.statuses = s.statuses[0], s.statuses[1:]
+		}
+		s.mu.Unlock()
+
+		if status == 0 {
+			conn, _, err := w.(http.Hijacker).Hijack()
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			conn.Close()
+			return
+		}
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *webhookServer) requests() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string{}, s.bodies...)
+}
+
+func notifySummary() *RunSummary {
+	summary := NewRunSummary([]*TaskResult{
+		{TaskItem: &Target{ID: "kc@a", Kubeconfig: "kc", Context: "a", Index: 1}},
+		{TaskItem: &Target{ID: "kc@b", Kubeconfig: "kc", Context: "b", Index: 2}, Err: "exit status 1", Stderr: "error: Unauthorized\n", ExitCode: 1, HasErr: true, NeedToPrintErr: true},
+		{TaskItem: &Target{ID: "kc@c", Kubeconfig: "kc", Context: "c", Index: 3}, ConditionMatched: true},
+	})
+	return &summary
+}
+
+func TestWebhookNotifierTemplates(t *testing.T) {
+	startedAt := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	payload := NewNotifyPayload("20240102-030405", startedAt, []string{"get", "pods"}, notifySummary())
+
+	t.Run("generic", func(t *testing.T) {
+		server := newWebhookServer(t)
+		if err := NewWebhookNotifier(server.URL, NotifyTemplateGeneric, 0).Notify(payload); err != nil {
+			t.Fatal(err)
+		}
+		requests := server.requests()
+		if len(requests) != 1 {
+			t.Fatalf("%d requests are sent, want 1", len(requests))
+		}
+		want := `{"runId":"20240102-030405","startedAt":"2024-01-02T03:04:05Z","args":["get","pods"],` +
+			`"totalCount":3,"successCount":2,"warningCount":0,"errorCount":1,"matchCount":1,` +
+			`"failingTargets":[{"id":"kc@b","kubeconfig":"kc","context":"b","exitCode":1,"err":"exit status 1\nerror: Unauthorized"}],` +
+			`"matchedTargets":[{"id":"kc@c","kubeconfig":"kc","context":"c","exitCode":0}]}`
+		if requests[0] != want {
+			t.Errorf("body = %s\nwant %s", requests[0], want)
+		}
+	})
+
+	t.Run("slack", func(t *testing.T) {
+		server := newWebhookServer(t)
+		if err := NewWebhookNotifier(server.URL, NotifyTemplateSlack, 0).Notify(payload); err != nil {
+			t.Fatal(err)
+		}
+		requests := server.requests()
+		if len(requests) != 1 {
+			t.Fatalf("%d requests are sent, want 1", len(requests))
+		}
+		var message map[string]string
+		if err := json.Unmarshal([]byte(requests[0]), &message); err != nil {
+			t.Fatal(err)
+		}
+		want := "*kubekraken* `get pods` (run 20240102-030405)\n" +
+			"2 successful (0 with warnings), 1 error, 3 total\n" +
+			"• :x: `kc@b`: exit status 1 error: Unauthorized\n" +
+			"• :warning: `kc@c`: output condition matched"
+		if len(message) != 1 || message["text"] != want {
+			t.Errorf("message = %q\nwant text %q", message, want)
+		}
+	})
+
+	t.Run("unknown", func(t *testing.T) {
+		server := newWebhookServer(t)
+		if err := NewWebhookNotifier(server.URL, "teams", 0).Notify(payload); err == nil || !strings.Contains(err.Error(), `unknown notify template "teams"`) {
+			t.Errorf("Notify() error = %v, want unknown template", err)
+		}
+		if len(server.requests()) != 0 {
+			t.Error("a request is sent with an unknown template")
+		}
+	})
+}
+
+func TestNotifyOn(t *testing.T) {
+	success := []*TaskResult{{TaskItem: &Target{ID: "kc@a", Index: 1}}}
+	failure := []*TaskResult{{TaskItem: &Target{ID: "kc@a", Index: 1}, Err: "exit status 1", HasErr: true, NeedToPrintErr: true}}
+	match := []*TaskResult{{TaskItem: &Target{ID: "kc@a", Index: 1}, ConditionMatched: true}}
+
+	tests := []struct {
+		name     string
+		notifyOn []string
+		results  []*TaskResult
+		want     bool
+	}{
+		{name: "always with success", notifyOn: []string{NotifyOnAlways}, results: success, want: true},
+		{name: "failure with success", notifyOn: []string{NotifyOnFailure}, results: success, want: false},
+		{name: "failure with failure", notifyOn: []string{NotifyOnFailure}, results: failure, want: true},
+		{name: "failure with match", notifyOn: []string{NotifyOnFailure}, results: match, want: false},
+		{name: "match with match", notifyOn: []string{NotifyOnMatch}, results: match, want: true},
+		{name: "match with failure", notifyOn: []string{NotifyOnMatch}, results: failure, want: false},
+		{name: "failure or match with match", notifyOn: []string{NotifyOnFailure, NotifyOnMatch}, results: match, want: true},
+		{name: "nothing", notifyOn: nil, results: failure, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newWebhookServer(t)
+			logger := logrus.New()
+			logger.SetOutput(io.Discard)
+			r := NewRun(&RunOptions{NotifyWebhook: server.URL, NotifyOn: tt.notifyOn, Logger: logger})
+			r.Out = io.Discard
+			summary := NewRunSummary(tt.results)
+			if err := r.notify(&summary); err != nil {
+				t.Fatal(err)
+			}
+			if sent := len(server.requests()) == 1; sent != tt.want {
+				t.Errorf("notification is sent: %v, want %v", sent, tt.want)
+			}
+		})
+	}
+}
+
+func TestNotifyPayloadErrorExcerpt(t *testing.T) {
+	// the error is at the end of a long spilled stderr, after the preview
+	stderr := strings.Repeat("Warning: v1 ComponentStatus is deprecated in v1.19+\n", 200) + "error: You must be logged in to the server (Unauthorized)\n"
+	stderrFile := path.Join(t.TempDir(), "a.stderr.spill")
+	if err := os.WriteFile(stderrFile, []byte(stderr), 0600); err != nil {
+		t.Fatal(err)
+	}
+	summary := NewRunSummary([]*TaskResult{{
+		TaskItem:       &Target{ID: "kc@a", Index: 1},
+		Err:            "exit status 1",
+		ExitCode:       1,
+		Stderr:         stderr[:SpillPreviewSize],
+		StderrFile:     stderrFile,
+		HasErr:         true,
+		NeedToPrintErr: true,
+	}})
+
+	payload := NewNotifyPayload("run", time.Time{}, nil, &summary)
+	excerpt := payload.FailingTargets[0].Err
+	if !strings.HasPrefix(excerpt, "exit status 1\n...") || !strings.HasSuffix(excerpt, "error: You must be logged in to the server (Unauthorized)") {
+		t.Errorf("excerpt = %q, want the error with the end of stderr", excerpt)
+	}
+	if n := len([]rune(excerpt)); n > NotifyErrorSize {
+		t.Errorf("excerpt has %d characters, want at most %d", n, NotifyErrorSize)
+	}
+}
+
+func TestRunNotifyFailureIsWarning(t *testing.T) {
+	fakeKubectl(t, "NAME   STATUS\nweb-1  Running\n")
+	server := newWebhookServer(t, http.StatusBadRequest)
+
+	logs := &bytes.Buffer{}
+	logger := logrus.New()
+	logger.SetOutput(logs)
+	r := NewRun(&RunOptions{
+		Targets:        []Target{NewTarget("kc.yaml", "a")},
+		Args:           []string{"get", "pods"},
+		Workers:        1,
+		OutputFormat:   "text",
+		NotifyWebhook:  server.URL,
+		NotifyTemplate: NotifyTemplateGeneric,
+		NotifyOn:       []string{NotifyOnAlways},
+		Logger:         logger,
+	})
+	r.Out = io.Discard
+	if err := r.Run(); err != nil {
+		t.Fatalf("Run() error = %v, want no error when only the notification fails", err)
+	}
+	if len(server.requests()) != 1 {
+		t.Errorf("%d requests are sent, want 1", len(server.requests()))
+	}
+	if !strings.Contains(logs.String(), "level=warning") || !strings.Contains(logs.String(), "failed to send notification") {
+		t.Errorf("the failed notification is not logged as a warning: %s", logs.String())
+	}
+}
+
+func TestWebhookNotifierRetries(t *testing.T) {
+	payload := NewNotifyPayload("run", time.Time{}, nil, notifySummary())
+	const backoff = 20 * time.Millisecond
+
+	tests := []struct {
+		name         string
+		statuses     []int
+		retries      int
+		wantRequests int
+		wantErr      string
+	}{
+		{name: "5xx is retried", statuses: []int{500, 503}, retries: 2, wantRequests: 3},
+		{name: "429 is retried", statuses: []int{429}, retries: 1, wantRequests: 2},
+		{name: "connection errors are retried", statuses: []int{0, 0}, retries: 3, wantRequests: 3},
+		{name: "5xx after the retries", statuses: []int{502, 502, 502}, retries: 2, wantRequests: 3, wantErr: "failed to send notification after 3 attempts: unexpected status 502 Bad Gateway"},
+		{name: "connection errors after the retries", statuses: []int{0, 0}, retries: 1, wantRequests: 2, wantErr: "failed to send notification after 2 attempts: Post"},
+		{name: "4xx is not retried", statuses: []int{400}, retries: 3, wantRequests: 1, wantErr: "failed to send notification after 1 attempts: unexpected status 400 Bad Request"},
+		{name: "no retries", statuses: []int{500}, retries: 0, wantRequests: 1, wantErr: "after 1 attempts"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newWebhookServer(t, tt.statuses...)
+			notifier := NewWebhookNotifier(server.URL, NotifyTemplateGeneric, tt.retries)
+			notifier.Backoff = backoff
+
+			err := notifier.Notify(payload)
+			if tt.wantErr == "" && err != nil {
+				t.Fatalf("Notify() error = %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Fatalf("Notify() error = %v, want %q", err, tt.wantErr)
+			}
+
+			server.mu.Lock()
+			defer server.mu.Unlock()
+			if len(server.times) != tt.wantRequests {
+				t.Fatalf("%d requests are sent, want %d", len(server.times), tt.wantRequests)
+			}
+			// the backoff is doubled for each retry
+			for i := 1; i < len(server.times); i++ {
+				want := backoff << (i - 1)
+				if gap := server.times[i].Sub(server.times[i-1]); gap < want {
+					t.Errorf("retry %d is sent %v after the previous request, want at least %v", i, gap, want)
+				}
+			}
+			for _, body := range server.bodies[1:] {
+				if body != server.bodies[0] {
+					t.Errorf("retried body %s is not the same as %s", body, server.bodies[0])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,660 @@
+package executor
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/junchaw/kubekraken/pkg/query"
+)
+
+const (
+	OutputConditionScopeStdout = "stdout"
+	OutputConditionScopeStderr = "stderr"
+	OutputConditionScopeErr    = "err"
+
+	OutputConditionOperatorContains     = "contains"
+	OutputConditionOperatorNotContains  = "not-contains"
+	OutputConditionOperatorIContains    = "icontains"
+	OutputConditionOperatorNotIContains = "not-icontains"
+	OutputConditionOperatorMatches      = "matches"
+	OutputConditionOperatorNotMatches   = "not-matches"
+	OutputConditionOperatorIMatches     = "imatches"
+	OutputConditionOperatorNotIMatches  = "not-imatches"
+	OutputConditionOperatorLines        = "lines"
+	OutputConditionOperatorExitCode     = "exit-code"
+	OutputConditionOperatorJSON         = "json"
+)
+
+// newConditionSyntaxRegex matches the syntax which is only in the new format, expressions having it are never parsed
+// in the legacy format
+var newConditionSyntaxRegex = regexp.MustCompile(`&&|\|\||[()]|\bjson:|(^|[\s,])(and|or|not)([\s,]|$)`)
+
+// OutputConditionInput is what output conditions are evaluated with
+type OutputConditionInput struct {
+	Stdout   string
+	Stderr   string
+	Err      string
+	ExitCode int
+
+	// document is stdout parsed as JSON, it's parsed on first use by json conditions
+	document       any
+	documentParsed bool
+}
+
+// Document returns stdout parsed as JSON, or nil if stdout is not valid JSON
+func (in *OutputConditionInput) Document() any {
+	if !in.documentParsed {
+		in.documentParsed = true
+		if err := json.Unmarshal([]byte(in.Stdout), &in.document); err != nil {
+			in.document = nil
+		}
+	}
+	return in.document
+}
+
+func (in *OutputConditionInput) scope(scope string) string {
+	switch scope {
+	case OutputConditionScopeStderr:
+		return in.Stderr
+	case OutputConditionScopeErr:
+		return in.Err
+	default:
+		return in.Stdout
+	}
+}
+
+// OutputCondition is a parsed output condition expression, the syntax is:
+//
+//	expr      := or
+//	or        := and { ("||" | "or") and }
+//	and       := not { ("&&" | "and" | ",") not }
+//	not       := ("!" | "not") not | "(" expr ")" | condition
+//	condition := [scope ":"] text-operator ":" value
+//	           | [scope ":"] "lines" comparison number
+//	           | "exit-code" comparison number
+//	           | "json" ":" value
+//	scope     := "stdout" | "stderr" | "err"
+//
+// Text operators are contains, not-contains, icontains, not-icontains, matches, not-matches, imatches and not-imatches,
+// values are double-quoted strings (where only \" and \\ are escapes), single-quoted raw strings,
+// or bare words ending at spaces, commas or parentheses.
+// Expressions which can't be parsed, but are in the legacy format of comma-separated contains and not-contains conditions,
+// are parsed in the legacy format, where values run to the next comma, e.g. "contains:foo bar,not-contains:baz",
+// unless they have any syntax of the new format (and, or, not, &&, ||, parentheses or json:), then the error is returned.
+//
+// The json operator evaluates a jq-like expression (see package query) with stdout parsed as JSON,
+// it matches if any output of the expression is truthy, e.g. json:'.items[].status.phase != "Running"'.
+type OutputCondition struct {
+	expr string
+	root conditionNode
+}
+
+// OutputConditionParseError is returned when an output condition can't be parsed, Pos is the byte offset of the error
+type OutputConditionParseError struct {
+	Expr string
+	Pos  int
+	Msg  string
+}
+
+func (e *OutputConditionParseError) Error() string {
+	return fmt.Sprintf("%s at position %d in %q", e.Msg, e.Pos+1, e.Expr)
+}
+
+// ParseOutputCondition parses the output condition expression
+func ParseOutputCondition(expr string) (*OutputCondition, error) {
+	p := &conditionParser{expr: expr}
+	p.skipSpaces()
+	if p.pos == len(expr) {
+		return nil, p.errorf("empty output condition")
+	}
+
+	root, err := p.parseOr()
+	if err == nil {
+		p.skipSpaces()
+		if p.pos < len(expr) {
+			err = p.errorf("unexpected %q", expr[p.pos:p.pos+1])
+		}
+	}
+	if err != nil {
+		// only expressions without any syntax of the new format fall back to the legacy one,
+		// so that mistakes in the new format are reported instead of being taken as legacy values
+		if !newConditionSyntaxRegex.MatchString(expr) {
+			if legacy, ok := parseLegacyOutputCondition(expr); ok {
+				return &OutputCondition{expr: expr, root: legacy}, nil
+			}
+		}
+		return nil, err
+	}
+
+	return &OutputCondition{expr: expr, root: root}, nil
+}
+
+// parseLegacyOutputCondition parses the legacy format "contains:foo,not-contains:bar", false is returned if it's not in the format
+func parseLegacyOutputCondition(expr string) (conditionNode, bool) {
+	var root conditionNode
+	for part := range strings.SplitSeq(expr, ",") {
+		operator, value, ok := strings.Cut(part, ":")
+		if !ok || (operator != OutputConditionOperatorContains && operator != OutputConditionOperatorNotContains) {
+			return nil, false
+		}
+		var condition conditionNode = &textCondition{
+			scope:  OutputConditionScopeStdout,
+			value:  value,
+			negate: operator == OutputConditionOperatorNotContains,
+		}
+		if root != nil {
+			condition = &andCondition{left: root, right: condition}
+		}
+		root = condition
+	}
+	return root, true
+}
+
+// String returns the original expression
+func (c *OutputCondition) String() string {
+	return c.expr
+}
+
+// Match evaluates the output condition with the input
+func (c *OutputCondition) Match(in *OutputConditionInput) bool {
+	return c.root.match(in)
+}
+
+// UsesJSON returns true if there is any json condition, which requires kubectl to output JSON
+func (c *OutputCondition) UsesJSON() bool {
+	return c.hasJSONNode(c.root)
+}
+
+func (c *OutputCondition) hasJSONNode(n conditionNode) bool {
+	switch n := n.(type) {
+	case *jsonCondition:
+		return true
+	case *andCondition:
+		return c.hasJSONNode(n.left) || c.hasJSONNode(n.right)
+	case *orCondition:
+		return c.hasJSONNode(n.left) || c.hasJSONNode(n.right)
+	case *notCondition:
+		return c.hasJSONNode(n.body)
+	}
+	return false
+}
+
+// FilterItems filters items of a List output (e.g. kubectl get pods -o json) down to the items matching any json condition
+// which decided the match, so that only the offending resources are shown, the filtered output is returned with true if there is anything to filter.
+// Outputs matched by other conditions, e.g. the text branch of an or, are not filtered.
+// Each item is tested with a copy of the List which only contains that item, so expressions like .items[].status.phase work.
+func (c *OutputCondition) FilterItems(in *OutputConditionInput) (string, bool) {
+	conditions := decidingJSONConditions(c.root, in)
+	if len(conditions) == 0 {
+		return "", false
+	}
+	list, ok := in.Document().(map[string]any)
+	if !ok {
+		return "", false
+	}
+	items, ok := list["items"].([]any)
+	if !ok {
+		return "", false
+	}
+
+	filtered := []any{}
+	for _, item := range items {
+		single := make(map[string]any, len(list))
+		for k, v := range list {
+			single[k] = v
+		}
+		single["items"] = []any{item}
+		for _, condition := range conditions {
+			if condition.matchDocument(single) {
+				filtered = append(filtered, item)
+				break
+			}
+		}
+	}
+
+	list["items"] = filtered
+	content, err := json.MarshalIndent(list, "", "    ") // the same indent as kubectl
+	list["items"] = items
+	if err != nil {
+		return "", false
+	}
+	return string(content) + "\n", true
+}
+
+// decidingJSONConditions returns the json conditions which make the node match, evaluated like match,
+// so the right side of an or is not used if the left side matches, and negated json conditions are never used
+func decidingJSONConditions(n conditionNode, in *OutputConditionInput) []*jsonCondition {
+	switch n := n.(type) {
+	case *jsonCondition:
+		if n.match(in) {
+			return []*jsonCondition{n}
+		}
+	case *andCondition:
+		if n.match(in) {
+			return append(decidingJSONConditions(n.left, in), decidingJSONConditions(n.right, in)...)
+		}
+	case *orCondition:
+		if n.left.match(in) {
+			return decidingJSONConditions(n.left, in)
+		}
+		return decidingJSONConditions(n.right, in)
+	}
+	return nil
+}
+
+type conditionNode interface {
+	match(in *OutputConditionInput) bool
+}
+
+type andCondition struct {
+	left, right conditionNode
+}
+
+func (c *andCondition) match(in *OutputConditionInput) bool {
+	return c.left.match(in) && c.right.match(in)
+}
+
+type orCondition struct {
+	left, right conditionNode
+}
+
+func (c *orCondition) match(in *OutputConditionInput) bool {
+	return c.left.match(in) || c.right.match(in)
+}
+
+type notCondition struct {
+	body conditionNode
+}
+
+func (c *notCondition) match(in *OutputConditionInput) bool {
+	return !c.body.match(in)
+}
+
+type textCondition struct {
+	scope  string
+	value  string
+	re     *regexp.Regexp // set for regex operators
+	fold   bool           // case-insensitive contains
+	negate bool
+}
+
+func (c *textCondition) match(in *OutputConditionInput) bool {
+	text := in.scope(c.scope)
+	var matched bool
+	switch {
+	case c.re != nil:
+		matched = c.re.MatchString(text)
+	case c.fold:
+		matched = strings.Contains(strings.ToLower(text), strings.ToLower(c.value))
+	default:
+		matched = strings.Contains(text, c.value)
+	}
+	return matched != c.negate
+}
+
+type jsonCondition struct {
+	query *query.Query
+}
+
+func (c *jsonCondition) match(in *OutputConditionInput) bool {
+	return c.matchDocument(in.Document())
+}
+
+func (c *jsonCondition) matchDocument(document any) bool {
+	if document == nil {
+		return false
+	}
+	outputs, err := c.query.Run(document)
+	if err != nil {
+		return false
+	}
+	for _, output := range outputs {
+		if output != nil && output != false {
+			return true
+		}
+	}
+	return false
+}
+
+type comparisonCondition struct {
+	value      func(in *OutputConditionInput) int
+	comparison string
+	n          int
+}
+
+func (c *comparisonCondition) match(in *OutputConditionInput) bool {
+	v := c.value(in)
+	switch c.comparison {
+	case "==":
+		return v == c.n
+	case "!=":
+		return v != c.n
+	case "<":
+		return v < c.n
+	case "<=":
+		return v <= c.n
+	case ">":
+		return v > c.n
+	default:
+		return v >= c.n
+	}
+}
+
+// countLines returns the number of non-empty lines
+func countLines(text string) int {
+	count := 0
+	for line := range strings.SplitSeq(text, "\n") {
+		if strings.TrimSpace(line) != "" {
+			count++
+		}
+	}
+	return count
+}
+
+type conditionParser struct {
+	expr string
+	pos  int
+}
+
+func (p *conditionParser) errorf(format string, args ...any) error {
+	return &OutputConditionParseError{Expr: p.expr, Pos: p.pos, Msg: fmt.Sprintf(format, args...)}
+}
+
+func (p *conditionParser) skipSpaces() {
+	for p.pos < len(p.expr) && (p.expr[p.pos] == ' ' || p.expr[p.pos] == '\t' || p.expr[p.pos] == '\n') {
+		p.pos++
+	}
+}
+
+func (p *conditionParser) consume(s string) bool {
+	if strings.HasPrefix(p.expr[p.pos:], s) {
+		p.pos += len(s)
+		return true
+	}
+	return false
+}
+
+// peekWord returns the word at the current position, words contain letters, digits and dashes
+func (p *conditionParser) peekWord() string {
+	end := p.pos
+	for end < len(p.expr) {
+		c := p.expr[end]
+		if c != '-' && c != '_' && (c < 'a' || c > 'z') && (c < 'A' || c > 'Z') && (c < '0' || c > '9') {
+			break
+		}
+		end++
+	}
+	return p.expr[p.pos:end]
+}
+
+// consumeKeyword consumes the keyword if it's at the current position as a whole word
+func (p *conditionParser) consumeKeyword(keyword string) bool {
+	if p.peekWord() != keyword {
+		return false
+	}
+	p.pos += len(keyword)
+	return true
+}
+
+func (p *conditionParser) parseOr() (conditionNode, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		p.skipSpaces()
+		if !p.consume("||") && !p.consumeKeyword("or") {
+			return left, nil
+		}
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &orCondition{left: left, right: right}
+	}
+}
+
+func (p *conditionParser) parseAnd() (conditionNode, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		p.skipSpaces()
+		if !p.consume("&&") && !p.consume(",") && !p.consumeKeyword("and") {
+			return left, nil
+		}
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = &andCondition{left: left, right: right}
+	}
+}
+
+func (p *conditionParser) parseNot() (conditionNode, error) {
+	p.skipSpaces()
+	if (strings.HasPrefix(p.expr[p.pos:], "!") && !strings.HasPrefix(p.expr[p.pos:], "!=")) || p.peekWord() == "not" {
+		if !p.consume("!") {
+			p.consumeKeyword("not")
+		}
+		body, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return &notCondition{body: body}, nil
+	}
+
+	if p.consume("(") {
+		body, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		p.skipSpaces()
+		if !p.consume(")") {
+			return nil, p.errorf("expected \")\"")
+		}
+		return body, nil
+	}
+
+	return p.parseCondition()
+}
+
+func (p *conditionParser) parseCondition() (conditionNode, error) {
+	start := p.pos
+	name := p.peekWord()
+	if name == "" {
+		if p.pos == len(p.expr) {
+			return nil, p.errorf("expected condition, got end of expression")
+		}
+		return nil, p.errorf("expected condition, got %q", p.expr[p.pos:p.pos+1])
+	}
+	p.pos += len(name)
+
+	if name == OutputConditionOperatorExitCode {
+		return p.parseComparison(func(in *OutputConditionInput) int { return in.ExitCode })
+	}
+
+	if name == OutputConditionOperatorJSON {
+		return p.parseJSONCondition()
+	}
+
+	scope := OutputConditionScopeStdout
+	if name == OutputConditionScopeStdout || name == OutputConditionScopeStderr || name == OutputConditionScopeErr {
+		if !p.consume(":") {
+			return nil, p.errorf("expected \":\" after scope %q", name)
+		}
+		scope = name
+		start = p.pos
+		name = p.peekWord()
+		p.pos += len(name)
+	}
+
+	if name == OutputConditionOperatorLines {
+		return p.parseComparison(func(in *OutputConditionInput) int { return countLines(in.scope(scope)) })
+	}
+
+	condition := &textCondition{scope: scope}
+	switch name {
+	case "":
+		return nil, p.errorf("expected operator")
+	case OutputConditionOperatorContains:
+	case OutputConditionOperatorNotContains:
+		condition.negate = true
+	case OutputConditionOperatorIContains:
+		condition.fold = true
+	case OutputConditionOperatorNotIContains:
+		condition.fold, condition.negate = true, true
+	case OutputConditionOperatorMatches, OutputConditionOperatorIMatches, OutputConditionOperatorNotMatches, OutputConditionOperatorNotIMatches:
+		condition.negate = strings.HasPrefix(name, "not-")
+	default:
+		p.pos = start
+		return nil, p.errorf("unknown operator %q", name)
+	}
+
+	if !p.consume(":") {
+		return nil, p.errorf("expected \":\" after operator %q", name)
+	}
+	valuePos := p.pos
+	value, err := p.parseValue()
+	if err != nil {
+		return nil, err
+	}
+	condition.value = value
+
+	if strings.HasSuffix(name, "matches") {
+		pattern := value
+		if strings.HasSuffix(name, "imatches") {
+			pattern = "(?i)" + pattern
+		}
+		re, err := regexp.Compile("(?m)" + pattern)
+		if err != nil {
+			p.pos = valuePos
+			return nil, p.errorf("invalid regex %q: %v", value, err)
+		}
+		condition.re = re
+	}
+
+	return condition, nil
+}
+
+// parseJSONCondition parses the query of a json condition, the operator is already consumed
+func (p *conditionParser) parseJSONCondition() (conditionNode, error) {
+	if !p.consume(":") {
+		return nil, p.errorf("expected \":\" after operator %q", OutputConditionOperatorJSON)
+	}
+	valuePos := p.pos
+	value, err := p.parseValue()
+	if err != nil {
+		return nil, err
+	}
+
+	q, err := query.Parse(value)
+	if err != nil {
+		var parseErr *query.ParseError
+		if errors.As(err, &parseErr) {
+			p.pos = p.valueOffset(valuePos, parseErr.Pos)
+			return nil, p.errorf("invalid json condition: %s", parseErr.Msg)
+		}
+		return nil, err
+	}
+
+	return &jsonCondition{query: q}, nil
+}
+
+// parseComparison parses a comparison operator and an integer
+func (p *conditionParser) parseComparison(value func(in *OutputConditionInput) int) (conditionNode, error) {
+	p.skipSpaces()
+	comparison := ""
+	for _, op := range []string{"==", "!=", "<=", ">=", "<", ">"} {
+		if p.consume(op) {
+			comparison = op
+			break
+		}
+	}
+	if comparison == "" {
+		return nil, p.errorf("expected comparison operator (==, !=, <, <=, >, >=)")
+	}
+
+	p.skipSpaces()
+	start := p.pos
+	if p.pos < len(p.expr) && p.expr[p.pos] == '-' {
+		p.pos++
+	}
+	for p.pos < len(p.expr) && p.expr[p.pos] >= '0' && p.expr[p.pos] <= '9' {
+		p.pos++
+	}
+	n, err := strconv.Atoi(p.expr[start:p.pos])
+	if err != nil {
+		p.pos = start
+		return nil, p.errorf("expected integer")
+	}
+
+	return &comparisonCondition{value: value, comparison: comparison, n: n}, nil
+}
+
+// valueOffset returns the offset in the expression of the byte at pos of the value which starts at start,
+// escapes of double-quoted strings are skipped, as the value is shorter than its source
+func (p *conditionParser) valueOffset(start, pos int) int {
+	switch p.expr[start] {
+	case '\'':
+		return start + 1 + pos
+	case '"':
+		i := start + 1
+		for n := 0; n < pos && i < len(p.expr); n++ {
+			if p.expr[i] == '\\' && i+1 < len(p.expr) && (p.expr[i+1] == '"' || p.expr[i+1] == '\\') {
+				i++
+			}
+			i++
+		}
+		return i
+	}
+	return start + pos
+}
+
+// parseValue parses a double-quoted string, a single-quoted raw string, or a bare word
+func (p *conditionParser) parseValue() (string, error) {
+	start := p.pos
+	if p.pos == len(p.expr) {
+		return "", p.errorf("expected value, got end of expression")
+	}
+
+	switch p.expr[p.pos] {
+	case '"':
+		// only \" and \\ are escapes, other backslashes are kept so that regexes like "\d+" can be written as is
+		value := strings.Builder{}
+		for end := p.pos + 1; end < len(p.expr); end++ {
+			c := p.expr[end]
+			switch {
+			case c == '\\' && end+1 < len(p.expr) && (p.expr[end+1] == '"' || p.expr[end+1] == '\\'):
+				value.WriteByte(p.expr[end+1])
+				end++
+			case c == '"':
+				p.pos = end + 1
+				return value.String(), nil
+			default:
+				value.WriteByte(c)
+			}
+		}
+		return "", p.errorf("unterminated string")
+	case '\'':
+		end := strings.IndexByte(p.expr[p.pos+1:], '\'')
+		if end == -1 {
+			return "", p.errorf("unterminated string")
+		}
+		p.pos += end + 2
+		return p.expr[start+1 : p.pos-1], nil
+	}
+
+	for p.pos < len(p.expr) && !strings.ContainsRune(" \t\n,()", rune(p.expr[p.pos])) {
+		p.pos++
+	}
+	if p.pos == start {
+		return "", p.errorf("expected value")
+	}
+	return p.expr[start:p.pos], nil
+}
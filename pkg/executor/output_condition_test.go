@@ -0,0 +1,268 @@
+package executor
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestOutputConditionMatch(t *testing.T) {
+	in := &OutputConditionInput{
+		Stdout:   "NAME   STATUS\nweb-1  Running\ndns-1  CrashLoopBackOff\n",
+		Stderr:   "Warning: v1beta1 is deprecated\n",
+		Err:      "",
+		ExitCode: 0,
+	}
+	failed := &OutputConditionInput{
+		Stderr:   "error: You must be logged in to the server (Unauthorized)\n",
+		Err:      "exit status 1",
+		ExitCode: 1,
+	}
+
+	tests := []struct {
+		expr string
+		in   *OutputConditionInput
+		want bool
+	}{
+		// text operators
+		{expr: "contains:CrashLoopBackOff", in: in, want: true},
+		{expr: "contains:crashloopbackoff", in: in, want: false},
+		{expr: "not-contains:CrashLoopBackOff", in: in, want: false},
+		{expr: "not-contains:Pending", in: in, want: true},
+		{expr: "icontains:crashloopbackoff", in: in, want: true},
+		{expr: "not-icontains:crashloopbackoff", in: in, want: false},
+		{expr: `matches:"^dns-\d+ "`, in: in, want: true},
+		{expr: `matches:"^\d+"`, in: in, want: false},
+		{expr: "not-matches:Running$", in: in, want: false},
+		{expr: "imatches:'^DNS-1'", in: in, want: true},
+		{expr: "not-imatches:'^DNS-1'", in: in, want: false},
+
+		// scopes
+		{expr: "stderr:contains:deprecated", in: in, want: true},
+		{expr: "stdout:contains:deprecated", in: in, want: false},
+		{expr: "err:contains:'exit status'", in: failed, want: true},
+		{expr: "stderr:icontains:UNAUTHORIZED", in: failed, want: true},
+
+		// comparisons
+		{expr: "lines > 2", in: in, want: true},
+		{expr: "lines == 3", in: in, want: true},
+		{expr: "lines<3", in: in, want: false},
+		{expr: "stderr:lines <= 1", in: in, want: true},
+		{expr: "exit-code != 0", in: failed, want: true},
+		{expr: "exit-code >= 2", in: failed, want: false},
+		{expr: "exit-code == -1", in: failed, want: false},
+
+		// and, or, not and parentheses
+		{expr: "contains:web-1 && contains:dns-1", in: in, want: true},
+		{expr: "contains:web-1 and contains:Pending", in: in, want: false},
+		{expr: "contains:web-1,contains:Pending", in: in, want: false},
+		{expr: "contains:Pending || contains:dns-1", in: in, want: true},
+		{expr: "contains:Pending or contains:Failed", in: in, want: false},
+		{expr: "!contains:Pending", in: in, want: true},
+		{expr: "not contains:Running", in: in, want: false},
+		{expr: "not not contains:Running", in: in, want: true},
+		{expr: "contains:Pending && contains:web-1 || contains:dns-1", in: in, want: true},
+		{expr: "contains:Pending && (contains:web-1 || contains:dns-1)", in: in, want: false},
+		{expr: "!(contains:Pending || exit-code != 0)", in: in, want: true},
+		{expr: "(contains:Running && not stderr:contains:timeout) || exit-code != 0", in: in, want: true},
+		{expr: "( ( contains:Running ) )", in: in, want: true},
+
+		// legacy format, values run to the next comma
+		{expr: "contains:dns-1  CrashLoop", in: in, want: true},
+		{expr: "contains:web-1  Running,not-contains:Pending", in: in, want: true},
+		{expr: "contains:web-1  Running,not-contains:dns-1  Crash", in: in, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			c, err := ParseOutputCondition(tt.expr)
+			if err != nil {
+				t.Fatalf("ParseOutputCondition() error = %v", err)
+			}
+			if got := c.Match(tt.in); got != tt.want {
+				t.Errorf("Match() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOutputConditionMatchJSON(t *testing.T) {
+	in := &OutputConditionInput{
+		Stdout: `{"kind":"List","items":[{"metadata":{"name":"a"},"status":{"phase":"Running"}},{"metadata":{"name":"b"},"status":{"phase":"Pending"}}]}`,
+	}
+	tests := []struct {
+		expr string
+		want bool
+	}{
+		{expr: `json:'.items[].status.phase == "Pending"'`, want: true},
+		{expr: `json:'.items[].status.phase == "Failed"'`, want: false},
+		{expr: `json:".items | length > 1"`, want: true},
+		{expr: `not json:'.items[].status.phase == "Failed"'`, want: true},
+		{expr: `json:.kind`, want: true},
+		{expr: `json:.missing`, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			c, err := ParseOutputCondition(tt.expr)
+			if err != nil {
+				t.Fatalf("ParseOutputCondition() error = %v", err)
+			}
+			if got := c.Match(in); got != tt.want {
+				t.Errorf("Match() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	c, err := ParseOutputCondition(`json:.kind`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Match(&OutputConditionInput{Stdout: "not json"}) {
+		t.Error("json condition matches output which is not JSON")
+	}
+}
+
+func TestParseOutputConditionErrors(t *testing.T) {
+	tests := []struct {
+		expr    string
+		wantPos int
+		wantMsg string
+	}{
+		{expr: "", wantPos: 0, wantMsg: "empty output condition"},
+		{expr: "   ", wantPos: 3, wantMsg: "empty output condition"},
+		{expr: "foo:bar", wantPos: 0, wantMsg: `unknown operator "foo"`},
+		{expr: "stderr:foo:bar", wantPos: 7, wantMsg: `unknown operator "foo"`},
+		{expr: "stderr contains:x", wantPos: 6, wantMsg: `expected ":" after scope "stderr"`},
+		{expr: "icontains x", wantPos: 9, wantMsg: `expected ":" after operator "icontains"`},
+		{expr: "icontains:", wantPos: 10, wantMsg: "expected value, got end of expression"},
+		{expr: `icontains:"abc`, wantPos: 10, wantMsg: "unterminated string"},
+		{expr: "icontains:'abc", wantPos: 10, wantMsg: "unterminated string"},
+		{expr: "matches:'[a-'", wantPos: 8, wantMsg: "invalid regex \"[a-\": error parsing regexp: missing closing ]: `[a-`"},
+		{expr: "(icontains:a", wantPos: 12, wantMsg: `expected ")"`},
+		{expr: "icontains:a)", wantPos: 11, wantMsg: `unexpected ")"`},
+		{expr: "icontains:a &&", wantPos: 14, wantMsg: "expected condition, got end of expression"},
+		{expr: "icontains:a || )", wantPos: 15, wantMsg: `expected condition, got ")"`},
+		{expr: "lines 3", wantPos: 6, wantMsg: "expected comparison operator (==, !=, <, <=, >, >=)"},
+		{expr: "exit-code == x", wantPos: 13, wantMsg: "expected integer"},
+		{expr: "json .items", wantPos: 4, wantMsg: `expected ":" after operator "json"`},
+		{expr: "json:'.items[' || exit-code != 0", wantPos: 13, wantMsg: "invalid json condition: unexpected token, got end of expression"},
+		{expr: `json:".name == \"web\" and ]"`, wantPos: 27, wantMsg: `invalid json condition: unexpected token, got "]"`},
+		{expr: `json:".name == \\ ]"`, wantPos: 15, wantMsg: `invalid json condition: unexpected character '\\'`},
+
+		// expressions with syntax of the new format don't fall back to the legacy format
+		{expr: "contains:(Running)", wantPos: 9, wantMsg: "expected value"},
+		{expr: "contains:Running ||", wantPos: 19, wantMsg: "expected condition, got end of expression"},
+		{expr: "contains:Running or Pending", wantPos: 20, wantMsg: `unknown operator "Pending"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			_, err := ParseOutputCondition(tt.expr)
+			var parseErr *OutputConditionParseError
+			if !errors.As(err, &parseErr) {
+				t.Fatalf("ParseOutputCondition() error = %v, want an OutputConditionParseError", err)
+			}
+			if parseErr.Pos != tt.wantPos || parseErr.Msg != tt.wantMsg {
+				t.Errorf("ParseOutputCondition() error at %d %q, want at %d %q", parseErr.Pos, parseErr.Msg, tt.wantPos, tt.wantMsg)
+			}
+		})
+	}
+}
+
+func TestOutputConditionFilterItems(t *testing.T) {
+	stdout := `{"apiVersion":"v1","kind":"List","items":[` +
+		`{"metadata":{"name":"a"},"status":{"phase":"Running"}},` +
+		`{"metadata":{"name":"b"},"status":{"phase":"Pending"}},` +
+		`{"metadata":{"name":"c"},"status":{"phase":"Failed"}}]}`
+
+	tests := []struct {
+		name      string
+		expr      string
+		stderr    string
+		wantNames []string // nil if the output is not filtered
+	}{
+		{
+			name:      "json condition",
+			expr:      `json:'.items[].status.phase == "Pending"'`,
+			wantNames: []string{"b"},
+		},
+		{
+			name:      "any of the json conditions",
+			expr:      `json:'.items[].status.phase == "Pending"' || json:'.items[].status.phase == "Failed"'`,
+			wantNames: []string{"b"},
+		},
+		{
+			name:      "and of json conditions",
+			expr:      `json:'.items[].status.phase == "Pending"' && json:'.items[].status.phase == "Failed"'`,
+			wantNames: []string{"b", "c"},
+		},
+		{
+			name:      "json condition and text condition",
+			expr:      `stderr:contains:deprecated && json:'.items[].status.phase != "Running"'`,
+			stderr:    "Warning: deprecated\n",
+			wantNames: []string{"b", "c"},
+		},
+		{
+			name:   "text branch of or decides",
+			expr:   `stderr:contains:deprecated || json:'.items[].status.phase == "Pending"'`,
+			stderr: "Warning: deprecated\n",
+		},
+		{
+			name:      "json branch of or decides",
+			expr:      `stderr:contains:deprecated || json:'.items[].status.phase == "Pending"'`,
+			wantNames: []string{"b"},
+		},
+		{
+			name: "negated json condition",
+			expr: `not json:'.items[].status.phase == "Unknown"'`,
+		},
+		{
+			name: "no json condition",
+			expr: "contains:Pending",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := ParseOutputCondition(tt.expr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			in := &OutputConditionInput{Stdout: stdout, Stderr: tt.stderr}
+			if !c.Match(in) {
+				t.Fatal("Match() = false, want true")
+			}
+
+			filtered, ok := c.FilterItems(in)
+			if tt.wantNames == nil {
+				if ok {
+					t.Errorf("FilterItems() filtered the output: %s", filtered)
+				}
+				return
+			}
+			if !ok {
+				t.Fatal("FilterItems() did not filter the output")
+			}
+			var list struct {
+				Kind  string `json:"kind"`
+				Items []struct {
+					Metadata struct {
+						Name string `json:"name"`
+					} `json:"metadata"`
+				} `json:"items"`
+			}
+			if err := json.Unmarshal([]byte(filtered), &list); err != nil {
+				t.Fatal(err)
+			}
+			var names []string
+			for _, item := range list.Items {
+				names = append(names, item.Metadata.Name)
+			}
+			if list.Kind != "List" || len(names) != len(tt.wantNames) {
+				t.Fatalf("FilterItems() kept %s %v, want List %v", list.Kind, names, tt.wantNames)
+			}
+			for i := range names {
+				if names[i] != tt.wantNames[i] {
+					t.Errorf("FilterItems() kept %v, want %v", names, tt.wantNames)
+				}
+			}
+		})
+	}
+}
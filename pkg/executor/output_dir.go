@@ -0,0 +1,69 @@
+package executor
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+)
+
+// OutputDirMarker is the marker file in output directories created by kubekraken,
+// only directories with the marker can be cleaned, so that a wrong --output-dir never deletes other files
+const OutputDirMarker = ".kubekraken"
+
+// OutputDirLatest is the symlink in the output directory to the directory of the latest run
+const OutputDirLatest = "latest"
+
+// prepareOutputDir creates the directory for the results of this run and returns it,
+// by default it's a subdirectory named after the run ID, and the "latest" symlink is updated to point to it,
+// with clean, the output directory itself is emptied and used, which is only allowed if kubekraken created it.
+func (r *Run) prepareOutputDir() (string, error) {
+	dir := r.Options.OutputDir
+	entries, err := os.ReadDir(dir)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return "", fmt.Errorf("failed to read output directory: %v", err)
+	}
+	owned := len(entries) == 0 // nothing to lose in a missing or empty directory
+	if _, err := os.Stat(path.Join(dir, OutputDirMarker)); err == nil {
+		owned = true
+	}
+
+	if r.Options.CleanOutputDir {
+		if !owned {
+			return "", fmt.Errorf("refusing to clean output directory %s, it was not created by kubekraken (no %s file in it)", dir, OutputDirMarker)
+		}
+		if err := os.RemoveAll(dir); err != nil {
+			return "", fmt.Errorf("failed to remove output directory: %v", err)
+		}
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create output directory: %v", err)
+	}
+	// an existing directory with other files is used as is, but it's not marked, so that it can never be cleaned
+	if owned {
+		if err := os.WriteFile(path.Join(dir, OutputDirMarker), []byte("This directory is created by kubekraken.\n"), 0644); err != nil {
+			return "", fmt.Errorf("failed to create output directory marker: %v", err)
+		}
+	}
+	if r.Options.CleanOutputDir {
+		return dir, nil
+	}
+
+	runDir := path.Join(dir, r.RunID)
+	if err := os.Mkdir(runDir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create run directory: %v", err)
+	}
+
+	// the symlink is replaced with a rename, so that it always exists for readers
+	latest := path.Join(dir, OutputDirLatest)
+	tmpLatest := latest + "." + r.RunID
+	if err := os.Symlink(r.RunID, tmpLatest); err != nil {
+		return "", fmt.Errorf("failed to create latest symlink: %v", err)
+	}
+	if err := os.Rename(tmpLatest, latest); err != nil {
+		os.Remove(tmpLatest)
+		return "", fmt.Errorf("failed to update latest symlink: %v", err)
+	}
+	return runDir, nil
+}
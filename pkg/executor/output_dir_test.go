@@ -0,0 +1,125 @@
+package executor
+
+import (
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+func outputDirRun(dir, runID string, clean bool) *Run {
+	r := NewRun(&RunOptions{OutputDir: dir, CleanOutputDir: clean})
+	r.RunID = runID
+	return r
+}
+
+func TestPrepareOutputDirRefusesToCleanUnownedDir(t *testing.T) {
+	dir := t.TempDir()
+	precious := path.Join(dir, "precious.txt")
+	if err := os.WriteFile(precious, []byte("keep me"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := outputDirRun(dir, "20240102-030405", true).prepareOutputDir()
+	if err == nil || !strings.Contains(err.Error(), "refusing to clean output directory") {
+		t.Fatalf("prepareOutputDir() error = %v, want a refusal", err)
+	}
+	if _, err := os.Stat(precious); err != nil {
+		t.Errorf("file in the unowned directory is removed: %v", err)
+	}
+
+	// without clean, the directory is used, but it's not marked, so that it can never be cleaned later
+	runDir, err := outputDirRun(dir, "20240102-030405", false).prepareOutputDir()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if runDir != path.Join(dir, "20240102-030405") {
+		t.Errorf("prepareOutputDir() = %s, want the run directory", runDir)
+	}
+	if _, err := os.Stat(path.Join(dir, OutputDirMarker)); !os.IsNotExist(err) {
+		t.Errorf("unowned directory is marked: %v", err)
+	}
+	if _, err := outputDirRun(dir, "20240102-030406", true).prepareOutputDir(); err == nil {
+		t.Error("prepareOutputDir() cleaned an unowned directory after it was used")
+	}
+}
+
+func TestPrepareOutputDirCleansOwnedDir(t *testing.T) {
+	dir := path.Join(t.TempDir(), "out")
+	if _, err := outputDirRun(dir, "20240102-030405", false).prepareOutputDir(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path.Join(dir, OutputDirMarker)); err != nil {
+		t.Fatalf("created directory is not marked: %v", err)
+	}
+
+	got, err := outputDirRun(dir, "20240102-030406", true).prepareOutputDir()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != dir {
+		t.Errorf("prepareOutputDir() = %s, want the output directory %s", got, dir)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Name() != OutputDirMarker {
+		var names []string
+		for _, entry := range entries {
+			names = append(names, entry.Name())
+		}
+		t.Errorf("cleaned directory has %v, want only the marker", names)
+	}
+}
+
+func TestPrepareOutputDirAdoptsEmptyDir(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := outputDirRun(dir, "20240102-030405", false).prepareOutputDir(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path.Join(dir, OutputDirMarker)); err != nil {
+		t.Errorf("empty directory is not marked: %v", err)
+	}
+	if _, err := outputDirRun(dir, "20240102-030406", true).prepareOutputDir(); err != nil {
+		t.Errorf("adopted directory can't be cleaned: %v", err)
+	}
+}
+
+func TestPrepareOutputDirUpdatesLatest(t *testing.T) {
+	dir := t.TempDir()
+	for _, runID := range []string{"20240102-030405", "20240102-030406"} {
+		runDir, err := outputDirRun(dir, runID, false).prepareOutputDir()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if runDir != path.Join(dir, runID) {
+			t.Errorf("prepareOutputDir() = %s, want %s", runDir, path.Join(dir, runID))
+		}
+		if info, err := os.Stat(runDir); err != nil || !info.IsDir() {
+			t.Errorf("run directory %s is not created: %v", runDir, err)
+		}
+
+		target, err := os.Readlink(path.Join(dir, OutputDirLatest))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if target != runID {
+			t.Errorf("latest points to %s, want %s", target, runID)
+		}
+	}
+
+	// the previous run is kept, and no temporary symlink is left
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	want := []string{OutputDirMarker, "20240102-030405", "20240102-030406", OutputDirLatest}
+	if strings.Join(names, ",") != strings.Join(want, ",") {
+		t.Errorf("output directory has %v, want %v", names, want)
+	}
+}
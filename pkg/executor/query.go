@@ -0,0 +1,90 @@
+package executor
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/junchaw/kubekraken/pkg/utils"
+)
+
+// CombinedQueryResult is one output of the query for a target, outputs of all targets are combined into one array
+type CombinedQueryResult struct {
+	Target string `json:"target" yaml:"target"`
+	Result any    `json:"result" yaml:"result"`
+}
+
+// needsJSONOutput returns true if kubectl must be run with -o json
+func (r *Run) needsJSONOutput() bool {
+	return r.Options.Query != nil || r.Options.Aggregate != nil || (r.Options.OutputCondition != nil && r.Options.OutputCondition.UsesJSON())
+}
+
+// ensureJSONOutput appends "-o json" to kubectl args if there is no output flag,
+// an error is returned if there is an output flag with another format.
+func ensureJSONOutput(args []string) ([]string, error) {
+	for i, arg := range args {
+		if arg == "--" {
+			break
+		}
+		format := ""
+		switch {
+		case arg == "-o" || arg == "--output":
+			if i+1 < len(args) {
+				format = args[i+1]
+			}
+		case strings.HasPrefix(arg, "-o="), strings.HasPrefix(arg, "--output="):
+			format = arg[strings.Index(arg, "=")+1:]
+		case strings.HasPrefix(arg, "-o") && len(arg) > 2:
+			format = arg[2:]
+		default:
+			continue
+		}
+		if format != "json" {
+			return nil, fmt.Errorf("kubectl output format must be json to evaluate queries, aggregates and json conditions, got %q", format)
+		}
+		return args, nil
+	}
+	return append(append([]string{}, args...), "-o", "json"), nil
+}
+
+// CombinedQueryResults returns query outputs of all targets in target order, each tagged with the target ID
+func (r *Run) CombinedQueryResults() []CombinedQueryResult {
+	combined := []CombinedQueryResult{}
+	for _, result := range r.sortedResults() {
+		if !result.NeedToPrintStdout {
+			continue
+		}
+		for _, v := range result.QueryResults {
+			combined = append(combined, CombinedQueryResult{Target: result.TaskItem.ID, Result: v})
+		}
+	}
+	return combined
+}
+
+// printCombinedQueryResults prints the query outputs of all targets as one JSON array
+func (r *Run) printCombinedQueryResults() error {
+	content, err := json.MarshalIndent(r.CombinedQueryResults(), "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal query results to json: %v", err)
+	}
+
+	fmt.Fprintln(r.Out)
+	fmt.Fprintln(r.Out, utils.Style.Dim.Render("---"))
+	fmt.Fprintln(r.Out, utils.Style.Text.Render("QUERY RESULTS:"))
+	fmt.Fprintln(r.Out, utils.Style.Info.Render(string(content)))
+	fmt.Fprintln(r.Out, utils.Style.Dim.Render("---"))
+	return nil
+}
+
+// formatQueryResults formats query outputs one JSON document per output, the same as jq
+func formatQueryResults(results []any) string {
+	lines := make([]string, 0, len(results))
+	for _, v := range results {
+		content, err := json.MarshalIndent(v, "", "  ")
+		if err != nil {
+			content = fmt.Appendf(nil, "%v", v)
+		}
+		lines = append(lines, string(content))
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,253 @@
+package executor
+
+import (
+	"encoding/json"
+	"regexp"
+	"strings"
+)
+
+// RedactedValue replaces masked secrets in outputs
+const RedactedValue = "[REDACTED]"
+
+var (
+	// secretDataRegex matches the start of the data or stringData field of an object, in YAML or indented JSON
+	secretDataRegex = regexp.MustCompile(`^\s*(- )?((data|stringData):|"(data|stringData)":\s*\{)\s*$`)
+
+	secretKindRegex = regexp.MustCompile(`^\s*(- )?"?kind"?:\s*"?Secret"?,?\s*$`)
+
+	// fieldRegex matches a field of YAML or indented JSON, the groups are the key, the value and the trailing comma
+	fieldRegex = regexp.MustCompile(`^(\s*(?:- )?(?:"[^"]*"|[^\s"]+):\s*)(.*?)(,?)\s*$`)
+
+	// credentialFieldRegex matches fields of kubeconfig files with credentials, e.g. in the output of "config view --raw",
+	// certificate-authority-data is not masked as it's public
+	credentialFieldRegex = regexp.MustCompile(`^(\s*(?:- )?"?(?:client-key-data|client-certificate-data|token|id-token|refresh-token|access-token|password)"?:\s*)(.*?)(,?)\s*$`)
+
+	// inlineSecretDataRegex matches data and stringData of Secrets in compact JSON, e.g. in the last-applied-configuration annotation
+	inlineSecretDataRegex = regexp.MustCompile(`"(?:data|stringData)":\{[^{}]*\}`)
+	inlineFieldRegex      = regexp.MustCompile(`("[^"]*":)"(?:[^"\\]|\\.)*"`)
+	// embeddedJSONRegex matches JSON strings with an embedded JSON object, e.g. the last-applied-configuration annotation in JSON outputs
+	embeddedJSONRegex = regexp.MustCompile(`"\{(?:[^"\\]|\\.)*"`)
+
+	blockScalarRegex = regexp.MustCompile(`^[|>][-+]?\d*$`)
+
+	bearerTokenRegex = regexp.MustCompile(`\b[Bb]earer\s+([A-Za-z0-9\-._~+/]{16,}=*)`)
+	jwtRegex         = regexp.MustCompile(`\beyJ[A-Za-z0-9_-]+\.eyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+`)
+	privateKeyRegex  = regexp.MustCompile(`-----BEGIN [A-Z ]*PRIVATE KEY-----([\s\S]*?)-----END [A-Z ]*PRIVATE KEY-----`)
+)
+
+// Redactor masks secrets in outputs: values of Secret data and stringData, credentials of kubeconfig files,
+// bearer tokens, JWTs, PEM private keys, and matches of custom patterns.
+type Redactor struct {
+	// Patterns are custom regexes of secrets, the whole match is masked, or only the capture groups if there are any
+	Patterns []*regexp.Regexp
+}
+
+func NewRedactor(patterns []*regexp.Regexp) *Redactor {
+	return &Redactor{Patterns: patterns}
+}
+
+// Redact returns the text with secrets masked, and the number of masked values
+func (rd *Redactor) Redact(text string) (string, int) {
+	lines := strings.Split(text, "\n")
+	count := redactSecretData(lines)
+	for i, line := range lines {
+		if m := credentialFieldRegex.FindStringSubmatch(line); m != nil {
+			if value, ok := maskValue(m[2]); ok {
+				lines[i] = m[1] + value + m[3]
+				count++
+			}
+		}
+		var n int
+		lines[i], n = redactInlineSecrets(lines[i])
+		count += n
+	}
+	text = strings.Join(lines, "\n")
+
+	patterns := append([]*regexp.Regexp{privateKeyRegex, bearerTokenRegex, jwtRegex}, rd.Patterns...)
+	for _, re := range patterns {
+		var n int
+		text, n = maskMatches(re, text)
+		count += n
+	}
+	return text, count
+}
+
+// redactInlineSecrets masks values of data and stringData of Secrets in compact JSON, JSON strings with embedded JSON
+// are decoded and masked too, as the last-applied-configuration annotation is escaped in JSON outputs
+func redactInlineSecrets(line string) (string, int) {
+	count := 0
+	line = embeddedJSONRegex.ReplaceAllStringFunc(line, func(literal string) string {
+		var embedded string
+		if err := json.Unmarshal([]byte(literal), &embedded); err != nil {
+			return literal
+		}
+		redacted, n := redactInlineSecrets(embedded)
+		if n == 0 {
+			return literal
+		}
+		encoded, err := json.Marshal(redacted)
+		if err != nil {
+			return literal
+		}
+		count += n
+		return string(encoded)
+	})
+
+	if !strings.Contains(line, `"kind":"Secret"`) {
+		return line, count
+	}
+	line = inlineSecretDataRegex.ReplaceAllStringFunc(line, func(data string) string {
+		return inlineFieldRegex.ReplaceAllStringFunc(data, func(field string) string {
+			m := inlineFieldRegex.FindStringSubmatch(field)
+			if field == m[1]+`"`+RedactedValue+`"` {
+				return field
+			}
+			count++
+			return m[1] + `"` + RedactedValue + `"`
+		})
+	})
+	return line, count
+}
+
+// redactSecretData masks values of data and stringData fields of Secrets in YAML or indented JSON outputs in place,
+// the kind of the object is found from the sibling fields, which have the same indentation as the data field.
+func redactSecretData(lines []string) int {
+	count := 0
+	for i, line := range lines {
+		if !secretDataRegex.MatchString(line) || !isSecretObject(lines, i) {
+			continue
+		}
+
+		dataIndent := keyIndent(line)
+		fieldIndent := -1
+		blockCounted := false
+		for j := i + 1; j < len(lines); j++ {
+			if strings.TrimSpace(lines[j]) == "" {
+				continue
+			}
+			indent := keyIndent(lines[j])
+			if indent <= dataIndent {
+				break
+			}
+			if fieldIndent < 0 {
+				fieldIndent = indent
+			}
+			if indent > fieldIndent { // lines of a multi-line value, which is counted once
+				if strings.TrimSpace(lines[j]) != RedactedValue {
+					lines[j] = lines[j][:indent] + RedactedValue
+					if !blockCounted {
+						count++
+						blockCounted = true
+					}
+				}
+				continue
+			}
+			blockCounted = false
+			m := fieldRegex.FindStringSubmatch(lines[j])
+			if m == nil || blockScalarRegex.MatchString(m[2]) {
+				continue
+			}
+			if value, ok := maskValue(m[2]); ok {
+				lines[j] = m[1] + value + m[3]
+				count++
+			}
+		}
+	}
+	return count
+}
+
+// isSecretObject returns true if the object of the field at lines[i] has the kind Secret
+func isSecretObject(lines []string, i int) bool {
+	indent := keyIndent(lines[i])
+	isSibling := func(line string) (sibling, stop bool) {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" {
+			return false, false
+		}
+		if trimmed == "---" || keyIndent(line) < indent {
+			return false, true
+		}
+		return keyIndent(line) == indent, false
+	}
+
+	if !strings.HasPrefix(strings.TrimSpace(lines[i]), "- ") { // otherwise the field is the first one of the object
+		for j := i - 1; j >= 0; j-- {
+			sibling, stop := isSibling(lines[j])
+			if stop {
+				break
+			}
+			if sibling && secretKindRegex.MatchString(lines[j]) {
+				return true
+			}
+			if sibling && strings.HasPrefix(strings.TrimSpace(lines[j]), "- ") {
+				break
+			}
+		}
+	}
+	for j := i + 1; j < len(lines); j++ {
+		sibling, stop := isSibling(lines[j])
+		if stop || (sibling && strings.HasPrefix(strings.TrimSpace(lines[j]), "- ")) { // the next item of a list
+			break
+		}
+		if sibling && secretKindRegex.MatchString(lines[j]) {
+			return true
+		}
+	}
+	return false
+}
+
+// keyIndent returns the column of the key of a YAML or JSON line, "- " of list items counts as indentation
+func keyIndent(line string) int {
+	i := 0
+	for i < len(line) && (line[i] == ' ' || (line[i] == '-' && i+1 < len(line) && line[i+1] == ' ')) {
+		i++
+	}
+	return i
+}
+
+// maskValue returns the masked value keeping its quotes, false if there is nothing to mask
+func maskValue(value string) (string, bool) {
+	unquoted := strings.Trim(value, `"'`)
+	switch unquoted {
+	case "", "null", "{}", "[]", RedactedValue, "REDACTED", "DATA+OMITTED":
+		return value, false
+	}
+	if value[0] == '"' || value[0] == '\'' {
+		return value[:1] + RedactedValue + value[:1], true
+	}
+	return RedactedValue, true
+}
+
+// maskMatches masks matches of the regex, or only the capture groups if there are any, and returns the number of masked matches
+func maskMatches(re *regexp.Regexp, text string) (string, int) {
+	count := 0
+	out := &strings.Builder{}
+	last := 0
+	for _, m := range re.FindAllStringSubmatchIndex(text, -1) {
+		spans := [][]int{m[:2]}
+		if len(m) > 2 {
+			spans = nil
+			for g := 2; g+1 < len(m); g += 2 {
+				if m[g] >= 0 && m[g] < m[g+1] {
+					spans = append(spans, m[g:g+2])
+				}
+			}
+		}
+
+		masked := false
+		for _, span := range spans {
+			if span[0] < last || text[span[0]:span[1]] == RedactedValue { // nested groups, or masked already
+				continue
+			}
+			out.WriteString(text[last:span[0]])
+			out.WriteString(RedactedValue)
+			last = span[1]
+			masked = true
+		}
+		if masked {
+			count++
+		}
+	}
+	out.WriteString(text[last:])
+	return out.String(), count
+}
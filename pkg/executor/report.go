@@ -0,0 +1,134 @@
+package executor
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path"
+
+	"github.com/junchaw/kubekraken/pkg/utils"
+)
+
+// writeReport writes the summary in the report output format, see utils.IsReportFormat
+func (r *Run) writeReport(w io.Writer, summary RunSummary) error {
+	switch r.Options.OutputFormat {
+	case "html":
+		return summary.WriteHTML(w, r.KubectlArgs, r.StartedAt)
+	case "markdown":
+		return summary.WriteMarkdown(w, r.KubectlArgs, r.StartedAt, r.Options.MarkdownMaxBytes)
+	default:
+		return fmt.Errorf("unknown report format %q", r.Options.OutputFormat)
+	}
+}
+
+// Report renders a saved run in the output format without running kubectl, to the output file or stdout,
+// results are filtered again with the output condition and line filters of the options,
+// the ones of the saved run are not kept, but stdout saved by it is already filtered.
+// The output format is one of text, csv, tsv, html and markdown, text results and summary are rendered with the templates of the options if any.
+func Report(record *RunRecord, opts *RunOptions) error {
+	switch opts.OutputFormat {
+	case "text", "csv", "tsv", "html", "markdown":
+	default:
+		return fmt.Errorf("unknown report format %q, must be one of: text, csv, tsv, html, markdown", opts.OutputFormat)
+	}
+
+	if err := validateWarningCategories(opts.SuppressWarnings); err != nil {
+		return err
+	}
+
+	results := record.SortedResults()
+	opts.Args = record.Args
+	opts.Targets = make([]Target, 0, len(results))
+	for _, result := range results {
+		opts.Targets = append(opts.Targets, *result.TaskItem)
+	}
+
+	r := NewRun(opts)
+	r.RunID = record.RunID
+	r.StartedAt = record.StartedAt
+	for i, result := range results {
+		result.TaskItem.Index = i + 1 // runs saved by older versions have no indexes
+		r.filterResult(result)
+		r.Results[result.TaskItem.ID] = *result
+	}
+	summary := NewRunSummary(r.sortedResults())
+	if opts.Aggregate != nil {
+		summary.Aggregate = opts.Aggregate.Summarize(summary.Results())
+	}
+
+	var out io.Writer = os.Stdout
+	if opts.OutputFile != "" && opts.OutputFile != OutputFileStdout {
+		if err := os.MkdirAll(path.Dir(opts.OutputFile), 0755); err != nil {
+			return fmt.Errorf("failed to create output directory: %v", err)
+		}
+		f, err := os.Create(opts.OutputFile)
+		if err != nil {
+			return fmt.Errorf("failed to create output file: %v", err)
+		}
+		defer f.Close()
+		out = f
+	}
+
+	switch {
+	case utils.IsReportFormat(opts.OutputFormat):
+		if err := r.writeReport(out, summary); err != nil {
+			return err
+		}
+	case utils.IsDelimitedFormat(opts.OutputFormat):
+		if err := r.WriteResultRows(out, opts.OutputFormat); err != nil {
+			return err
+		}
+	default:
+		for _, result := range r.sortedResults() {
+			text := result.ToText(len(results))
+			if opts.ResultTemplate != nil {
+				if !result.NeedToPrintAnything {
+					continue
+				}
+				var err error
+				if text, err = r.renderResultTemplate(result); err != nil {
+					return err
+				}
+			}
+			if _, err := io.WriteString(out, text); err != nil {
+				return fmt.Errorf("failed to write report: %v", err)
+			}
+		}
+		text := "---\n" + summary.ToText()
+		if opts.SummaryTemplate != nil {
+			var err error
+			if text, err = renderTemplate(opts.SummaryTemplate, &summary); err != nil {
+				return err
+			}
+		}
+		if _, err := io.WriteString(out, text); err != nil {
+			return fmt.Errorf("failed to write report: %v", err)
+		}
+	}
+
+	if out != os.Stdout {
+		fmt.Fprintf(r.Out, "%s\n", utils.Style.Success.Render(fmt.Sprintf("Report is saved to file %s", opts.OutputFile)))
+	}
+	return nil
+}
+
+// writeSummaryFile writes the csv/tsv rows or the report of the summary to the summary file of the output directory
+func (r *Run) writeSummaryFile(file string, summary RunSummary) error {
+	f, err := os.OpenFile(file, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to save summary to file: %v", err)
+	}
+	defer f.Close()
+	if utils.IsDelimitedFormat(r.Options.OutputFormat) {
+		err = r.WriteResultRows(f, r.Options.OutputFormat)
+	} else {
+		err = r.writeReport(f, summary)
+	}
+	if err != nil {
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("failed to save summary to file: %v", err)
+	}
+	return nil
+}
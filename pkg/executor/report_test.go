@@ -0,0 +1,129 @@
+package executor
+
+import (
+	"bytes"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriteReportsReadSpilledOutput(t *testing.T) {
+	spilled := "NAME    STATUS\n" + strings.Repeat("pod-a   Running\n", 300) + "pod-last   CrashLoopBackOff\n"
+	spillFile := path.Join(t.TempDir(), "a.stdout.spill")
+	if err := os.WriteFile(spillFile, []byte(spilled), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	r := NewRun(&RunOptions{})
+	r.Results["a"] = TaskResult{
+		TaskItem: &Target{ID: "a", Context: "a", Index: 1}, Stdout: spilled[:SpillPreviewSize], StdoutFile: spillFile,
+		HasStdout: true, ConditionMatched: true, NeedToPrintStdout: true, NeedToPrintAnything: true,
+	}
+	r.Results["b"] = TaskResult{
+		TaskItem: &Target{ID: "b", Context: "b", Index: 2}, Err: "exit status 1", Stderr: "error: forbidden\n",
+		HasErr: true, HasStderr: true, NeedToPrintErr: true, NeedToPrintStderr: true, NeedToPrintAnything: true,
+	}
+	summary := NewRunSummary(r.sortedResults())
+	startedAt := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	tests := []struct {
+		format string
+		write  func(*bytes.Buffer) error
+		want   []string
+	}{
+		{
+			format: "csv",
+			write:  func(b *bytes.Buffer) error { return r.WriteResultRows(b, "csv") },
+			want:   []string{"id,kubeconfig,context,status,exitCode,duration,error,output\n", "pod-last   CrashLoopBackOff\"\n", "b,,b,error,0,0.000,exit status 1,\n"},
+		},
+		{
+			format: "html",
+			write:  func(b *bytes.Buffer) error { return summary.WriteHTML(b, []string{"get", "pods"}, startedAt) },
+			want:   []string{"<!DOCTYPE html>", `data-id="a"`, "pod-last   CrashLoopBackOff", `data-id="b"`, "error: forbidden", "</html>\n"},
+		},
+		{
+			format: "markdown",
+			write: func(b *bytes.Buffer) error {
+				return summary.WriteMarkdown(b, []string{"get", "pods"}, startedAt, 0)
+			},
+			want: []string{"| `a` | success | `pod-a Running` (+300 lines) |\n", "| `b` | error | `error: forbidden` (+2 lines) |\n", "pod-last   CrashLoopBackOff\n```\n"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := tt.write(&buf); err != nil {
+				t.Fatal(err)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(buf.String(), want) {
+					t.Errorf("%s report has no %q:\n%s", tt.format, want, buf.String())
+				}
+			}
+		})
+	}
+}
+
+func TestWriteMarkdownTruncates(t *testing.T) {
+	var results []*TaskResult
+	for _, id := range []string{"a", "b", "c"} {
+		results = append(results, &TaskResult{
+			TaskItem: &Target{ID: id}, Err: "exit status 1", Stderr: strings.Repeat("error: forbidden\n", 20),
+			HasErr: true, NeedToPrintErr: true, NeedToPrintAnything: true,
+		})
+	}
+	summary := NewRunSummary(results)
+
+	var buf bytes.Buffer
+	if err := summary.WriteMarkdown(&buf, []string{"get", "pods"}, time.Time{}, 1000); err != nil {
+		t.Fatal(err)
+	}
+	if buf.Len() > 1000 {
+		t.Errorf("report is %d bytes, want at most 1000", buf.Len())
+	}
+	if got := strings.Count(buf.String(), "| error |"); got != 3 {
+		t.Errorf("%d table rows are kept, want 3", got)
+	}
+	if !strings.Contains(buf.String(), "0 of 3 table rows and 2 of 3 failure details are omitted") {
+		t.Errorf("truncation note is missing:\n%s", buf.String())
+	}
+}
+
+func TestWriteMarkdownShortensCommand(t *testing.T) {
+	summary := NewRunSummary([]*TaskResult{{TaskItem: &Target{ID: "a"}}})
+	args := []string{"get", "pods", "-l", strings.Repeat("app=web,", 200)}
+
+	var buf bytes.Buffer
+	if err := summary.WriteMarkdown(&buf, args, time.Time{}, 1000); err != nil {
+		t.Fatal(err)
+	}
+	if buf.Len() > 1000 {
+		t.Errorf("report is %d bytes, want at most 1000", buf.Len())
+	}
+	if !strings.HasPrefix(buf.String(), "### kubekraken: `kubectl get pods -l app=web,") || !strings.Contains(buf.String(), "...`\n") {
+		t.Errorf("command is not shortened:\n%s", buf.String())
+	}
+	if !strings.Contains(buf.String(), "1 of 1 table rows and 0 of 0 failure details are omitted") {
+		t.Errorf("truncation note is missing:\n%s", buf.String())
+	}
+
+	if err := summary.WriteMarkdown(&bytes.Buffer{}, args, time.Time{}, 100); err == nil {
+		t.Error("WriteMarkdown() error = nil, want an error when the head doesn't fit")
+	}
+}
+
+func TestWriteMarkdownEscapesTargetID(t *testing.T) {
+	summary := NewRunSummary([]*TaskResult{{
+		TaskItem: &Target{ID: "kc@<b>&ctx</b>"}, Err: "exit status 1", HasErr: true, NeedToPrintErr: true, NeedToPrintAnything: true,
+	}})
+
+	var buf bytes.Buffer
+	if err := summary.WriteMarkdown(&buf, []string{"get", "pods"}, time.Time{}, 0); err != nil {
+		t.Fatal(err)
+	}
+	if want := "<summary><code>kc@&lt;b&gt;&amp;ctx&lt;/b&gt;</code>: error</summary>"; !strings.Contains(buf.String(), want) {
+		t.Errorf("report has no %q:\n%s", want, buf.String())
+	}
+}
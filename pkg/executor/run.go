@@ -1,28 +1,40 @@
 package executor
 
 import (
+	"bufio"
+	"crypto/rand"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"os"
 	"path"
+	"regexp"
+	"sort"
 	"sync"
+	"text/template"
+	"time"
 
+	"github.com/junchaw/kubekraken/pkg/query"
 	"github.com/junchaw/kubekraken/pkg/utils"
 	"github.com/sirupsen/logrus"
 	"gopkg.in/yaml.v2"
 )
 
+// OutputFileStdout is the output file name which writes results to stdout, styled text is printed to stderr instead
+const OutputFileStdout = "-"
+
+// SpillPreviewSize is the number of bytes kept in memory for outputs spilled to disk
+const SpillPreviewSize = 4096
+
 const (
-	OutputConditionOperatorContains    = "contains"
-	OutputConditionOperatorNotContains = "not-contains"
+	OrderByIndex      = "index"
+	OrderByID         = "id"
+	OrderByKubeconfig = "kubeconfig"
+	OrderByContext    = "context"
 )
 
-type OutputCondition struct {
-	Operator string
-	Value    string
-}
-
 type RunOptions struct {
 	Targets []Target
 
@@ -30,12 +42,114 @@ type RunOptions struct {
 
 	Workers int
 
-	OutputDir        string
-	OutputFile       string
-	OutputFormat     string
-	PrintStdout      bool
-	PrintStderr      bool
-	OutputConditions []OutputCondition
+	OutputDir    string
+	OutputFile   string
+	OutputFormat string
+	PrintStdout  bool
+	PrintStderr  bool
+	// OutputCondition decides whether stdout of a successful target is printed, nil means always print
+	OutputCondition *OutputCondition
+
+	// CleanOutputDir empties the output directory and writes results to it directly, instead of to a subdirectory for the run
+	CleanOutputDir bool
+
+	// Redactor masks secrets in outputs before results are filtered, printed or saved, nil means no redaction
+	Redactor *Redactor
+
+	// SuppressWarnings are warning categories of stderr lines which are not printed, one of WarningCategory*,
+	// targets without any other stderr are not counted as with warnings
+	SuppressWarnings []string
+
+	// Grep keeps only stdout lines matching it, table headers are always kept, nil means no filter
+	Grep *regexp.Regexp
+
+	// GrepInvert drops stdout lines matching it, table headers are always kept, nil means no filter
+	GrepInvert *regexp.Regexp
+
+	// Ordered prints results in target order instead of completion order
+	Ordered bool
+
+	// OrderBy is the sort key for targets, one of OrderBy*, empty means the original order
+	OrderBy string
+
+	// MergeTable prints the table outputs of all targets as one table after the run, instead of per target
+	MergeTable bool
+
+	// MergeTableTargetColumn is the leading column of the merged table, one of MergeTableTargetColumn*
+	MergeTableTargetColumn string
+
+	// MergeTableSortBy is the list of columns to sort the merged table by
+	MergeTableSortBy []string
+
+	// MergeTableColumns is the list of columns to keep in the merged table, empty means all columns
+	MergeTableColumns []string
+
+	// GroupIdentical prints each distinct stdout once after the run with the targets which produced it, instead of per target
+	GroupIdentical bool
+
+	// GroupIgnoreVolatile ignores volatile table columns (e.g. AGE) and timestamps when grouping identical outputs
+	GroupIgnoreVolatile bool
+
+	// Query is evaluated with the JSON output of each target, kubectl is run with "-o json" if there is no output flag
+	Query *query.Query
+
+	// QueryCombine prints the query outputs of all targets as one JSON array after the run, each tagged with the target ID
+	QueryCombine bool
+
+	// Aggregate computes a value per target from its JSON output, printed as a table with the fleet-wide value after the run,
+	// kubectl is run with "-o json" if there is no output flag
+	Aggregate *Aggregate
+
+	// ResultTemplate renders each result instead of the styled output, see ParseTemplate, nil means the styled output
+	ResultTemplate *template.Template
+
+	// SummaryTemplate renders the summary instead of the styled output, see ParseTemplate, nil means the styled output
+	SummaryTemplate *template.Template
+
+	// SummaryView is how the summary is printed, one of SummaryView*, empty means text
+	SummaryView string
+
+	// SummarySortBy is the list of columns to sort the summary table by, prefixed with "-" for descending order
+	SummarySortBy []string
+
+	// SummaryHideSuccess leaves successful targets out of the summary table
+	SummaryHideSuccess bool
+
+	// JUnitReport is the path of the JUnit XML report, each target is a testcase, empty means no report
+	JUnitReport string
+
+	// HistoryDir is the directory of the history store, each run is saved to it, empty means no history
+	HistoryDir string
+
+	// HistoryLimit is the max number of runs kept in the history store, older runs are removed, 0 means no limit
+	HistoryLimit int
+
+	// NotifyWebhook is the URL to post a notification to when the run finishes, empty means no notification
+	NotifyWebhook string
+
+	// NotifyTemplate is the payload template of the notification, one of NotifyTemplate*
+	NotifyTemplate string
+
+	// NotifyOn is the list of conditions to send the notification on, one of NotifyOn*, any of them matching sends the notification
+	NotifyOn []string
+
+	// NotifyRetries is the number of retries of the notification on network errors, 429 and 5xx responses
+	NotifyRetries int
+
+	// MetricsFile is the path of the Prometheus metrics file in textfile collector format, empty means no metrics file
+	MetricsFile string
+
+	// MetricsPushURL is the URL to push metrics to with a PUT request, e.g. a Pushgateway group URL, empty means no push
+	MetricsPushURL string
+
+	// MarkdownMaxBytes is the max size of the markdown report, details are omitted first, 0 means no limit
+	MarkdownMaxBytes int
+
+	// CSVExpandLines writes one csv/tsv row per output line instead of one row per target
+	CSVExpandLines bool
+
+	// SpillThreshold is the output size in bytes above which stdout/stderr is spilled to files, 0 means never spill
+	SpillThreshold int
 
 	Logger *logrus.Logger
 }
@@ -50,63 +164,140 @@ type Run struct {
 
 	NextTarget chan *Target
 
-	Counter int
+	// KubectlArgs are the args passed to kubectl for each target, after the kubeconfig and context flags
+	KubectlArgs []string
 
 	Results map[string]TaskResult
 
+	// PendingResults holds finished results by target index in ordered mode, until all earlier targets are printed
+	PendingResults map[int]*TaskResult
+
+	// NextIndex is the index of the next target to print in ordered mode
+	NextIndex int
+
+	// OutputDir is the directory for the results of this run, it's a subdirectory of the output directory unless it's cleaned
+	OutputDir string
+
+	// SpillDir is the directory for outputs spilled to disk, it's a private temporary directory which is removed
+	// when the run finishes, never the output directory, as spilled outputs are written before secrets are masked
+	SpillDir string
+
+	// RunID identifies the run, it's the start time followed by a random suffix, e.g. 20060102-150405-a1b2c3
+	RunID string
+
+	// StartedAt is when the run started
+	StartedAt time.Time
+
+	// Out is where styled text for terminal is printed, it's stderr if results are written to stdout
+	Out io.Writer
+
+	// OutputWriter is the output file, or stdout if the output file is "-", nil if there is no output file
+	OutputWriter io.Writer
+
 	Logger *logrus.Logger
 }
 
 func NewRun(opts *RunOptions) *Run {
+	var out io.Writer = os.Stdout
+	if opts.OutputFile == OutputFileStdout {
+		out = os.Stderr
+	}
+	utils.SetColorOutput(out)
+
 	return &Run{
-		Options:    opts,
-		Wg:         sync.WaitGroup{},
-		Lock:       sync.Mutex{},
-		NextTarget: make(chan *Target),
-		Results:    make(map[string]TaskResult),
-		Logger:     opts.Logger,
+		Options:     opts,
+		Wg:          sync.WaitGroup{},
+		Lock:        sync.Mutex{},
+		NextTarget:  make(chan *Target),
+		KubectlArgs: opts.Args,
+		Results:     make(map[string]TaskResult),
+		Out:         out,
+		Logger:      opts.Logger,
+
+		PendingResults: make(map[int]*TaskResult),
+		NextIndex:      1,
 	}
 }
 
 func (r *Run) Run() error {
-	if r.Options.OutputFile != "" {
+	r.StartedAt = time.Now()
+	r.RunID = newRunID(r.StartedAt)
+
+	targets, err := r.sortTargets()
+	if err != nil {
+		return err
+	}
+
+	if r.Options.MergeTable {
+		if _, _, err := r.mergeTableTargetColumn(); err != nil {
+			return err
+		}
+	}
+
+	if err := validateWarningCategories(r.Options.SuppressWarnings); err != nil {
+		return err
+	}
+
+	if err := validateSummaryView(r.Options.SummaryView, r.Options.SummarySortBy); err != nil {
+		return err
+	}
+
+	if r.Options.NotifyWebhook != "" {
+		if err := validateNotifyOptions(r.Options.NotifyTemplate, r.Options.NotifyOn); err != nil {
+			return err
+		}
+	}
+
+	if r.needsJSONOutput() {
+		if r.KubectlArgs, err = ensureJSONOutput(r.Options.Args); err != nil {
+			return err
+		}
+	}
+
+	if r.Options.OutputFile == OutputFileStdout {
+		r.OutputWriter = os.Stdout
+	} else if r.Options.OutputFile != "" {
 		outputDir := path.Dir(r.Options.OutputFile)
 		if err := os.MkdirAll(outputDir, 0755); err != nil {
 			return fmt.Errorf("failed to create output directory: %v", err)
 		}
 
-		// Create empty file if it doesn't exist
-		if _, err := os.Stat(r.Options.OutputFile); os.IsNotExist(err) {
-			if _, err := os.Create(r.Options.OutputFile); err != nil {
-				return fmt.Errorf("failed to create output file: %v", err)
-			}
-		} else {
-			// Truncate existing file
-			if err := os.Truncate(r.Options.OutputFile, 0); err != nil {
-				return fmt.Errorf("failed to truncate output file: %v", err)
-			}
+		// Create the file, or truncate it if it exists, it's kept open so that results are appended as they finish
+		f, err := os.Create(r.Options.OutputFile)
+		if err != nil {
+			return fmt.Errorf("failed to create output file: %v", err)
 		}
+		defer f.Close()
+		r.OutputWriter = f
 		r.Logger.Infof("output file: %s", r.Options.OutputFile)
 	}
 
 	if r.Options.OutputDir != "" {
-		// Empty the directory if it exists
-		if err := os.RemoveAll(r.Options.OutputDir); err != nil {
-			return fmt.Errorf("failed to remove output directory: %v", err)
+		if r.OutputDir, err = r.prepareOutputDir(); err != nil {
+			return err
 		}
-		if err := os.MkdirAll(r.Options.OutputDir, 0755); err != nil {
-			return fmt.Errorf("failed to create output directory: %v", err)
+		r.Logger.Infof("output directory: %s", r.OutputDir)
+	}
+
+	if r.Options.SpillThreshold > 0 {
+		// MkdirTemp creates the directory with mode 0700
+		spillDir, err := os.MkdirTemp("", "kubekraken-spill-")
+		if err != nil {
+			return fmt.Errorf("failed to create spill directory: %v", err)
 		}
-		r.Logger.Infof("output directory: %s", r.Options.OutputDir)
+		defer os.RemoveAll(spillDir)
+		r.SpillDir = spillDir
+		r.Logger.Infof("spill directory: %s", r.SpillDir)
 	}
 
 	stopCh := make(chan struct{})
 	for range r.Options.Workers {
+		r.Wg.Add(1)
 		go r.startWorker(stopCh)
 	}
 
-	for _, target := range r.Options.Targets {
-		r.NextTarget <- &target
+	for i := range targets {
+		r.NextTarget <- &targets[i]
 	}
 
 	close(stopCh)
@@ -114,75 +305,158 @@ func (r *Run) Run() error {
 	r.Logger.Infof("waiting for workers to exit")
 	r.Wg.Wait()
 
-	summary := RunSummary{
-		Errors:       []TaskResult{},
-		ErrorCount:   0,
-		Warnings:     []TaskResult{},
-		WarningCount: 0,
-		TotalCount:   len(r.Results),
+	summary := NewRunSummary(r.sortedResults())
+	if r.Options.Aggregate != nil {
+		summary.Aggregate = r.Options.Aggregate.Summarize(summary.Results())
 	}
-	for _, result := range r.Results {
-		if result.NeedToPrintErr {
-			summary.ErrorCount++
-			summary.Errors = append(summary.Errors, result)
+
+	if r.Options.MergeTable {
+		if err := r.printMergedTables(); err != nil {
+			return err
 		}
-		if result.NeedToPrintStderr {
-			summary.WarningCount++
-			summary.Warnings = append(summary.Warnings, result)
+	}
+
+	if r.Options.GroupIdentical {
+		r.printOutputGroups()
+	}
+
+	if r.Options.QueryCombine {
+		if err := r.printCombinedQueryResults(); err != nil {
+			return err
 		}
 	}
 
-	for _, result := range summary.ToStyledText() {
-		fmt.Println(result.Render())
+	if summary.Aggregate != nil {
+		r.printAggregate(&summary)
+	}
+
+	if r.Options.SummaryTemplate != nil {
+		output, err := renderTemplate(r.Options.SummaryTemplate, &summary)
+		if err != nil {
+			return err
+		}
+		fmt.Fprint(r.Out, output)
+	} else if r.Options.SummaryView == SummaryViewTable {
+		fmt.Fprint(r.Out, summary.ToTable(r.Options.SummarySortBy, r.Options.SummaryHideSuccess))
+	} else {
+		for _, result := range summary.ToStyledText() {
+			fmt.Fprintln(r.Out, result.Render())
+		}
 	}
-	if r.Options.OutputFile != "" {
+	if r.OutputWriter != nil {
 		// JSON doesn't support multi documents, need to write after merging all results
 		if r.Options.OutputFormat == "json" {
-			jsonContent, err := json.MarshalIndent(map[string]any{
-				"results": r.Results, // for JSON, we always print stdout, stderr and error, could be improved to consider print flags
-				"summary": summary,
-			}, "", "  ")
-			if err != nil {
-				return fmt.Errorf("failed to marshal summary to json: %v", err)
+			// for JSON, we always print stdout, stderr and error, could be improved to consider print flags
+			if err := r.writeJSONDocument(r.OutputWriter, summary); err != nil {
+				return err
 			}
-			if err := os.WriteFile(r.Options.OutputFile, jsonContent, 0600); err != nil {
-				return fmt.Errorf("failed to write summary to file: %v", err)
+		} else if r.Options.OutputFormat == "ndjson" {
+			if r.Options.QueryCombine {
+				if err := r.writeNDJSONRecord(NDJSONRecord{Type: NDJSONRecordQuery, Query: r.CombinedQueryResults()}); err != nil {
+					return err
+				}
 			}
-		} else {
-			f, err := os.OpenFile(r.Options.OutputFile, os.O_APPEND|os.O_WRONLY, 0600)
-			if err != nil {
-				return fmt.Errorf("failed to open output file: %v", err)
+			if err := r.writeNDJSONRecord(NDJSONRecord{Type: NDJSONRecordSummary, Summary: &summary}); err != nil {
+				return err
+			}
+		} else if utils.IsDelimitedFormat(r.Options.OutputFormat) {
+			// rows are written after all targets finish, so that they are in target order
+			if err := r.WriteResultRows(r.OutputWriter, r.Options.OutputFormat); err != nil {
+				return err
+			}
+		} else if utils.IsReportFormat(r.Options.OutputFormat) {
+			if err := r.writeReport(r.OutputWriter, summary); err != nil {
+				return err
 			}
-			defer f.Close()
+		} else {
 			outputContent := ""
 			if r.Options.OutputFormat == "yaml" {
+				if r.Options.QueryCombine {
+					queryContent, err := yaml.Marshal(map[string]any{"query": r.CombinedQueryResults()})
+					if err != nil {
+						return fmt.Errorf("failed to marshal query results to yaml: %v", err)
+					}
+					outputContent += string(queryContent) + "---\n"
+				}
 				yamlContent, err := yaml.Marshal(summary)
 				if err != nil {
 					return fmt.Errorf("failed to marshal summary to yaml: %v", err)
 				}
-				outputContent = string(yamlContent)
+				outputContent += string(yamlContent)
 			} else {
-				outputContent = summary.ToText()
+				if r.Options.QueryCombine {
+					queryContent, err := json.MarshalIndent(r.CombinedQueryResults(), "", "  ")
+					if err != nil {
+						return fmt.Errorf("failed to marshal query results to json: %v", err)
+					}
+					outputContent += fmt.Sprintf("QUERY RESULTS:\n%s\n---\n", queryContent)
+				}
+				outputContent += summary.ToText()
 			}
-			if _, err := f.Write([]byte("---\n" + outputContent)); err != nil {
+			if _, err := r.OutputWriter.Write([]byte("---\n" + outputContent)); err != nil {
 				return fmt.Errorf("failed to write summary to file: %v", err)
 			}
 		}
-		fmt.Printf("%s\n", utils.Style.Success.Render(fmt.Sprintf("Results are saved to file %s", r.Options.OutputFile)))
+		if r.Options.OutputFile != OutputFileStdout {
+			fmt.Fprintf(r.Out, "%s\n", utils.Style.Success.Render(fmt.Sprintf("Results are saved to file %s", r.Options.OutputFile)))
+		}
+	}
+
+	if r.Options.JUnitReport != "" {
+		if err := r.writeJUnitReport(summary); err != nil {
+			return err
+		}
+		fmt.Fprintf(r.Out, "%s\n", utils.Style.Success.Render(fmt.Sprintf("JUnit report is saved to file %s", r.Options.JUnitReport)))
+	}
+
+	if r.Options.HistoryDir != "" {
+		store := NewHistoryStore(r.Options.HistoryDir, r.Options.HistoryLimit)
+		if err := store.Save(r, summary); err != nil {
+			return err
+		}
+		r.Logger.Infof("run %s is saved to history %s", r.RunID, r.Options.HistoryDir)
+	}
+
+	if r.Options.MetricsFile != "" || r.Options.MetricsPushURL != "" {
+		if err := r.writeMetrics(summary, time.Since(r.StartedAt)); err != nil {
+			return err
+		}
 	}
 
 	if r.Options.OutputDir != "" {
-		summaryFile := path.Join(r.Options.OutputDir, "summary"+utils.FileExt(r.Options.OutputFormat))
-		err := utils.PutFileWithFormat(summaryFile, summary, r.Options.OutputFormat, func() string {
-			return summary.ToText()
-		})
-		if err != nil {
-			return fmt.Errorf("failed to save summary to file: %v", err)
+		summaryFile := path.Join(r.OutputDir, "summary"+utils.FileExt(r.Options.OutputFormat))
+		if utils.IsDelimitedFormat(r.Options.OutputFormat) || utils.IsReportFormat(r.Options.OutputFormat) {
+			if err := r.writeSummaryFile(summaryFile, summary); err != nil {
+				return err
+			}
+		} else {
+			err := utils.PutFileWithFormat(summaryFile, summary, r.Options.OutputFormat, summary.ToText)
+			if err != nil {
+				return fmt.Errorf("failed to save summary to file: %v", err)
+			}
 		}
-		fmt.Printf("%s\n", utils.Style.Success.Render(fmt.Sprintf("Results are saved to directory %s", r.Options.OutputDir)))
+		if r.Options.QueryCombine {
+			queryFile := path.Join(r.OutputDir, "query"+utils.FileExt(r.Options.OutputFormat))
+			combined := r.CombinedQueryResults()
+			err := utils.PutFileWithFormat(queryFile, combined, r.Options.OutputFormat, func() string {
+				content, _ := json.MarshalIndent(combined, "", "  ")
+				return string(content)
+			})
+			if err != nil {
+				return fmt.Errorf("failed to save query results to file: %v", err)
+			}
+		}
+		fmt.Fprintf(r.Out, "%s\n", utils.Style.Success.Render(fmt.Sprintf("Results are saved to directory %s", r.OutputDir)))
 	}
 
-	fmt.Printf("%s\n", utils.Style.Dim.Render("---"))
+	// all targets are done, so a failed notification is only a warning, it doesn't fail the run
+	if r.Options.NotifyWebhook != "" {
+		if err := r.notify(&summary); err != nil {
+			r.Logger.Warnf("%v", err)
+		}
+	}
+
+	fmt.Fprintf(r.Out, "%s\n", utils.Style.Dim.Render("---"))
 
 	if summary.ErrorCount > 0 {
 		return errors.New("not all clusters were processed successfully")
@@ -190,3 +464,95 @@ func (r *Run) Run() error {
 
 	return nil
 }
+
+// newRunID returns a run ID which sorts by start time
+func newRunID(startedAt time.Time) string {
+	suffix := make([]byte, 3)
+	_, _ = rand.Read(suffix)
+	return startedAt.Format("20060102-150405") + "-" + hex.EncodeToString(suffix)
+}
+
+// sortTargets returns a copy of the targets sorted by the order key, with Index set to the position in the sorted list,
+// so that the index of a target is deterministic and doesn't depend on which worker picks it up first.
+func (r *Run) sortTargets() ([]Target, error) {
+	targets := make([]Target, len(r.Options.Targets))
+	copy(targets, r.Options.Targets)
+
+	var key func(t *Target) string
+	switch r.Options.OrderBy {
+	case "", OrderByIndex:
+	case OrderByID:
+		key = func(t *Target) string { return t.ID }
+	case OrderByKubeconfig:
+		key = func(t *Target) string { return t.Kubeconfig }
+	case OrderByContext:
+		key = func(t *Target) string { return t.Context }
+	default:
+		return nil, fmt.Errorf("unknown order key %q, must be one of: %s, %s, %s, %s",
+			r.Options.OrderBy, OrderByIndex, OrderByID, OrderByKubeconfig, OrderByContext)
+	}
+	if key != nil {
+		sort.SliceStable(targets, func(i, j int) bool {
+			return key(&targets[i]) < key(&targets[j])
+		})
+	}
+
+	for i := range targets {
+		targets[i].Index = i + 1
+	}
+	return targets, nil
+}
+
+// writeJSONDocument writes the run as one JSON document, which can be loaded as a RunRecord,
+// results are marshaled one by one so that spilled outputs are never all loaded into memory at the same time.
+func (r *Run) writeJSONDocument(out io.Writer, summary RunSummary) error {
+	ids := make([]string, 0, len(r.Results))
+	for id := range r.Results {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	runIDContent, _ := json.Marshal(r.RunID)
+	startedAtContent, _ := json.Marshal(r.StartedAt)
+	argsContent, err := json.Marshal(r.Options.Args)
+	if err != nil {
+		return fmt.Errorf("failed to marshal args to json: %v", err)
+	}
+
+	w := bufio.NewWriter(out)
+	fmt.Fprintf(w, "{\n  \"runId\": %s,\n  \"startedAt\": %s,\n  \"args\": %s,", runIDContent, startedAtContent, argsContent)
+	w.WriteString("\n  \"results\": {")
+	for i, id := range ids {
+		result := r.Results[id]
+		resultContent, err := json.MarshalIndent(result.WithFullOutput(), "    ", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to marshal result to json: %v", err)
+		}
+		idContent, _ := json.Marshal(id)
+		if i > 0 {
+			w.WriteString(",")
+		}
+		fmt.Fprintf(w, "\n    %s: %s", idContent, resultContent)
+	}
+	if len(ids) > 0 {
+		w.WriteString("\n  ")
+	}
+	w.WriteString("},")
+	if r.Options.QueryCombine {
+		queryContent, err := json.MarshalIndent(r.CombinedQueryResults(), "  ", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to marshal query results to json: %v", err)
+		}
+		fmt.Fprintf(w, "\n  \"query\": %s,", queryContent)
+	}
+	summaryContent, err := json.MarshalIndent(summary, "  ", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal summary to json: %v", err)
+	}
+	fmt.Fprintf(w, "\n  \"summary\": %s\n}", summaryContent)
+
+	if err := w.Flush(); err != nil {
+		return fmt.Errorf("failed to write summary to file: %v", err)
+	}
+	return nil
+}
@@ -1,10 +1,13 @@
 package executor
 
 import (
+	"errors"
 	"fmt"
 	"os"
+	"os/exec"
 	"path"
 	"strings"
+	"time"
 
 	"github.com/junchaw/kubekraken/pkg/utils"
 )
@@ -13,57 +16,178 @@ func (r *Run) processOneResult(taskItem *Target) *TaskResult {
 	var args []string
 	args = append(args, "--kubeconfig", taskItem.Kubeconfig)
 	args = append(args, "--context", taskItem.Context)
-	args = append(args, r.Options.Args...)
-	stdoutBytes, stderrBytes, kubectlErr := utils.Exec("kubectl", args...)
+	args = append(args, r.KubectlArgs...)
+
+	stdoutBuffer := r.newSpillBuffer(taskItem.ID + ".stdout.spill")
+	stderrBuffer := r.newSpillBuffer(taskItem.ID + ".stderr.spill")
+	startedAt := time.Now()
+	kubectlErr := utils.ExecWithWriters(stdoutBuffer, stderrBuffer, "kubectl", args...)
+	duration := time.Since(startedAt)
+	if err := stdoutBuffer.Close(); err != nil {
+		r.Logger.Fatalf("failed to close stdout spill file: %v", err)
+	}
+	if err := stderrBuffer.Close(); err != nil {
+		r.Logger.Fatalf("failed to close stderr spill file: %v", err)
+	}
 
 	errString := ""
+	exitCode := 0
 	if kubectlErr != nil {
 		errString = kubectlErr.Error()
+		exitCode = -1 // kubectl didn't run or was killed
+		var exitErr *exec.ExitError
+		if errors.As(kubectlErr, &exitErr) {
+			exitCode = exitErr.ExitCode()
+		}
 	}
-	stdout := string(stdoutBytes)
-	stderr := string(stderrBytes)
+	stdout := string(stdoutBuffer.Bytes())
+	stderr := string(stderrBuffer.Bytes())
 
-	hasStdout := len(stdout) > 0
-	hasStderr := len(stderr) > 0
-	hasErr := kubectlErr != nil
+	stdoutFile := ""
+	if stdoutBuffer.Spilled() {
+		stdoutFile = stdoutBuffer.Path
+	}
+	stderrFile := ""
+	if stderrBuffer.Spilled() {
+		stderrFile = stderrBuffer.Path
+	}
 
-	needToPrintStdout := hasErr || r.Options.PrintStdout
-	if !hasErr { // if there is error, we always print stdout, regardless of output condition
-		for _, outputCondition := range r.Options.OutputConditions {
-			if outputCondition.Operator == OutputConditionOperatorContains {
-				if !strings.Contains(stdout, outputCondition.Value) {
-					needToPrintStdout = false
-					break
-				}
-			} else if outputCondition.Operator == OutputConditionOperatorNotContains {
-				if strings.Contains(stdout, outputCondition.Value) {
-					needToPrintStdout = false
-					break
-				}
+	result := &TaskResult{
+		TaskItem: taskItem,
+
+		Err:      errString,
+		ExitCode: exitCode,
+		Stdout:   stdout,
+		Stderr:   stderr,
+		Duration: duration,
+
+		StdoutFile: stdoutFile,
+		StderrFile: stderrFile,
+
+		HasErr:    kubectlErr != nil,
+		HasStdout: stdoutBuffer.Size() > 0,
+		HasStderr: stderrBuffer.Size() > 0,
+	}
+	r.filterResult(result)
+	return result
+}
+
+// filterResult masks secrets in the output of the result, evaluates the output condition, query and line filters with it,
+// and decides what of it is printed, it's used for live runs and to filter saved runs again in reports.
+func (r *Run) filterResult(result *TaskResult) {
+	// spilled outputs are read back once, and written back to their spill files only if they are changed,
+	// spilled stdout is only read back if it's filtered, stderr is always read as warnings and errors are parsed from it
+	stdout := result.Stdout
+	if r.filtersStdout() {
+		stdout = result.FullStdout()
+	}
+	stderr := result.FullStderr()
+	stdoutChanged, stderrChanged := false, false
+
+	if r.Options.Redactor != nil {
+		var n int
+		if stdout, n = r.Options.Redactor.Redact(stdout); n > 0 {
+			stdoutChanged = true
+			result.Redactions += n
+		}
+		if stderr, n = r.Options.Redactor.Redact(stderr); n > 0 {
+			stderrChanged = true
+			result.Redactions += n
+		}
+	}
+
+	hasErr := result.HasErr
+
+	conditionMatched := false
+	if r.Options.OutputCondition != nil {
+		conditionInput := &OutputConditionInput{
+			Stdout:   stdout,
+			Stderr:   stderr,
+			Err:      result.Err,
+			ExitCode: result.ExitCode,
+		}
+		conditionMatched = r.Options.OutputCondition.Match(conditionInput)
+
+		// json conditions filter List outputs down to the matching items, the filtered output replaces stdout
+		if conditionMatched {
+			if filtered, ok := r.Options.OutputCondition.FilterItems(conditionInput); ok {
+				stdout, stdoutChanged = filtered, true
 			}
 		}
 	}
 
-	needToPrintStderr := hasErr || (r.Options.PrintStderr && hasStderr)
+	if !hasErr && r.Options.Query != nil {
+		results, err := r.Options.Query.RunJSON([]byte(stdout))
+		if err != nil {
+			hasErr = true
+			result.Err = err.Error()
+		} else {
+			result.QueryResults = append([]any{}, results...) // not nil, so that it's known that the query was evaluated
+		}
+	}
 
-	needToPrintErr := hasErr
+	result.AggregateValue = nil
+	if !hasErr && r.Options.Aggregate != nil {
+		value, err := r.Options.Aggregate.Evaluate(stdout)
+		if err != nil {
+			hasErr = true
+			result.Err = err.Error()
+		} else {
+			result.AggregateValue = value
+		}
+	}
 
-	return &TaskResult{
-		TaskItem: taskItem,
+	// line filters, targets without any matching line are not printed, but they are still counted in the summary
+	grepMatches := 0
+	if r.Options.Grep != nil || r.Options.GrepInvert != nil {
+		stdout, grepMatches = grepLines(stdout, r.Options.Grep, r.Options.GrepInvert)
+		stdoutChanged = true
+	}
 
-		Err:    errString,
-		Stdout: stdout,
-		Stderr: stderr,
+	needToPrintStdout := hasErr || r.Options.PrintStdout
+	if !hasErr && r.Options.OutputCondition != nil && !conditionMatched { // if there is error, we always print stdout, regardless of output condition
+		needToPrintStdout = false
+	}
+	if !hasErr && (r.Options.Grep != nil || r.Options.GrepInvert != nil) && grepMatches == 0 {
+		needToPrintStdout = false
+	}
 
-		HasErr:    hasErr,
-		HasStdout: hasStdout,
-		HasStderr: hasStderr,
+	// errors are classified and warnings are parsed before suppressing, so that they see the whole stderr
+	result.ErrorCategory = ""
+	if hasErr {
+		result.ErrorCategory = classifyError(result, stderr)
+	}
+	result.StderrWarnings = ParseStderrWarnings(stderr)
+	hasStderr := result.HasStderr
+	if len(r.Options.SuppressWarnings) > 0 {
+		stderr, stderrChanged = suppressStderrLines(stderr, r.Options.SuppressWarnings), true
+		hasStderr = stderr != ""
+	}
+
+	needToPrintStderr := hasErr || (r.Options.PrintStderr && hasStderr)
+
+	needToPrintErr := hasErr
 
-		NeedToPrintErr:      needToPrintErr,
-		NeedToPrintStdout:   needToPrintStdout,
-		NeedToPrintStderr:   needToPrintStderr,
-		NeedToPrintAnything: needToPrintErr || needToPrintStdout || needToPrintStderr,
+	if stdoutChanged {
+		var err error
+		if result.Stdout, result.StdoutFile, err = r.storeOutput(stdout, result.StdoutFile); err != nil {
+			r.Logger.Fatalf("failed to store filtered stdout: %v", err)
+		}
+	}
+	if stderrChanged {
+		var err error
+		if result.Stderr, result.StderrFile, err = r.storeOutput(stderr, result.StderrFile); err != nil {
+			r.Logger.Fatalf("failed to store filtered stderr: %v", err)
+		}
 	}
+
+	result.ConditionMatched = conditionMatched
+	result.GrepMatches = grepMatches
+	result.HasErr = hasErr
+	result.NeedToPrintErr = needToPrintErr
+	result.NeedToPrintStdout = needToPrintStdout
+	result.NeedToPrintStderr = needToPrintStderr
+	result.NeedToPrintAnything = needToPrintErr || needToPrintStdout || needToPrintStderr
 }
 
 func (r *Run) processOne(taskItem *Target) {
@@ -73,26 +197,67 @@ func (r *Run) processOne(taskItem *Target) {
 	r.Lock.Lock()
 	defer r.Lock.Unlock()
 
-	if result.NeedToPrintAnything {
-		fmt.Println()
-		fmt.Println()
-		fmt.Println(utils.Style.Dim.Render("---"))
-		fmt.Println(utils.Style.Text.Render(fmt.Sprintf("TASK START: %s (%d/%d)", taskItem.ID, taskItem.Index, len(r.Options.Targets))))
+	r.Results[taskItem.ID] = *result
+
+	if !r.Options.Ordered {
+		r.printResult(result)
+		return
+	}
+
+	// In ordered mode, results are buffered until all targets before them are printed
+	r.PendingResults[taskItem.Index] = result
+	for {
+		next, ok := r.PendingResults[r.NextIndex]
+		if !ok {
+			break
+		}
+		delete(r.PendingResults, r.NextIndex)
+		r.printResult(next)
+		r.NextIndex++
+	}
+}
+
+// printResult prints the result to stdout and saves it to output file and directory,
+// the caller must hold the lock.
+func (r *Run) printResult(result *TaskResult) {
+	taskItem := result.TaskItem
+
+	// the result template replaces the styled output, but output file and directory are the same
+	styled := r.Options.ResultTemplate == nil
+
+	// stdout is not printed per target if it's shown in an aggregated view after the run,
+	// but it's still saved to output file and directory
+	printStdout := styled && result.NeedToPrintStdout && !r.aggregatesStdout()
+	printAnything := styled && (result.NeedToPrintErr || printStdout || result.NeedToPrintStderr)
+
+	if printAnything {
+		fmt.Fprintln(r.Out)
+		fmt.Fprintln(r.Out)
+		fmt.Fprintln(r.Out, utils.Style.Dim.Render("---"))
+		fmt.Fprintln(r.Out, utils.Style.Text.Render(fmt.Sprintf("TASK START: %s (%d/%d)", taskItem.ID, taskItem.Index, len(r.Options.Targets))))
 	}
 
-	if result.NeedToPrintErr {
-		fmt.Println(utils.Style.Warning.Render("ERROR:"))
-		fmt.Println(utils.Style.Warning.Render(result.Err))
+	if printAnything && result.Redactions > 0 {
+		fmt.Fprintln(r.Out, utils.Style.Dim.Render(fmt.Sprintf("REDACTED: %d secrets are masked", result.Redactions)))
+	}
+
+	if styled && result.NeedToPrintErr {
+		fmt.Fprintln(r.Out, utils.Style.Warning.Render(fmt.Sprintf("ERROR (%s):", result.ErrorCategory)))
+		fmt.Fprintln(r.Out, utils.Style.Warning.Render(result.Err))
 	}
 
 	// if there is an error, print stderr for troubleshooting
-	if result.NeedToPrintStderr {
-		fmt.Println(utils.Style.Warning.Render("STDERR:"))
-		fmt.Println(utils.Style.Warning.Render(strings.TrimSpace(string(result.Stderr))))
+	if styled && result.NeedToPrintStderr {
+		fmt.Fprintln(r.Out, utils.Style.Warning.Render("STDERR:"))
+		fmt.Fprintln(r.Out, utils.Style.Warning.Render(strings.TrimSpace(result.FullStderr())))
 	}
 
 	// JSON doesn't support multi documents, need to write after merging all results
-	if r.Options.OutputFile != "" && r.Options.OutputFormat != "json" {
+	if r.OutputWriter != nil && r.Options.OutputFormat == "ndjson" {
+		if err := r.writeNDJSONRecord(NDJSONRecord{Type: NDJSONRecordResult, Result: result}); err != nil {
+			r.Logger.Fatalf("failed to append result to file: %v", err)
+		}
+	} else if r.OutputWriter != nil && r.Options.OutputFormat != "json" && !utils.IsDelimitedFormat(r.Options.OutputFormat) && !utils.IsReportFormat(r.Options.OutputFormat) {
 		var output string
 		if r.Options.OutputFormat == "yaml" || r.Options.OutputFormat == "yml" {
 			yamlContent, err := result.ToYAMLInMultiDoc()
@@ -104,22 +269,19 @@ func (r *Run) processOne(taskItem *Target) {
 			output = result.ToText(len(r.Options.Targets))
 		}
 
-		f, err := os.OpenFile(r.Options.OutputFile, os.O_APPEND|os.O_WRONLY, 0600)
-		if err != nil {
-			r.Logger.Fatalf("failed to open output file: %v", err)
-		}
-		defer f.Close()
-
-		if _, err := f.Write([]byte(output)); err != nil {
+		if _, err := r.OutputWriter.Write([]byte(output)); err != nil {
 			r.Logger.Fatalf("failed to append result to file: %v", err)
 		}
 	}
 
 	if r.Options.OutputDir != "" {
 		ext := utils.FileExt(r.Options.OutputFormat)
-		errFile := path.Join(r.Options.OutputDir, result.TaskItem.ID+".err"+ext)
-		stdoutFile := path.Join(r.Options.OutputDir, result.TaskItem.ID+".stdout"+ext)
-		stderrFile := path.Join(r.Options.OutputDir, result.TaskItem.ID+".stderr"+ext)
+		if utils.IsDelimitedFormat(r.Options.OutputFormat) || utils.IsReportFormat(r.Options.OutputFormat) {
+			ext = utils.FileExt("text") // all targets are rendered in the summary file, raw outputs are saved as text
+		}
+		errFile := path.Join(r.OutputDir, result.TaskItem.ID+".err"+ext)
+		stdoutFile := path.Join(r.OutputDir, result.TaskItem.ID+".stdout"+ext)
+		stderrFile := path.Join(r.OutputDir, result.TaskItem.ID+".stderr"+ext)
 
 		if result.NeedToPrintErr {
 			if err := utils.PutFileWithFormat(errFile, result.Err, r.Options.OutputFormat, func() string {
@@ -130,37 +292,91 @@ func (r *Run) processOne(taskItem *Target) {
 		}
 
 		if result.NeedToPrintStdout {
-			if err := utils.PutFileWithFormat(stdoutFile, result.Stdout, r.Options.OutputFormat, func() string {
-				return result.Stdout
+			stdout := result.FullStdout()
+			if err := utils.PutFileWithFormat(stdoutFile, stdout, r.Options.OutputFormat, func() string {
+				return stdout
 			}); err != nil {
 				r.Logger.Fatalf("failed to write stdout to file: %v", err)
 			}
 		}
 
 		if result.NeedToPrintStderr {
-			if err := utils.PutFileWithFormat(stderrFile, result.Stderr, r.Options.OutputFormat, func() string {
-				return result.Stderr
+			stderr := result.FullStderr()
+			if err := utils.PutFileWithFormat(stderrFile, stderr, r.Options.OutputFormat, func() string {
+				return stderr
 			}); err != nil {
 				r.Logger.Fatalf("failed to write stderr to file: %v", err)
 			}
 		}
 	}
 
-	if result.NeedToPrintStdout {
-		fmt.Println(utils.Style.Info.Render("STDOUT:"))
-		fmt.Println(utils.Style.Info.Render(strings.TrimSpace(string(result.Stdout))))
+	if printStdout {
+		if result.QueryResults != nil {
+			fmt.Fprintln(r.Out, utils.Style.Info.Render("QUERY RESULT:"))
+			fmt.Fprintln(r.Out, utils.Style.Info.Render(formatQueryResults(result.QueryResults)))
+		} else if r.Options.Grep != nil || r.Options.GrepInvert != nil {
+			fmt.Fprintln(r.Out, utils.Style.Info.Render("STDOUT:"))
+			fmt.Fprintln(r.Out, r.highlightGrepMatches(result.FullStdout()))
+		} else {
+			fmt.Fprintln(r.Out, utils.Style.Info.Render("STDOUT:"))
+			fmt.Fprintln(r.Out, utils.Style.Info.Render(strings.TrimSpace(result.FullStdout())))
+		}
 	}
 
-	if result.NeedToPrintAnything {
-		fmt.Println(utils.Style.Text.Render(fmt.Sprintf("TASK END: %s (%d/%d)", taskItem.ID, taskItem.Index, len(r.Options.Targets))))
-		fmt.Println(utils.Style.Dim.Render("---"))
+	if printAnything {
+		fmt.Fprintln(r.Out, utils.Style.Text.Render(fmt.Sprintf("TASK END: %s (%d/%d)", taskItem.ID, taskItem.Index, len(r.Options.Targets))))
+		fmt.Fprintln(r.Out, utils.Style.Dim.Render("---"))
 	}
 
-	r.Results[taskItem.ID] = *result
+	if !styled && result.NeedToPrintAnything {
+		output, err := r.renderResultTemplate(result)
+		if err != nil {
+			r.Logger.Fatalf("%v", err)
+		}
+		fmt.Fprint(r.Out, output)
+	}
+}
+
+// aggregatesStdout returns true if stdout of all targets is shown in an aggregated view after the run
+func (r *Run) aggregatesStdout() bool {
+	return r.Options.MergeTable || r.Options.GroupIdentical || r.Options.QueryCombine || r.Options.Aggregate != nil
+}
+
+// newSpillBuffer creates a buffer for kubectl output, which is spilled to a file under the spill directory
+// once it grows beyond the spill threshold, so that memory usage is bounded with large outputs
+func (r *Run) newSpillBuffer(name string) *utils.SpillBuffer {
+	return &utils.SpillBuffer{
+		Threshold:   r.Options.SpillThreshold,
+		PreviewSize: SpillPreviewSize,
+		Path:        path.Join(r.SpillDir, name),
+	}
+}
+
+// storeOutput keeps the filtered output of a spilled one in its spill file, and returns what's kept in memory and the file,
+// outputs which are no longer above the spill threshold are kept in memory and the spill file is removed
+func (r *Run) storeOutput(output, file string) (string, string, error) {
+	if file == "" {
+		return output, "", nil
+	}
+	if len(output) <= r.Options.SpillThreshold {
+		if err := os.Remove(file); err != nil {
+			return "", "", fmt.Errorf("failed to remove spill file %s: %v", file, err)
+		}
+		return output, "", nil
+	}
+	if err := os.WriteFile(file, []byte(output), 0600); err != nil {
+		return "", "", fmt.Errorf("failed to write spill file %s: %v", file, err)
+	}
+	return utils.HeadUTF8(output, SpillPreviewSize), file, nil
+}
+
+// filtersStdout returns true if stdout is masked, matched or filtered, so that it has to be read back if it's spilled
+func (r *Run) filtersStdout() bool {
+	return r.Options.Redactor != nil || r.Options.OutputCondition != nil || r.Options.Query != nil || r.Options.Aggregate != nil ||
+		r.Options.Grep != nil || r.Options.GrepInvert != nil
 }
 
 func (r *Run) startWorker(stopCh <-chan struct{}) {
-	r.Wg.Add(1)
 	defer r.Wg.Done()
 
 	for {
@@ -168,11 +384,6 @@ func (r *Run) startWorker(stopCh <-chan struct{}) {
 		case <-stopCh:
 			return
 		case taskItem := <-r.NextTarget:
-			r.Lock.Lock()
-			r.Counter++
-			r.Lock.Unlock()
-
-			taskItem.Index = r.Counter
 			r.processOne(taskItem)
 		}
 	}
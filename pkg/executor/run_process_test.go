@@ -0,0 +1,153 @@
+package executor
+
+import (
+	"os"
+	"path"
+	"regexp"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestFilterResultKeepsSpilledOutputOnDisk(t *testing.T) {
+	var lines []string
+	for i := range 200 {
+		if i%2 == 0 {
+			lines = append(lines, "pod-even-running Running")
+		} else {
+			lines = append(lines, "pod-odd-failed CrashLoopBackOff")
+		}
+	}
+	stdout := strings.Join(lines, "\n") + "\n"
+
+	tests := []struct {
+		name       string
+		grep       string
+		wantSpill  bool
+		wantOutput string
+	}{
+		{
+			name:       "filtered output above the threshold stays in the spill file",
+			grep:       "Running",
+			wantSpill:  true,
+			wantOutput: strings.Repeat("pod-even-running Running\n", 100),
+		},
+		{
+			name:       "filtered output below the threshold is kept in memory",
+			grep:       "nothing",
+			wantSpill:  false,
+			wantOutput: "",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			spillFile := path.Join(t.TempDir(), "a.stdout.spill")
+			if err := os.WriteFile(spillFile, []byte(stdout), 0600); err != nil {
+				t.Fatal(err)
+			}
+			r := NewRun(&RunOptions{SpillThreshold: 64, Grep: regexp.MustCompile(tt.grep), PrintStdout: true})
+			result := &TaskResult{
+				TaskItem:   &Target{ID: "a"},
+				Stdout:     stdout[:SpillPreviewSize],
+				StdoutFile: spillFile,
+				HasStdout:  true,
+			}
+			r.filterResult(result)
+
+			if got := result.FullStdout(); got != tt.wantOutput {
+				t.Errorf("FullStdout() = %q, want %q", got, tt.wantOutput)
+			}
+			_, statErr := os.Stat(spillFile)
+			if tt.wantSpill {
+				if result.StdoutFile != spillFile || statErr != nil {
+					t.Errorf("StdoutFile = %q (%v), want the spill file %s", result.StdoutFile, statErr, spillFile)
+				}
+				if len(result.Stdout) > SpillPreviewSize {
+					t.Errorf("%d bytes of stdout are kept in memory, want at most %d", len(result.Stdout), SpillPreviewSize)
+				}
+			} else if result.StdoutFile != "" || !os.IsNotExist(statErr) {
+				t.Errorf("StdoutFile = %q (%v), want no spill file", result.StdoutFile, statErr)
+			}
+		})
+	}
+}
+
+func TestFilterResultSuppressWarningsKeepsErrors(t *testing.T) {
+	stderr := "Warning: v1 ComponentStatus is deprecated in v1.19+\n" +
+		"error: You must be logged in to the server (Unauthorized)\n"
+
+	for _, suppressed := range [][]string{nil, {WarningCategoryDeprecation, WarningCategoryThrottling, WarningCategoryOther}} {
+		r := NewRun(&RunOptions{SuppressWarnings: suppressed})
+		result := &TaskResult{
+			TaskItem:  &Target{ID: "a"},
+			Stderr:    stderr,
+			Err:       "exit status 1",
+			ExitCode:  1,
+			HasErr:    true,
+			HasStderr: true,
+		}
+		r.filterResult(result)
+
+		if result.ErrorCategory != ErrorCategoryAuth {
+			t.Errorf("suppressing %v: ErrorCategory = %q, want %q", suppressed, result.ErrorCategory, ErrorCategoryAuth)
+		}
+		if got, want := result.ErrorMessage(), "error: You must be logged in to the server (Unauthorized)"; got != want {
+			t.Errorf("suppressing %v: ErrorMessage() = %q, want %q", suppressed, got, want)
+		}
+		if !strings.Contains(result.FullStderr(), "Unauthorized") {
+			t.Errorf("suppressing %v: the error is removed from stderr %q", suppressed, result.FullStderr())
+		}
+		if len(result.StderrWarnings) != 1 || result.StderrWarnings[0].Category != WarningCategoryDeprecation {
+			t.Errorf("suppressing %v: StderrWarnings = %v, want the deprecation warning only", suppressed, result.StderrWarnings)
+		}
+	}
+}
+
+func TestFilterResultWithoutFiltersKeepsSpilledStdout(t *testing.T) {
+	stdout := strings.Repeat("pod-a   Running\n", 1000)
+	spillFile := path.Join(t.TempDir(), "a.stdout.spill")
+	if err := os.WriteFile(spillFile, []byte(stdout), 0600); err != nil {
+		t.Fatal(err)
+	}
+	r := NewRun(&RunOptions{SpillThreshold: 64, PrintStdout: true})
+	if r.filtersStdout() {
+		t.Fatal("filtersStdout() = true without any filter")
+	}
+	preview := stdout[:SpillPreviewSize]
+	result := &TaskResult{TaskItem: &Target{ID: "a"}, Stdout: preview, StdoutFile: spillFile, HasStdout: true}
+	r.filterResult(result)
+
+	if result.Stdout != preview || result.StdoutFile != spillFile || !result.NeedToPrintStdout {
+		t.Errorf("result = %q (%s, print %v), want the preview and the spill file", result.Stdout[:20], result.StdoutFile, result.NeedToPrintStdout)
+	}
+	if got := result.FullStdout(); got != stdout {
+		t.Errorf("FullStdout() has %d bytes, want %d", len(got), len(stdout))
+	}
+
+	for _, opts := range []*RunOptions{
+		{Redactor: NewRedactor(nil)},
+		{Grep: regexp.MustCompile("a")},
+		{GrepInvert: regexp.MustCompile("a")},
+		{Aggregate: &Aggregate{Func: AggregateCount}},
+	} {
+		if !NewRun(opts).filtersStdout() {
+			t.Errorf("filtersStdout() = false with %+v", opts)
+		}
+	}
+}
+
+func TestStoreOutputPreviewUTF8(t *testing.T) {
+	output := "ab" + strings.Repeat("世", SpillPreviewSize) // 世 is 3 bytes, so the preview size falls in the middle of it
+	spillFile := path.Join(t.TempDir(), "a.stdout.spill")
+	if err := os.WriteFile(spillFile, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	r := NewRun(&RunOptions{SpillThreshold: 64})
+	preview, file, err := r.storeOutput(output, spillFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if file != spillFile || !utf8.ValidString(preview) || len(preview) != SpillPreviewSize-2 || !strings.HasPrefix(output, preview) {
+		t.Errorf("storeOutput() = %d bytes (valid UTF-8: %v) in %s, want %d bytes", len(preview), utf8.ValidString(preview), file, SpillPreviewSize-2)
+	}
+}
@@ -11,28 +11,76 @@ type RunSummary struct {
 	Errors     []TaskResult `json:"errorTasks" yaml:"errors"`
 	ErrorCount int          `json:"errorCount" yaml:"errorCount"`
 
+	// ErrorGroups are the errors grouped by category and normalized message, biggest group first
+	ErrorGroups []ErrorGroup `json:"errorGroups" yaml:"errorGroups"`
+
 	Warnings     []TaskResult `json:"warningTasks" yaml:"warnings"`
 	WarningCount int          `json:"warningCount" yaml:"warningCount"`
 
+	// WarningCategories is the number of targets with stderr warnings of each category, including suppressed ones
+	WarningCategories map[string]int `json:"warningCategories" yaml:"warningCategories"`
+
 	TotalCount int `json:"totalCount" yaml:"totalCount"`
+
+	// Aggregate is the fleet-wide value of the aggregate, only set when running with an aggregate
+	Aggregate *AggregateSummary `json:"aggregate,omitempty" yaml:"aggregate,omitempty"`
+
+	// results are all results in target order, they are not marshaled but used to render reports
+	results []TaskResult
+}
+
+// NewRunSummary creates the summary of results, which must be sorted by target index
+func NewRunSummary(results []*TaskResult) RunSummary {
+	summary := RunSummary{
+		Errors:     []TaskResult{},
+		Warnings:   []TaskResult{},
+		TotalCount: len(results),
+		results:    make([]TaskResult, 0, len(results)),
+	}
+	for _, result := range results {
+		summary.results = append(summary.results, *result)
+		if result.NeedToPrintErr {
+			summary.ErrorCount++
+			summary.Errors = append(summary.Errors, *result)
+		}
+		if result.NeedToPrintStderr {
+			summary.WarningCount++
+			summary.Warnings = append(summary.Warnings, *result)
+		}
+	}
+	summary.ErrorGroups = groupErrors(summary.Errors)
+	summary.WarningCategories = countWarningCategories(summary.results)
+	return summary
+}
+
+// SuccessCount returns the number of targets without error, including the ones with warnings
+func (s *RunSummary) SuccessCount() int {
+	return s.TotalCount - s.ErrorCount
+}
+
+// Results returns all results in target order
+func (s *RunSummary) Results() []TaskResult {
+	return s.results
 }
 
 func (s *RunSummary) ToText() string {
 	text := "SUMMARY:\n"
 
+	for _, group := range s.ErrorGroups {
+		text += fmt.Sprintf("- %s error: %s\n", group.Category, group.Message)
+		text += fmt.Sprintf("  targets (%d): %s\n", len(group.Targets), strings.Join(group.Targets, ", "))
+	}
+
+	errClusters := map[string]bool{} // we keep this map to avoid duplicated warning messages
 	for _, result := range s.Errors {
-		stderrStub := ""
-		if len(result.Stderr) > 0 {
-			stderrStub = ", stderr:"
-		}
-		text += fmt.Sprintf("- %s: error: %v%s\n", result.TaskItem.ID, result.Err, stderrStub)
-		if len(result.Stderr) > 0 {
-			text += strings.TrimSpace(string(result.Stderr)) + "\n"
-		}
+		errClusters[result.TaskItem.ID] = true
 	}
 
 	for _, result := range s.Warnings {
-		text += fmt.Sprintf("- %s: stderr: %s\n", result.TaskItem.ID, strings.TrimSpace(string(result.Stderr)))
+		if errClusters[result.TaskItem.ID] { // the stderr is summarized in the error groups
+			continue
+		}
+		text += fmt.Sprintf("- %s: stderr: %s\n", result.TaskItem.ID, strings.TrimSpace(result.FullStderr()))
 	}
 
 	text += fmt.Sprintf("%d successful (%d with warnings), %d error, %d total\n",
@@ -41,6 +89,12 @@ func (s *RunSummary) ToText() string {
 		s.ErrorCount,
 		s.TotalCount,
 	)
+	if len(s.WarningCategories) > 0 {
+		text += fmt.Sprintf("stderr warnings: %s\n", formatWarningCategories(s.WarningCategories))
+	}
+	if s.Aggregate != nil {
+		text += "---\n" + s.Aggregate.ToText(s.results)
+	}
 
 	return text
 }
@@ -56,29 +110,24 @@ func (s *RunSummary) ToStyledText() []utils.StyleText {
 
 	for _, result := range s.Errors {
 		errClusters[result.TaskItem.ID] = true
+	}
 
-		stderrStub := ""
-		if len(result.Stderr) > 0 {
-			stderrStub = ", stderr:"
-		}
+	for _, group := range s.ErrorGroups {
 		summaryLines = append(summaryLines, utils.StyleText{
-			Text:  fmt.Sprintf("- %s: error: %v%s", result.TaskItem.ID, result.Err, stderrStub),
+			Text:  fmt.Sprintf("- %s error: %s", group.Category, group.Message),
 			Style: &utils.Style.Warning,
+		}, utils.StyleText{
+			Text:  fmt.Sprintf("  targets (%d): %s", len(group.Targets), strings.Join(group.Targets, ", ")),
+			Style: &utils.Style.Dim,
 		})
-		if len(result.Stderr) > 0 {
-			summaryLines = append(summaryLines, utils.StyleText{
-				Text:  strings.TrimSpace(string(result.Stderr)),
-				Style: &utils.Style.Warning,
-			})
-		}
 	}
 
 	for _, result := range s.Warnings {
-		if errClusters[result.TaskItem.ID] { // the warning should already be printed in the error section
+		if errClusters[result.TaskItem.ID] { // the stderr is summarized in the error groups
 			continue
 		}
 		summaryLines = append(summaryLines, utils.StyleText{
-			Text:  fmt.Sprintf("- %s: stderr: %s", result.TaskItem.ID, strings.TrimSpace(string(result.Stderr))),
+			Text:  fmt.Sprintf("- %s: stderr: %s", result.TaskItem.ID, strings.TrimSpace(result.FullStderr())),
 			Style: &utils.Style.Warning,
 		})
 	}
@@ -92,6 +141,12 @@ func (s *RunSummary) ToStyledText() []utils.StyleText {
 		),
 		Style: &utils.Style.Text,
 	})
+	if len(s.WarningCategories) > 0 {
+		summaryLines = append(summaryLines, utils.StyleText{
+			Text:  "stderr warnings: " + formatWarningCategories(s.WarningCategories),
+			Style: &utils.Style.Dim,
+		})
+	}
 
 	return summaryLines
 }
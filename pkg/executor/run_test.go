@@ -0,0 +1,71 @@
+package executor
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path"
+	"regexp"
+	"slices"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+)
+
+// sleepyKubectl puts a fake kubectl on PATH which prints the context after sleeping for the seconds after the dash
+// in the context name, e.g. "a-0.4" sleeps 0.4 seconds, so that targets finish in a known order
+func sleepyKubectl(t *testing.T) {
+	t.Helper()
+	dir := t.TempDir()
+	script := "#!/bin/sh\nwhile [ $# -gt 0 ]; do\n  if [ \"$1\" = --context ]; then ctx=$2; fi\n  shift\ndone\nsleep ${ctx#*-}\necho \"pod-$ctx   Running\"\n"
+	if err := os.WriteFile(path.Join(dir, "kubectl"), []byte(script), 0700); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+}
+
+func TestRunOrder(t *testing.T) {
+	sleepyKubectl(t)
+	a, b, c := NewTarget("kc.yaml", "a-0.4"), NewTarget("kc.yaml", "b-0.2"), NewTarget("kc.yaml", "c-0")
+
+	tests := []struct {
+		name    string
+		targets []Target
+		ordered bool
+		orderBy string
+		want    []string
+	}{
+		{name: "completion order", targets: []Target{a, b, c}, want: []string{c.ID, b.ID, a.ID}},
+		{name: "ordered", targets: []Target{a, b, c}, ordered: true, want: []string{a.ID, b.ID, c.ID}},
+		{name: "ordered by context", targets: []Target{b, c, a}, ordered: true, orderBy: OrderByContext, want: []string{a.ID, b.ID, c.ID}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logger := logrus.New()
+			logger.SetOutput(io.Discard)
+			r := NewRun(&RunOptions{
+				Targets:      tt.targets,
+				Args:         []string{"get", "pods"},
+				Workers:      len(tt.targets),
+				OutputFormat: "text",
+				PrintStdout:  true,
+				Ordered:      tt.ordered,
+				OrderBy:      tt.orderBy,
+				Logger:       logger,
+			})
+			var out bytes.Buffer
+			r.Out = &out
+			if err := r.Run(); err != nil {
+				t.Fatal(err)
+			}
+
+			var got []string
+			for _, m := range regexp.MustCompile(`TASK START: (\S+)`).FindAllStringSubmatch(out.String(), -1) {
+				got = append(got, m[1])
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("printed targets = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,114 @@
+package executor
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+const (
+	WarningCategoryDeprecation = "deprecation"
+	WarningCategoryThrottling  = "throttling"
+	WarningCategoryOther       = "other"
+)
+
+// WarningCategories are all warning categories, in display order
+var WarningCategories = []string{WarningCategoryDeprecation, WarningCategoryThrottling, WarningCategoryOther}
+
+// StderrWarning is a warning line of stderr, classified by what it's about
+type StderrWarning struct {
+	Category string `json:"category" yaml:"category"`
+	Message  string `json:"message" yaml:"message"`
+}
+
+// classifyStderrLine returns the warning category of a stderr line, one of WarningCategory*
+func classifyStderrLine(line string) string {
+	lower := strings.ToLower(line)
+	switch {
+	case strings.Contains(lower, "deprecated"):
+		// e.g. "Warning: policy/v1beta1 PodSecurityPolicy is deprecated in v1.21+, unavailable in v1.25+"
+		return WarningCategoryDeprecation
+	case strings.Contains(lower, "throttling"):
+		// e.g. "Waited for 1.0s due to client-side throttling, not priority and fairness, request: GET:https://..."
+		return WarningCategoryThrottling
+	default:
+		return WarningCategoryOther
+	}
+}
+
+// stderrWarning returns the message of a stderr line without the klog prefix, and true if the line is a warning,
+// which is a "Warning:" line, or an info or warning line of klog, e.g. of client-side throttling,
+// other lines, e.g. "error: ..." or klog errors, are never warnings
+func stderrWarning(line string) (string, bool) {
+	line = strings.TrimSpace(line)
+	message := strings.TrimSpace(klogPrefixRegex.ReplaceAllString(line, ""))
+	if message == "" {
+		return "", false
+	}
+	if message != line {
+		return message, line[0] == 'I' || line[0] == 'W'
+	}
+	return message, strings.HasPrefix(message, "Warning:")
+}
+
+// ParseStderrWarnings returns the warning lines of stderr, klog prefixes are removed from messages
+func ParseStderrWarnings(stderr string) []StderrWarning {
+	var warnings []StderrWarning
+	for _, line := range strings.Split(stderr, "\n") {
+		if message, ok := stderrWarning(line); ok {
+			warnings = append(warnings, StderrWarning{Category: classifyStderrLine(message), Message: message})
+		}
+	}
+	return warnings
+}
+
+// suppressStderrLines returns stderr without the warning lines of the suppressed categories, other lines are kept
+func suppressStderrLines(stderr string, suppressed []string) string {
+	var lines []string
+	for _, line := range strings.Split(strings.TrimRight(stderr, "\n"), "\n") {
+		if message, ok := stderrWarning(line); ok && slices.Contains(suppressed, classifyStderrLine(message)) {
+			continue
+		}
+		lines = append(lines, line)
+	}
+	if strings.TrimSpace(strings.Join(lines, "")) == "" {
+		return ""
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// validateWarningCategories returns an error if any of the categories is unknown
+func validateWarningCategories(categories []string) error {
+	for _, category := range categories {
+		if !slices.Contains(WarningCategories, category) {
+			return fmt.Errorf("unknown warning category %q, must be one of: %s", category, strings.Join(WarningCategories, ", "))
+		}
+	}
+	return nil
+}
+
+// countWarningCategories returns the number of results with warnings of each category
+func countWarningCategories(results []TaskResult) map[string]int {
+	counts := map[string]int{}
+	for _, result := range results {
+		seen := map[string]bool{}
+		for _, warning := range result.StderrWarnings {
+			if !seen[warning.Category] {
+				seen[warning.Category] = true
+				counts[warning.Category]++
+			}
+		}
+	}
+	return counts
+}
+
+// formatWarningCategories returns the counts in display order, e.g. "2 deprecation, 1 other"
+func formatWarningCategories(counts map[string]int) string {
+	var parts []string
+	for _, category := range WarningCategories {
+		if counts[category] > 0 {
+			parts = append(parts, fmt.Sprintf("%d %s", counts[category], category))
+		}
+	}
+	return strings.Join(parts, ", ")
+}
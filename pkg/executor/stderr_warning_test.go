@@ -0,0 +1,81 @@
+package executor
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseStderrWarnings(t *testing.T) {
+	tests := []struct {
+		name   string
+		stderr string
+		want   []StderrWarning
+	}{
+		{
+			name:   "deprecation",
+			stderr: "Warning: policy/v1beta1 PodSecurityPolicy is deprecated in v1.21+, unavailable in v1.25+\n",
+			want:   []StderrWarning{{Category: WarningCategoryDeprecation, Message: "Warning: policy/v1beta1 PodSecurityPolicy is deprecated in v1.21+, unavailable in v1.25+"}},
+		},
+		{
+			name:   "throttling of klog",
+			stderr: "I1019 02:00:00.123456   12345 request.go:697] Waited for 1.18s due to client-side throttling, not priority and fairness, request: GET:https://10.0.0.1/api/v1/pods\n",
+			want:   []StderrWarning{{Category: WarningCategoryThrottling, Message: "Waited for 1.18s due to client-side throttling, not priority and fairness, request: GET:https://10.0.0.1/api/v1/pods"}},
+		},
+		{
+			name:   "other warning",
+			stderr: "Warning: resource pods/web is missing the kubectl.kubernetes.io/last-applied-configuration annotation\n",
+			want:   []StderrWarning{{Category: WarningCategoryOther, Message: "Warning: resource pods/web is missing the kubectl.kubernetes.io/last-applied-configuration annotation"}},
+		},
+		{
+			name: "errors are not warnings",
+			stderr: "Warning: v1 ComponentStatus is deprecated in v1.19+\n" +
+				"E1019 02:00:00.123456   12345 memcache.go:265] couldn't get current server API group list: Get \"https://10.0.0.1/api\": dial tcp 10.0.0.1:443: connect: connection refused\n" +
+				"error: You must be logged in to the server (Unauthorized)\n" +
+				"Error from server (NotFound): pods \"web\" not found\n",
+			want: []StderrWarning{{Category: WarningCategoryDeprecation, Message: "Warning: v1 ComponentStatus is deprecated in v1.19+"}},
+		},
+		{
+			name:   "empty",
+			stderr: "\n  \n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ParseStderrWarnings(tt.stderr); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseStderrWarnings() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSuppressStderrLines(t *testing.T) {
+	stderr := "Warning: v1 ComponentStatus is deprecated in v1.19+\n" +
+		"I1019 02:00:00.123456   12345 request.go:697] Waited for 1.18s due to client-side throttling, not priority and fairness\n" +
+		"Warning: something else\n" +
+		"error: You must be logged in to the server (Unauthorized)\n"
+
+	tests := []struct {
+		suppressed []string
+		want       string
+	}{
+		{
+			suppressed: []string{WarningCategoryDeprecation},
+			want: "I1019 02:00:00.123456   12345 request.go:697] Waited for 1.18s due to client-side throttling, not priority and fairness\n" +
+				"Warning: something else\n" +
+				"error: You must be logged in to the server (Unauthorized)\n",
+		},
+		{
+			suppressed: []string{WarningCategoryDeprecation, WarningCategoryThrottling, WarningCategoryOther},
+			want:       "error: You must be logged in to the server (Unauthorized)\n",
+		},
+	}
+	for _, tt := range tests {
+		if got := suppressStderrLines(stderr, tt.suppressed); got != tt.want {
+			t.Errorf("suppressStderrLines(%v) = %q, want %q", tt.suppressed, got, tt.want)
+		}
+	}
+
+	if got := suppressStderrLines("Warning: v1 ComponentStatus is deprecated in v1.19+\n", []string{WarningCategoryDeprecation}); got != "" {
+		t.Errorf("suppressStderrLines() = %q, want empty", got)
+	}
+}
@@ -0,0 +1,211 @@
+package executor
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/lipgloss/table"
+	"github.com/junchaw/kubekraken/pkg/utils"
+)
+
+const (
+	SummaryViewText  = "text"
+	SummaryViewTable = "table"
+)
+
+// summaryTableRow is a row of the summary table, the number of stdout lines is counted once,
+// as stdout may be spilled to disk, and reading it back in every comparison of sorting is expensive
+type summaryTableRow struct {
+	*TaskResult
+	Lines int
+}
+
+// summaryTableColumn is a column of the summary table, rows are sorted by Compare instead of the rendered cells,
+// so that e.g. durations and statuses are in their natural order
+type summaryTableColumn struct {
+	Name    string
+	Cell    func(r *summaryTableRow) string
+	Compare func(a, b *summaryTableRow) int
+}
+
+// summaryTableColumns are the columns of the summary table, in display order
+var summaryTableColumns = []summaryTableColumn{
+	{"STATUS", func(r *summaryTableRow) string { return statusIcon(r.TaskResult) }, func(a, b *summaryTableRow) int {
+		return cmp.Compare(statusRank(a.TaskResult), statusRank(b.TaskResult))
+	}},
+	{"TARGET", func(r *summaryTableRow) string { return r.TaskItem.ID }, func(a, b *summaryTableRow) int { return strings.Compare(a.TaskItem.ID, b.TaskItem.ID) }},
+	{"EXIT", func(r *summaryTableRow) string { return fmt.Sprint(r.ExitCode) }, func(a, b *summaryTableRow) int { return cmp.Compare(a.ExitCode, b.ExitCode) }},
+	{"DURATION", func(r *summaryTableRow) string { return fmt.Sprintf("%.3fs", r.Duration.Seconds()) }, func(a, b *summaryTableRow) int { return cmp.Compare(a.Duration, b.Duration) }},
+	{"LINES", func(r *summaryTableRow) string { return fmt.Sprint(r.Lines) }, func(a, b *summaryTableRow) int { return cmp.Compare(a.Lines, b.Lines) }},
+	{"STDERR", func(r *summaryTableRow) string { return stderrCategory(r.TaskResult) }, func(a, b *summaryTableRow) int {
+		return strings.Compare(stderrCategory(a.TaskResult), stderrCategory(b.TaskResult))
+	}},
+	{"MATCHED", func(r *summaryTableRow) string { return matchedCell(r.TaskResult) }, func(a, b *summaryTableRow) int {
+		return strings.Compare(matchedCell(a.TaskResult), matchedCell(b.TaskResult))
+	}},
+}
+
+// statusIcon returns the icon of the status of the result
+func statusIcon(r *TaskResult) string {
+	switch r.Status() {
+	case TaskStatusError:
+		return "✗"
+	case TaskStatusWarning:
+		return "!"
+	default:
+		return "✓"
+	}
+}
+
+// statusRank orders statuses by severity, success first
+func statusRank(r *TaskResult) int {
+	switch r.Status() {
+	case TaskStatusError:
+		return 2
+	case TaskStatusWarning:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// stdoutLineCount returns the number of lines of stdout, after filtering
+func stdoutLineCount(r *TaskResult) int {
+	stdout := strings.TrimRight(r.FullStdout(), "\n")
+	if stdout == "" {
+		return 0
+	}
+	return strings.Count(stdout, "\n") + 1
+}
+
+// stderrCategory returns the error category of a failed result, or the warning categories of stderr, "-" if there is none
+func stderrCategory(r *TaskResult) string {
+	if r.HasErr {
+		return r.ErrorCategory
+	}
+	counts := countWarningCategories([]TaskResult{*r})
+	var categories []string
+	for _, category := range WarningCategories {
+		if counts[category] > 0 {
+			categories = append(categories, category)
+		}
+	}
+	if len(categories) == 0 {
+		return "-"
+	}
+	return strings.Join(categories, ",")
+}
+
+func matchedCell(r *TaskResult) string {
+	if r.ConditionMatched {
+		return "yes"
+	}
+	return "-"
+}
+
+// validateSummaryView returns an error if the view or any of the sort columns is unknown,
+// sort columns are case-insensitive and may be prefixed with "-" for descending order
+func validateSummaryView(view string, sortBy []string) error {
+	switch view {
+	case "", SummaryViewText, SummaryViewTable:
+	default:
+		return fmt.Errorf("unknown summary view %q, must be one of: %s, %s", view, SummaryViewText, SummaryViewTable)
+	}
+	for _, column := range sortBy {
+		if summaryTableColumnIndex(strings.TrimPrefix(column, "-")) < 0 {
+			names := make([]string, 0, len(summaryTableColumns))
+			for _, c := range summaryTableColumns {
+				names = append(names, c.Name)
+			}
+			return fmt.Errorf("unknown summary sort column %q, must be one of: %s", column, strings.Join(names, ", "))
+		}
+	}
+	return nil
+}
+
+func summaryTableColumnIndex(name string) int {
+	return slices.IndexFunc(summaryTableColumns, func(c summaryTableColumn) bool {
+		return strings.EqualFold(c.Name, name)
+	})
+}
+
+// ToTable renders the summary as a table with one row per target, sorted by the given columns in order,
+// which keep the target order when they are equal, successful targets are left out if hideSuccess is true.
+func (s *RunSummary) ToTable(sortBy []string, hideSuccess bool) string {
+	results := make([]*summaryTableRow, 0, len(s.results))
+	for i := range s.results {
+		if hideSuccess && s.results[i].Status() == TaskStatusSuccess {
+			continue
+		}
+		results = append(results, &summaryTableRow{TaskResult: &s.results[i], Lines: stdoutLineCount(&s.results[i])})
+	}
+
+	sort.SliceStable(results, func(a, b int) bool {
+		for _, column := range sortBy {
+			i := summaryTableColumnIndex(strings.TrimPrefix(column, "-"))
+			if i < 0 {
+				continue
+			}
+			c := summaryTableColumns[i].Compare(results[a], results[b])
+			if strings.HasPrefix(column, "-") {
+				c = -c
+			}
+			if c != 0 {
+				return c < 0
+			}
+		}
+		return false
+	})
+
+	header := make([]string, 0, len(summaryTableColumns))
+	for _, column := range summaryTableColumns {
+		header = append(header, column.Name)
+	}
+	rows := make([][]string, 0, len(results))
+	for _, result := range results {
+		row := make([]string, 0, len(summaryTableColumns))
+		for _, column := range summaryTableColumns {
+			row = append(row, column.Cell(result))
+		}
+		rows = append(rows, row)
+	}
+
+	t := table.New().
+		Border(lipgloss.NormalBorder()).
+		BorderStyle(utils.Style.Dim).
+		Headers(header...).
+		Rows(rows...).
+		StyleFunc(func(row, col int) lipgloss.Style {
+			style := lipgloss.NewStyle().Padding(0, 1)
+			if row == table.HeaderRow {
+				return style.Bold(true)
+			}
+			if col == 0 {
+				switch results[row].Status() {
+				case TaskStatusError:
+					return style.Inherit(utils.Style.Error)
+				case TaskStatusWarning:
+					return style.Inherit(utils.Style.Warning)
+				default:
+					return style.Inherit(utils.Style.Success)
+				}
+			}
+			return style
+		})
+
+	text := t.Render() + "\n"
+	if hidden := len(s.results) - len(results); hidden > 0 {
+		text += utils.Style.Dim.Render(fmt.Sprintf("%d successful targets are hidden", hidden)) + "\n"
+	}
+	text += fmt.Sprintf("%d successful (%d with warnings), %d error, %d total\n",
+		s.SuccessCount(),
+		s.WarningCount,
+		s.ErrorCount,
+		s.TotalCount,
+	)
+	return text
+}
@@ -0,0 +1,98 @@
+package executor
+
+import (
+	"os"
+	"path"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// summaryTableTargets returns the targets of the rows of the rendered summary table, in order
+func summaryTableTargets(text string) []string {
+	var targets []string
+	for _, line := range strings.Split(text, "\n") {
+		cells := strings.Split(line, "│")
+		if len(cells) < 3 || strings.TrimSpace(cells[2]) == "TARGET" {
+			continue
+		}
+		targets = append(targets, strings.TrimSpace(cells[2]))
+	}
+	return targets
+}
+
+func TestSummaryTable(t *testing.T) {
+	spilled := strings.Repeat("pod-a   Running\n", 5)
+	spillFile := path.Join(t.TempDir(), "c.stdout.spill")
+	if err := os.WriteFile(spillFile, []byte(spilled), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	summary := NewRunSummary([]*TaskResult{
+		{TaskItem: &Target{ID: "a", Index: 1}, Duration: 2 * time.Second, Stdout: "pod-a   Running\n"},
+		{TaskItem: &Target{ID: "b", Index: 2}, Duration: 1 * time.Second, Err: "exit status 1", ExitCode: 1, HasErr: true},
+		{TaskItem: &Target{ID: "c", Index: 3}, Duration: 3 * time.Second, Stdout: spilled[:16], StdoutFile: spillFile},
+		{TaskItem: &Target{ID: "d", Index: 4}, Duration: 1 * time.Second, Stderr: "Warning: deprecated\n", NeedToPrintStderr: true,
+			Stdout: "pod-a   Running\npod-b   Running\n"},
+	})
+
+	tests := []struct {
+		name        string
+		sortBy      []string
+		hideSuccess bool
+		want        []string
+	}{
+		{name: "target order", want: []string{"a", "b", "c", "d"}},
+		{name: "by duration", sortBy: []string{"duration"}, want: []string{"b", "d", "a", "c"}},
+		{name: "by duration descending", sortBy: []string{"-DURATION"}, want: []string{"c", "a", "b", "d"}},
+		{name: "by status, most severe first", sortBy: []string{"-status"}, want: []string{"b", "d", "a", "c"}},
+		{name: "by lines of spilled stdout", sortBy: []string{"-lines", "target"}, want: []string{"c", "d", "a", "b"}},
+		{name: "by duration then target descending", sortBy: []string{"duration", "-target"}, want: []string{"d", "b", "a", "c"}},
+		{name: "hide success", hideSuccess: true, want: []string{"b", "d"}},
+		{name: "hide success sorted", sortBy: []string{"-exit"}, hideSuccess: true, want: []string{"b", "d"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			text := summary.ToTable(tt.sortBy, tt.hideSuccess)
+			if got := summaryTableTargets(text); !slices.Equal(got, tt.want) {
+				t.Errorf("ToTable() rows = %q, want %q:\n%s", got, tt.want, text)
+			}
+			if hidden := strings.Contains(text, "2 successful targets are hidden"); hidden != tt.hideSuccess {
+				t.Errorf("ToTable() tells hidden targets = %v, want %v:\n%s", hidden, tt.hideSuccess, text)
+			}
+		})
+	}
+}
+
+func TestSummaryTableLines(t *testing.T) {
+	spilled := strings.Repeat("pod-a   Running\n", 5)
+	spillFile := path.Join(t.TempDir(), "a.stdout.spill")
+	if err := os.WriteFile(spillFile, []byte(spilled), 0600); err != nil {
+		t.Fatal(err)
+	}
+	summary := NewRunSummary([]*TaskResult{{TaskItem: &Target{ID: "a"}, Stdout: spilled[:16], StdoutFile: spillFile}})
+
+	for _, line := range strings.Split(summary.ToTable(nil, false), "\n") {
+		cells := strings.Split(line, "│")
+		if len(cells) > 5 && strings.TrimSpace(cells[2]) == "a" {
+			if got := strings.TrimSpace(cells[5]); got != "5" {
+				t.Errorf("LINES = %s, want the 5 lines of the spilled stdout", got)
+			}
+			return
+		}
+	}
+	t.Error("row of target a is missing")
+}
+
+func TestValidateSummaryView(t *testing.T) {
+	if err := validateSummaryView(SummaryViewTable, []string{"-Duration", "target"}); err != nil {
+		t.Errorf("validateSummaryView() error = %v", err)
+	}
+	if err := validateSummaryView("list", nil); err == nil || !strings.Contains(err.Error(), `unknown summary view "list"`) {
+		t.Errorf("validateSummaryView() error = %v, want unknown summary view", err)
+	}
+	if err := validateSummaryView(SummaryViewTable, []string{"size"}); err == nil || !strings.Contains(err.Error(), `unknown summary sort column "size"`) {
+		t.Errorf("validateSummaryView() error = %v, want unknown summary sort column", err)
+	}
+}
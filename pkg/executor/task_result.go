@@ -3,17 +3,59 @@ package executor
 import (
 	"encoding/json"
 	"fmt"
+	"os"
 	"strings"
+	"time"
 
 	"gopkg.in/yaml.v2"
 )
 
+const (
+	TaskStatusSuccess = "success"
+	TaskStatusWarning = "warning"
+	TaskStatusError   = "error"
+)
+
 type TaskResult struct {
 	TaskItem *Target `json:"taskItem" yaml:"taskItem"`
 
-	Err    string `json:"err,omitempty" yaml:"err,omitempty"`
-	Stdout string `json:"stdout,omitempty" yaml:"stdout,omitempty"`
-	Stderr string `json:"stderr,omitempty" yaml:"stderr,omitempty"`
+	Err      string `json:"err,omitempty" yaml:"err,omitempty"`
+	ExitCode int    `json:"exitCode,omitempty" yaml:"exitCode,omitempty"`
+	Stdout   string `json:"stdout,omitempty" yaml:"stdout,omitempty"`
+	Stderr   string `json:"stderr,omitempty" yaml:"stderr,omitempty"`
+
+	// ErrorCategory is the category of the error, one of ErrorCategory*, empty if there is no error
+	ErrorCategory string `json:"errorCategory,omitempty" yaml:"errorCategory,omitempty"`
+
+	// Duration is how long kubectl ran for the target, it's serialized as a string rounded to milliseconds, e.g. "1.234s",
+	// see MarshalJSON
+	Duration time.Duration `json:"-" yaml:"-"`
+
+	// StderrWarnings are the warning lines of stderr classified by category, including the ones of suppressed categories
+	StderrWarnings []StderrWarning `json:"stderrWarnings,omitempty" yaml:"stderrWarnings,omitempty"`
+
+	// StdoutFile is set when stdout exceeded the spill threshold, Stdout then only holds a preview,
+	// use FullStdout to read the complete output back
+	StdoutFile string `json:"stdoutFile,omitempty" yaml:"stdoutFile,omitempty"`
+
+	// StderrFile is set when stderr exceeded the spill threshold, Stderr then only holds a preview,
+	// use FullStderr to read the complete output back
+	StderrFile string `json:"stderrFile,omitempty" yaml:"stderrFile,omitempty"`
+
+	// QueryResults are the outputs of the query evaluated with the JSON stdout, only set when running with a query
+	QueryResults []any `json:"queryResults,omitempty" yaml:"queryResults,omitempty"`
+
+	// AggregateValue is the value of the aggregate computed from the JSON stdout, only set when running with an aggregate
+	AggregateValue *AggregateValue `json:"aggregateValue,omitempty" yaml:"aggregateValue,omitempty"`
+
+	// ConditionMatched is true if there is an output condition and the result matches it
+	ConditionMatched bool `json:"conditionMatched,omitempty" yaml:"conditionMatched,omitempty"`
+
+	// GrepMatches is the number of stdout lines kept by line filters, Stdout only contains these lines and table headers
+	GrepMatches int `json:"grepMatches,omitempty" yaml:"grepMatches,omitempty"`
+
+	// Redactions is the number of secrets masked in stdout and stderr, see Redactor
+	Redactions int `json:"redactions,omitempty" yaml:"redactions,omitempty"`
 
 	HasErr    bool `json:"hasErr,omitempty" yaml:"hasErr,omitempty"`
 	HasStdout bool `json:"hasStdout,omitempty" yaml:"hasStdout,omitempty"`
@@ -25,12 +67,120 @@ type TaskResult struct {
 	NeedToPrintAnything bool `json:"needToPrintAnything,omitempty" yaml:"needToPrintAnything,omitempty"`
 }
 
+// taskResultFields has the fields of TaskResult without its methods, so that it's marshaled with the default encoding
+type taskResultFields TaskResult
+
+// taskResultDocument is how TaskResult is serialized, the duration is a string instead of nanoseconds
+type taskResultDocument struct {
+	taskResultFields `yaml:",inline"`
+
+	Duration string `json:"duration,omitempty" yaml:"duration,omitempty"`
+}
+
+func (r TaskResult) toDocument() taskResultDocument {
+	document := taskResultDocument{taskResultFields: taskResultFields(r)}
+	if r.Duration != 0 {
+		document.Duration = r.Duration.Round(time.Millisecond).String()
+	}
+	return document
+}
+
+// MarshalJSON writes the duration as a string, e.g. "1.234s", which is what the JSON documents of runs have
+func (r TaskResult) MarshalJSON() ([]byte, error) {
+	return json.Marshal(r.toDocument())
+}
+
+// UnmarshalJSON reads the duration as a string, or as nanoseconds, which is how runs saved by older versions have it
+func (r *TaskResult) UnmarshalJSON(data []byte) error {
+	var document struct {
+		*taskResultFields
+		Duration json.RawMessage `json:"duration,omitempty"`
+	}
+	document.taskResultFields = (*taskResultFields)(r)
+	if err := json.Unmarshal(data, &document); err != nil {
+		return err
+	}
+	duration, err := parseDuration(document.Duration)
+	if err != nil {
+		return err
+	}
+	r.Duration = duration
+	return nil
+}
+
+func (r TaskResult) MarshalYAML() (any, error) {
+	return r.toDocument(), nil
+}
+
+// parseDuration parses a duration string, or nanoseconds
+func parseDuration(data json.RawMessage) (time.Duration, error) {
+	if len(data) == 0 || string(data) == "null" {
+		return 0, nil
+	}
+	var nanoseconds int64
+	if err := json.Unmarshal(data, &nanoseconds); err == nil {
+		return time.Duration(nanoseconds), nil
+	}
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return 0, fmt.Errorf("invalid duration %s", data)
+	}
+	duration, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid duration %q: %v", s, err)
+	}
+	return duration, nil
+}
+
+// Status returns one of TaskStatus*, a result is a warning if it has no error but stderr is printed
+func (r *TaskResult) Status() string {
+	if r.HasErr {
+		return TaskStatusError
+	}
+	if r.NeedToPrintStderr {
+		return TaskStatusWarning
+	}
+	return TaskStatusSuccess
+}
+
+// FullStdout returns the complete stdout, reading it back from StdoutFile if it was spilled to disk
+func (r *TaskResult) FullStdout() string {
+	return readSpilledOutput(r.Stdout, r.StdoutFile)
+}
+
+// FullStderr returns the complete stderr, reading it back from StderrFile if it was spilled to disk
+func (r *TaskResult) FullStderr() string {
+	return readSpilledOutput(r.Stderr, r.StderrFile)
+}
+
+// WithFullOutput returns a copy of the result with spilled stdout/stderr read back into memory,
+// it should only be used right before rendering a single result
+func (r *TaskResult) WithFullOutput() TaskResult {
+	rCopy := *r
+	rCopy.Stdout = r.FullStdout()
+	rCopy.Stderr = r.FullStderr()
+	rCopy.StdoutFile = ""
+	rCopy.StderrFile = ""
+	return rCopy
+}
+
+func readSpilledOutput(preview, file string) string {
+	if file == "" {
+		return preview
+	}
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return fmt.Sprintf("%s\n[failed to read full output from %s: %v]", preview, file, err)
+	}
+	return string(content)
+}
+
 func (r *TaskResult) ToJSON() ([]byte, error) {
 	if !r.NeedToPrintAnything {
 		return []byte(""), nil
 	}
 
-	rCopy := *r
+	rCopy := r.WithFullOutput()
 
 	if !rCopy.NeedToPrintErr {
 		rCopy.Err = ""
@@ -54,7 +204,7 @@ func (r *TaskResult) ToYAML() ([]byte, error) {
 		return []byte(""), nil
 	}
 
-	rCopy := *r
+	rCopy := r.WithFullOutput()
 
 	if !rCopy.NeedToPrintErr {
 		rCopy.Err = ""
@@ -93,16 +243,24 @@ func (r *TaskResult) ToText(totalCount int) string {
 		output += fmt.Sprintf("\n---\nTASK START: %s (%d/%d)\n", r.TaskItem.ID, r.TaskItem.Index, totalCount)
 	}
 
+	if r.NeedToPrintAnything && r.Redactions > 0 {
+		output += fmt.Sprintf("\nREDACTED: %d secrets are masked\n", r.Redactions)
+	}
+
 	if r.NeedToPrintErr {
-		output += fmt.Sprintf("\nERROR: %v\n", r.Err)
+		output += fmt.Sprintf("\nERROR (%s): %v\n", r.ErrorCategory, r.Err)
 	}
 
 	if r.NeedToPrintStderr {
-		output += fmt.Sprintf("\nSTDERR:\n%s\n", strings.TrimSpace(string(r.Stderr)))
+		output += fmt.Sprintf("\nSTDERR:\n%s\n", strings.TrimSpace(r.FullStderr()))
 	}
 
 	if r.NeedToPrintStdout {
-		output += fmt.Sprintf("\nSTDOUT:\n%s\n", strings.TrimSpace(string(r.Stdout)))
+		if r.QueryResults != nil {
+			output += fmt.Sprintf("\nQUERY RESULT:\n%s\n", formatQueryResults(r.QueryResults))
+		} else {
+			output += fmt.Sprintf("\nSTDOUT:\n%s\n", strings.TrimSpace(r.FullStdout()))
+		}
 	}
 
 	if r.NeedToPrintAnything {
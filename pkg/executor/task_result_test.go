@@ -0,0 +1,65 @@
+package executor
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+func TestTaskResultJSON(t *testing.T) {
+	result := TaskResult{
+		TaskItem: &Target{ID: "a", Context: "a", Index: 1},
+		Stdout:   "ok\n",
+		Duration: 1234567891 * time.Nanosecond,
+	}
+	content, err := json.Marshal(result)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(content); !strings.Contains(got, `"duration":"1.235s"`) || strings.Contains(got, "exitCode") {
+		t.Errorf("json = %s, want a duration string and no exitCode", got)
+	}
+
+	var decoded TaskResult
+	if err := json.Unmarshal(content, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Duration != 1235*time.Millisecond || decoded.Stdout != "ok\n" || decoded.TaskItem.ID != "a" {
+		t.Errorf("decoded = %+v", decoded)
+	}
+
+	// runs saved by older versions have durations in nanoseconds
+	if err := json.Unmarshal([]byte(`{"taskItem":{"id":"b"},"exitCode":1,"duration":1500000000}`), &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Duration != 1500*time.Millisecond || decoded.ExitCode != 1 {
+		t.Errorf("decoded = %+v", decoded)
+	}
+
+	if err := json.Unmarshal([]byte(`{"duration":"soon"}`), &decoded); err == nil {
+		t.Error("invalid duration is accepted")
+	}
+
+	// results in maps are not addressable, they must be marshaled the same way
+	content, err = json.Marshal(map[string]TaskResult{"a": result})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(content), `"duration":"1.235s"`) {
+		t.Errorf("json = %s, want a duration string", content)
+	}
+}
+
+func TestTaskResultYAML(t *testing.T) {
+	content, err := yaml.Marshal(TaskResult{TaskItem: &Target{ID: "a"}, ExitCode: 2, Duration: 20 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "taskItem:\n  id: a\n  kubeconfig: \"\"\n  context: \"\"\nexitCode: 2\nduration: 20ms\n"
+	if string(content) != want {
+		t.Errorf("yaml = %q, want %q", content, want)
+	}
+}
@@ -11,7 +11,7 @@ type Target struct {
 	Context    string `json:"context" yaml:"context"`
 
 	// Index is the index of the target during execution, will be set during execution
-	Index int `json:"-" yaml:"-"`
+	Index int `json:"index,omitempty" yaml:"index,omitempty"`
 }
 
 func NewTarget(kubeconfig, context string) Target {
@@ -0,0 +1,84 @@
+package executor
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"text/template"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/junchaw/kubekraken/pkg/utils"
+)
+
+// templateFuncs are the helpers of result and summary templates, the value of a pipeline is passed as the last argument,
+// e.g. {{.Stdout | lines | len}}, {{.Stderr | truncate 80 | color "warning"}}
+var templateFuncs = template.FuncMap{
+	// indent prefixes each line with n spaces
+	"indent": func(n int, s string) string {
+		prefix := strings.Repeat(" ", n)
+		return prefix + strings.ReplaceAll(s, "\n", "\n"+prefix)
+	},
+	// truncate cuts the text to n characters, "..." is appended if it's cut
+	"truncate": func(n int, s string) string {
+		runes := []rune(s)
+		if len(runes) <= n {
+			return s
+		}
+		return string(runes[:max(n-3, 0)]) + "..."
+	},
+	// color renders the text with a style (info, success, warning, error, dim) or a lipgloss color (e.g. 12, #ff0000)
+	"color": func(name, s string) string {
+		switch name {
+		case "info":
+			return utils.Style.Info.Render(s)
+		case "success":
+			return utils.Style.Success.Render(s)
+		case "warning":
+			return utils.Style.Warning.Render(s)
+		case "error":
+			return utils.Style.Error.Render(s)
+		case "dim":
+			return utils.Style.Dim.Render(s)
+		}
+		return lipgloss.NewStyle().Foreground(lipgloss.Color(name)).Render(s)
+	},
+	"toJson": func(v any) (string, error) {
+		content, err := json.Marshal(v)
+		if err != nil {
+			return "", err
+		}
+		return string(content), nil
+	},
+	// lines splits the text into lines, the trailing line break doesn't start a new line
+	"lines": func(s string) []string {
+		s = strings.TrimRight(s, "\n")
+		if s == "" {
+			return []string{}
+		}
+		return strings.Split(s, "\n")
+	},
+}
+
+// ParseTemplate parses a result or summary template, which is a Go text/template with templateFuncs as helpers
+func ParseTemplate(name, text string) (*template.Template, error) {
+	return template.New(name).Funcs(templateFuncs).Parse(text)
+}
+
+// renderTemplate executes the template with data, a line break is appended if the output doesn't end with one
+func renderTemplate(t *template.Template, data any) (string, error) {
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("failed to render %s template: %v", t.Name(), err)
+	}
+	if buf.Len() > 0 && !bytes.HasSuffix(buf.Bytes(), []byte("\n")) {
+		buf.WriteByte('\n')
+	}
+	return buf.String(), nil
+}
+
+// renderResultTemplate renders the result with the result template, spilled outputs are read back into memory
+func (r *Run) renderResultTemplate(result *TaskResult) (string, error) {
+	rCopy := result.WithFullOutput()
+	return renderTemplate(r.Options.ResultTemplate, &rCopy)
+}
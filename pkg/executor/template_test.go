@@ -0,0 +1,69 @@
+package executor
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRenderTemplate(t *testing.T) {
+	result := &TaskResult{
+		TaskItem: &Target{ID: "kc@a", Context: "a"},
+		Stdout:   "NAME    STATUS\nweb-1   Running\nweb-2   Pending\n",
+		Stderr:   "Warning: v1 ComponentStatus is deprecated in v1.19+\n",
+	}
+
+	tests := []struct {
+		name    string
+		text    string
+		want    string
+		wantErr string
+	}{
+		{name: "field", text: "{{.TaskItem.ID}}", want: "kc@a\n"},
+		{name: "lines", text: "{{.Stdout | lines | len}}", want: "3\n"},
+		{name: "lines of empty text", text: `{{"" | lines | len}}`, want: "0\n"},
+		{name: "range over lines", text: "{{range .Stdout | lines}}[{{.}}]{{end}}", want: "[NAME    STATUS][web-1   Running][web-2   Pending]\n"},
+		{name: "truncate", text: "{{.Stderr | truncate 10}}", want: "Warning...\n"},
+		{name: "truncate short text", text: `{{"Running" | truncate 10}}`, want: "Running\n"},
+		{name: "truncate counts characters", text: `{{"Läuft für immer" | truncate 8}}`, want: "Läuft...\n"},
+		{name: "indent", text: `{{"a\nb" | indent 2}}`, want: "  a\n  b\n"},
+		{name: "toJson", text: "{{.TaskItem | toJson}}", want: `{"id":"kc@a","kubeconfig":"","context":"a"}` + "\n"},
+		{name: "color style", text: `{{"failed" | color "error"}}`, want: "failed"},
+		{name: "color code", text: `{{"failed" | color "#ff0000"}}`, want: "failed"},
+		{name: "unknown field", text: "{{.Nope}}", wantErr: `failed to render result template: template: result:1:2: executing "result" at <.Nope>: can't evaluate field Nope in type *executor.TaskResult`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpl, err := ParseTemplate("result", tt.text)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := renderTemplate(tmpl, result)
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Errorf("renderTemplate() error = %v, want %s", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			// colors depend on the terminal, so only the text is checked for them
+			if strings.HasPrefix(tt.name, "color") {
+				if !strings.Contains(got, tt.want) {
+					t.Errorf("renderTemplate() = %q, want it to contain %q", got, tt.want)
+				}
+				return
+			}
+			if got != tt.want {
+				t.Errorf("renderTemplate() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseTemplateUnknownFunction(t *testing.T) {
+	_, err := ParseTemplate("result", "{{.Stdout | nope}}")
+	if err == nil || !strings.Contains(err.Error(), `function "nope" not defined`) {
+		t.Errorf("ParseTemplate() error = %v, want function not defined", err)
+	}
+}
@@ -0,0 +1,416 @@
+package query
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// node is a parsed expression, eval returns all outputs of the expression for the input
+type node interface {
+	eval(input any) ([]any, error)
+}
+
+type identityNode struct{}
+
+func (n *identityNode) eval(input any) ([]any, error) {
+	return []any{input}, nil
+}
+
+type recurseNode struct{}
+
+func (n *recurseNode) eval(input any) ([]any, error) {
+	var outputs []any
+	var walk func(v any)
+	walk = func(v any) {
+		outputs = append(outputs, v)
+		switch v := v.(type) {
+		case []any:
+			for _, item := range v {
+				walk(item)
+			}
+		case map[string]any:
+			for _, key := range sortedKeys(v) {
+				walk(v[key])
+			}
+		}
+	}
+	walk(input)
+	return outputs, nil
+}
+
+type literalNode struct {
+	value any
+}
+
+func (n *literalNode) eval(any) ([]any, error) {
+	return []any{n.value}, nil
+}
+
+type fieldNode struct {
+	target   node
+	name     string
+	optional bool
+}
+
+func (n *fieldNode) eval(input any) ([]any, error) {
+	return eachOptional(n.target, input, n.optional, func(v any) ([]any, error) {
+		switch v := v.(type) {
+		case nil:
+			return []any{nil}, nil
+		case map[string]any:
+			return []any{v[n.name]}, nil
+		default:
+			return nil, fmt.Errorf("cannot index %s with %q", typeName(v), n.name)
+		}
+	})
+}
+
+type indexNode struct {
+	target   node
+	index    node
+	optional bool
+}
+
+func (n *indexNode) eval(input any) ([]any, error) {
+	return eachOptional(n.target, input, n.optional, func(v any) ([]any, error) {
+		return each(n.index, input, func(index any) ([]any, error) {
+			switch index := index.(type) {
+			case string:
+				return (&fieldNode{target: &identityNode{}, name: index}).eval(v)
+			case float64:
+				switch v := v.(type) {
+				case nil:
+					return []any{nil}, nil
+				case []any:
+					i := int(math.Floor(index))
+					if i < 0 {
+						i += len(v)
+					}
+					if i < 0 || i >= len(v) {
+						return []any{nil}, nil
+					}
+					return []any{v[i]}, nil
+				default:
+					return nil, fmt.Errorf("cannot index %s with number", typeName(v))
+				}
+			default:
+				return nil, fmt.Errorf("cannot index %s with %s", typeName(v), typeName(index))
+			}
+		})
+	})
+}
+
+type sliceNode struct {
+	target   node
+	from, to node
+	optional bool
+}
+
+func (n *sliceNode) eval(input any) ([]any, error) {
+	return eachOptional(n.target, input, n.optional, func(v any) ([]any, error) {
+		var length int
+		switch v := v.(type) {
+		case nil:
+			return []any{nil}, nil
+		case []any:
+			length = len(v)
+		case string:
+			length = len([]rune(v))
+		default:
+			return nil, fmt.Errorf("cannot slice %s", typeName(v))
+		}
+
+		from, err := sliceBound(n.from, input, 0, length)
+		if err != nil {
+			return nil, err
+		}
+		to, err := sliceBound(n.to, input, length, length)
+		if err != nil {
+			return nil, err
+		}
+		if to < from {
+			to = from
+		}
+
+		if s, ok := v.(string); ok {
+			return []any{string([]rune(s)[from:to])}, nil
+		}
+		return []any{v.([]any)[from:to]}, nil
+	})
+}
+
+func sliceBound(bound node, input any, fallback, length int) (int, error) {
+	if bound == nil {
+		return fallback, nil
+	}
+	values, err := bound.eval(input)
+	if err != nil {
+		return 0, err
+	}
+	if len(values) != 1 {
+		return 0, fmt.Errorf("slice index must be a single number")
+	}
+	f, ok := values[0].(float64)
+	if !ok {
+		if values[0] == nil {
+			return fallback, nil
+		}
+		return 0, fmt.Errorf("slice index must be a number, got %s", typeName(values[0]))
+	}
+	i := int(math.Floor(f))
+	if i < 0 {
+		i += length
+	}
+	return min(max(i, 0), length), nil
+}
+
+type iterateNode struct {
+	target   node
+	optional bool
+}
+
+func (n *iterateNode) eval(input any) ([]any, error) {
+	return eachOptional(n.target, input, n.optional, func(v any) ([]any, error) {
+		switch v := v.(type) {
+		case []any:
+			return v, nil
+		case map[string]any:
+			values := make([]any, 0, len(v))
+			for _, key := range sortedKeys(v) {
+				values = append(values, v[key])
+			}
+			return values, nil
+		default:
+			return nil, fmt.Errorf("cannot iterate over %s", typeName(v))
+		}
+	})
+}
+
+type tryNode struct {
+	body node
+}
+
+// eval returns the outputs of the body before its first error, the same as jq
+func (n *tryNode) eval(input any) ([]any, error) {
+	outputs, _ := n.body.eval(input)
+	return outputs, nil
+}
+
+type pipeNode struct {
+	left, right node
+}
+
+func (n *pipeNode) eval(input any) ([]any, error) {
+	return each(n.left, input, n.right.eval)
+}
+
+type commaNode struct {
+	left, right node
+}
+
+func (n *commaNode) eval(input any) ([]any, error) {
+	left, err := n.left.eval(input)
+	if err != nil {
+		return left, err
+	}
+	right, err := n.right.eval(input)
+	return append(left, right...), err
+}
+
+type alternativeNode struct {
+	left, right node
+}
+
+func (n *alternativeNode) eval(input any) ([]any, error) {
+	left, _ := n.left.eval(input) // errors on the left side are ignored, the same as jq
+	var outputs []any
+	for _, v := range left {
+		if isTruthy(v) {
+			outputs = append(outputs, v)
+		}
+	}
+	if len(outputs) > 0 {
+		return outputs, nil
+	}
+	return n.right.eval(input)
+}
+
+type andNode struct {
+	left, right node
+}
+
+func (n *andNode) eval(input any) ([]any, error) {
+	return each(n.left, input, func(l any) ([]any, error) {
+		if !isTruthy(l) {
+			return []any{false}, nil
+		}
+		return each(n.right, input, func(r any) ([]any, error) {
+			return []any{isTruthy(r)}, nil
+		})
+	})
+}
+
+type orNode struct {
+	left, right node
+}
+
+func (n *orNode) eval(input any) ([]any, error) {
+	return each(n.left, input, func(l any) ([]any, error) {
+		if isTruthy(l) {
+			return []any{true}, nil
+		}
+		return each(n.right, input, func(r any) ([]any, error) {
+			return []any{isTruthy(r)}, nil
+		})
+	})
+}
+
+type binaryNode struct {
+	op          string
+	left, right node
+}
+
+func (n *binaryNode) eval(input any) ([]any, error) {
+	// the same as jq, the right side is the outer loop
+	return each(n.right, input, func(r any) ([]any, error) {
+		return each(n.left, input, func(l any) ([]any, error) {
+			v, err := binaryOp(n.op, l, r)
+			if err != nil {
+				return nil, err
+			}
+			return []any{v}, nil
+		})
+	})
+}
+
+type arrayNode struct {
+	body node
+}
+
+func (n *arrayNode) eval(input any) ([]any, error) {
+	if n.body == nil {
+		return []any{[]any{}}, nil
+	}
+	items, err := n.body.eval(input)
+	if err != nil {
+		return nil, err
+	}
+	if items == nil {
+		items = []any{}
+	}
+	return []any{items}, nil
+}
+
+type objectEntry struct {
+	key, value node
+}
+
+type objectNode struct {
+	entries []objectEntry
+}
+
+func (n *objectNode) eval(input any) ([]any, error) {
+	objects := []map[string]any{{}}
+	for _, entry := range n.entries {
+		keys, err := entry.key.eval(input)
+		if err != nil {
+			return nil, err
+		}
+		values, err := entry.value.eval(input)
+		if err != nil {
+			return nil, err
+		}
+
+		// each combination of keys and values produces an object, the same as jq
+		var next []map[string]any
+		for _, obj := range objects {
+			for _, key := range keys {
+				s, ok := key.(string)
+				if !ok {
+					return nil, fmt.Errorf("object keys must be strings, got %s", typeName(key))
+				}
+				for _, value := range values {
+					copied := make(map[string]any, len(obj)+1)
+					for k, v := range obj {
+						copied[k] = v
+					}
+					copied[s] = value
+					next = append(next, copied)
+				}
+			}
+		}
+		objects = next
+	}
+
+	outputs := make([]any, 0, len(objects))
+	for _, obj := range objects {
+		outputs = append(outputs, obj)
+	}
+	return outputs, nil
+}
+
+type ifNode struct {
+	cond, then, otherwise node
+}
+
+func (n *ifNode) eval(input any) ([]any, error) {
+	return each(n.cond, input, func(cond any) ([]any, error) {
+		if isTruthy(cond) {
+			return n.then.eval(input)
+		}
+		if n.otherwise == nil {
+			return []any{input}, nil
+		}
+		return n.otherwise.eval(input)
+	})
+}
+
+type callNode struct {
+	name string
+	args []node
+	pos  int
+}
+
+func (n *callNode) eval(input any) ([]any, error) {
+	return functions[n.name].call(input, n.args)
+}
+
+// each evaluates target with the input, and calls f for each output, outputs of f are concatenated,
+// on errors the outputs before the error are returned with it, so that they are kept by the ? operator
+func each(target node, input any, f func(v any) ([]any, error)) ([]any, error) {
+	values, err := target.eval(input)
+	if err != nil {
+		return nil, err
+	}
+	var outputs []any
+	for _, v := range values {
+		out, err := f(v)
+		outputs = append(outputs, out...)
+		if err != nil {
+			return outputs, err
+		}
+	}
+	return outputs, nil
+}
+
+// eachOptional is each, but if optional is true, errors of f only drop the outputs of the failing value,
+// the same as jq's .a?, .[0]? and .[]?
+func eachOptional(target node, input any, optional bool, f func(v any) ([]any, error)) ([]any, error) {
+	if !optional {
+		return each(target, input, f)
+	}
+	return each(target, input, func(v any) ([]any, error) {
+		outputs, _ := f(v)
+		return outputs, nil
+	})
+}
+
+func sortedKeys(m map[string]any) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
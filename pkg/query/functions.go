@@ -0,0 +1,663 @@
+package query
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+type function struct {
+	// arities is the list of supported argument counts
+	arities []int
+	call    func(input any, args []node) ([]any, error)
+}
+
+var functions map[string]function
+
+func init() {
+	functions = map[string]function{
+		"empty":    {arities: []int{0}, call: func(any, []node) ([]any, error) { return nil, nil }},
+		"not":      simple(func(v any) (any, error) { return !isTruthy(v), nil }),
+		"type":     simple(func(v any) (any, error) { return typeName(v), nil }),
+		"length":   simple(length),
+		"keys":     simple(keys),
+		"values":   {arities: []int{0}, call: func(input any, _ []node) ([]any, error) { return selectValues(input, isNotNull) }},
+		"add":      simple(addAll),
+		"any":      simple(func(v any) (any, error) { return anyAll(v, true) }),
+		"all":      simple(func(v any) (any, error) { return anyAll(v, false) }),
+		"sort":     simple(func(v any) (any, error) { return sortBy(v, nil) }),
+		"unique":   simple(unique),
+		"reverse":  simple(reverse),
+		"min":      simple(func(v any) (any, error) { return minMax(v, -1) }),
+		"max":      simple(func(v any) (any, error) { return minMax(v, 1) }),
+		"floor":    simple(mathFunc(math.Floor)),
+		"ceil":     simple(mathFunc(math.Ceil)),
+		"round":    simple(mathFunc(math.Round)),
+		"tostring": simple(toString),
+		"tonumber": simple(toNumber),
+		"tojson": simple(func(v any) (any, error) {
+			b, err := json.Marshal(v)
+			return string(b), err
+		}),
+		"fromjson": simple(func(v any) (any, error) {
+			s, ok := v.(string)
+			if !ok {
+				return nil, fmt.Errorf("%s cannot be parsed as JSON", typeName(v))
+			}
+			var result any
+			err := json.Unmarshal([]byte(s), &result)
+			return result, err
+		}),
+		"ascii_downcase": simple(stringFunc(strings.ToLower)),
+		"ascii_upcase":   simple(stringFunc(strings.ToUpper)),
+		"to_entries":     simple(toEntries),
+		"from_entries":   simple(fromEntries),
+		"first": {arities: []int{0, 1}, call: func(input any, args []node) ([]any, error) {
+			if len(args) == 0 {
+				return (&indexNode{target: &identityNode{}, index: &literalNode{value: float64(0)}}).eval(input)
+			}
+			outputs, err := args[0].eval(input)
+			if err != nil || len(outputs) == 0 {
+				return nil, err
+			}
+			return outputs[:1], nil
+		}},
+		"last": {arities: []int{0, 1}, call: func(input any, args []node) ([]any, error) {
+			if len(args) == 0 {
+				return (&indexNode{target: &identityNode{}, index: &literalNode{value: float64(-1)}}).eval(input)
+			}
+			outputs, err := args[0].eval(input)
+			if err != nil || len(outputs) == 0 {
+				return nil, err
+			}
+			return outputs[len(outputs)-1:], nil
+		}},
+		"select": {arities: []int{1}, call: func(input any, args []node) ([]any, error) {
+			return each(args[0], input, func(v any) ([]any, error) {
+				if isTruthy(v) {
+					return []any{input}, nil
+				}
+				return nil, nil
+			})
+		}},
+		"map": {arities: []int{1}, call: func(input any, args []node) ([]any, error) {
+			return (&arrayNode{body: &pipeNode{left: &iterateNode{target: &identityNode{}}, right: args[0]}}).eval(input)
+		}},
+		"map_values": {arities: []int{1}, call: mapValues},
+		"with_entries": {arities: []int{1}, call: func(input any, args []node) ([]any, error) {
+			entries, err := toEntries(input)
+			if err != nil {
+				return nil, err
+			}
+			mapped, err := (&arrayNode{body: &pipeNode{left: &iterateNode{target: &identityNode{}}, right: args[0]}}).eval(entries)
+			if err != nil {
+				return nil, err
+			}
+			obj, err := fromEntries(mapped[0])
+			return []any{obj}, err
+		}},
+		"has": {arities: []int{1}, call: withArg(has)},
+		"contains": {arities: []int{1}, call: withArg(func(input, arg any) (any, error) {
+			return containsJSON(input, arg), nil
+		})},
+		"startswith": {arities: []int{1}, call: withStringArg(func(s, arg string) any { return strings.HasPrefix(s, arg) })},
+		"endswith":   {arities: []int{1}, call: withStringArg(func(s, arg string) any { return strings.HasSuffix(s, arg) })},
+		"ltrimstr":   {arities: []int{1}, call: withStringArg(func(s, arg string) any { return strings.TrimPrefix(s, arg) })},
+		"rtrimstr":   {arities: []int{1}, call: withStringArg(func(s, arg string) any { return strings.TrimSuffix(s, arg) })},
+		"split":      {arities: []int{1}, call: withStringArg(func(s, arg string) any { return splitString(s, arg) })},
+		"test": {arities: []int{1, 2}, call: func(input any, args []node) ([]any, error) {
+			s, ok := input.(string)
+			if !ok {
+				return nil, fmt.Errorf("%s cannot be matched, as it is not a string", typeName(input))
+			}
+			return eachArgString(input, args, func(pattern, flags string) (any, error) {
+				if strings.Contains(flags, "i") {
+					pattern = "(?i)" + pattern
+				}
+				re, err := regexp.Compile(pattern)
+				if err != nil {
+					return nil, fmt.Errorf("invalid regex %q: %v", pattern, err)
+				}
+				return re.MatchString(s), nil
+			})
+		}},
+		"join": {arities: []int{1}, call: withArg(func(input, arg any) (any, error) {
+			items, ok := input.([]any)
+			if !ok {
+				return nil, fmt.Errorf("cannot join %s", typeName(input))
+			}
+			sep, ok := arg.(string)
+			if !ok {
+				return nil, fmt.Errorf("join separator must be a string, got %s", typeName(arg))
+			}
+			parts := make([]string, 0, len(items))
+			for _, item := range items {
+				if item == nil {
+					parts = append(parts, "")
+					continue
+				}
+				s, err := toString(item)
+				if err != nil {
+					return nil, err
+				}
+				parts = append(parts, s.(string))
+			}
+			return strings.Join(parts, sep), nil
+		})},
+		"numbers":   typeFilter("number"),
+		"strings":   typeFilter("string"),
+		"booleans":  typeFilter("boolean"),
+		"nulls":     typeFilter("null"),
+		"arrays":    typeFilter("array"),
+		"objects":   typeFilter("object"),
+		"sort_by":   {arities: []int{1}, call: byFunc(sortBy)},
+		"group_by":  {arities: []int{1}, call: byFunc(groupBy)},
+		"unique_by": {arities: []int{1}, call: byFunc(uniqueBy)},
+		"min_by":    {arities: []int{1}, call: byFunc(func(v any, f func(any) (any, error)) (any, error) { return minMaxBy(v, f, -1) })},
+		"max_by":    {arities: []int{1}, call: byFunc(func(v any, f func(any) (any, error)) (any, error) { return minMaxBy(v, f, 1) })},
+		"limit": {arities: []int{2}, call: func(input any, args []node) ([]any, error) {
+			return each(args[0], input, func(n any) ([]any, error) {
+				limit, ok := n.(float64)
+				if !ok {
+					return nil, fmt.Errorf("limit must be a number, got %s", typeName(n))
+				}
+				outputs, err := args[1].eval(input)
+				if err != nil {
+					return nil, err
+				}
+				return outputs[:min(len(outputs), max(int(limit), 0))], nil
+			})
+		}},
+	}
+}
+
+// checkFunction returns an error if the function doesn't exist or the number of arguments is wrong
+func checkFunction(call *callNode) error {
+	f, ok := functions[call.name]
+	if !ok {
+		return fmt.Errorf("unknown function %s/%d", call.name, len(call.args))
+	}
+	for _, arity := range f.arities {
+		if arity == len(call.args) {
+			return nil
+		}
+	}
+	return fmt.Errorf("function %s does not accept %d arguments", call.name, len(call.args))
+}
+
+func simple(f func(v any) (any, error)) function {
+	return function{arities: []int{0}, call: func(input any, _ []node) ([]any, error) {
+		v, err := f(input)
+		if err != nil {
+			return nil, err
+		}
+		return []any{v}, nil
+	}}
+}
+
+func withArg(f func(input, arg any) (any, error)) func(input any, args []node) ([]any, error) {
+	return func(input any, args []node) ([]any, error) {
+		return each(args[0], input, func(arg any) ([]any, error) {
+			v, err := f(input, arg)
+			if err != nil {
+				return nil, err
+			}
+			return []any{v}, nil
+		})
+	}
+}
+
+func withStringArg(f func(s, arg string) any) func(input any, args []node) ([]any, error) {
+	return withArg(func(input, arg any) (any, error) {
+		s, ok := input.(string)
+		if !ok {
+			return nil, fmt.Errorf("input must be a string, got %s", typeName(input))
+		}
+		a, ok := arg.(string)
+		if !ok {
+			return nil, fmt.Errorf("argument must be a string, got %s", typeName(arg))
+		}
+		return f(s, a), nil
+	})
+}
+
+// eachArgString calls f with the first argument and the optional second argument as strings
+func eachArgString(input any, args []node, f func(a, b string) (any, error)) ([]any, error) {
+	return each(args[0], input, func(a any) ([]any, error) {
+		as, ok := a.(string)
+		if !ok {
+			return nil, fmt.Errorf("argument must be a string, got %s", typeName(a))
+		}
+		if len(args) < 2 {
+			v, err := f(as, "")
+			return []any{v}, err
+		}
+		return each(args[1], input, func(b any) ([]any, error) {
+			bs, ok := b.(string)
+			if !ok && b != nil {
+				return nil, fmt.Errorf("argument must be a string, got %s", typeName(b))
+			}
+			v, err := f(as, bs)
+			return []any{v}, err
+		})
+	})
+}
+
+func byFunc(f func(v any, key func(any) (any, error)) (any, error)) func(input any, args []node) ([]any, error) {
+	return func(input any, args []node) ([]any, error) {
+		v, err := f(input, func(item any) (any, error) {
+			keys, err := args[0].eval(item)
+			if err != nil {
+				return nil, err
+			}
+			if keys == nil {
+				keys = []any{}
+			}
+			return keys, nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		return []any{v}, nil
+	}
+}
+
+// typeFilter returns a function which outputs the input only if it has the given type, like jq numbers or strings
+func typeFilter(name string) function {
+	return function{arities: []int{0}, call: func(input any, _ []node) ([]any, error) {
+		if typeName(input) == name {
+			return []any{input}, nil
+		}
+		return nil, nil
+	}}
+}
+
+func isNotNull(v any) bool {
+	return v != nil
+}
+
+func selectValues(input any, keep func(any) bool) ([]any, error) {
+	values, err := (&iterateNode{target: &identityNode{}}).eval(input)
+	if err != nil {
+		return nil, err
+	}
+	var outputs []any
+	for _, v := range values {
+		if keep(v) {
+			outputs = append(outputs, v)
+		}
+	}
+	return outputs, nil
+}
+
+func length(v any) (any, error) {
+	switch v := v.(type) {
+	case nil:
+		return float64(0), nil
+	case bool:
+		return nil, fmt.Errorf("boolean (%v) has no length", v)
+	case float64:
+		return math.Abs(v), nil
+	case string:
+		return float64(utf8.RuneCountInString(v)), nil
+	case []any:
+		return float64(len(v)), nil
+	case map[string]any:
+		return float64(len(v)), nil
+	}
+	return nil, fmt.Errorf("%s has no length", typeName(v))
+}
+
+func keys(v any) (any, error) {
+	switch v := v.(type) {
+	case map[string]any:
+		return keysAsValues(v), nil
+	case []any:
+		result := make([]any, 0, len(v))
+		for i := range v {
+			result = append(result, float64(i))
+		}
+		return result, nil
+	}
+	return nil, fmt.Errorf("%s has no keys", typeName(v))
+}
+
+func asArray(v any, name string) ([]any, error) {
+	items, ok := v.([]any)
+	if !ok {
+		return nil, fmt.Errorf("%s cannot be used with %s, it must be an array", typeName(v), name)
+	}
+	return items, nil
+}
+
+func addAll(v any) (any, error) {
+	items, err := asArray(v, "add")
+	if err != nil {
+		return nil, err
+	}
+	var sum any
+	for _, item := range items {
+		if sum, err = add(sum, item); err != nil {
+			return nil, err
+		}
+	}
+	return sum, nil
+}
+
+func anyAll(v any, isAny bool) (any, error) {
+	items, err := asArray(v, "any/all")
+	if err != nil {
+		return nil, err
+	}
+	for _, item := range items {
+		if isTruthy(item) == isAny {
+			return isAny, nil
+		}
+	}
+	return !isAny, nil
+}
+
+func sortBy(v any, key func(any) (any, error)) (any, error) {
+	items, err := asArray(v, "sort")
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]any, len(items))
+	for i, item := range items {
+		keys[i] = item
+		if key != nil {
+			if keys[i], err = key(item); err != nil {
+				return nil, err
+			}
+		}
+	}
+	indexes := make([]int, len(items))
+	for i := range indexes {
+		indexes[i] = i
+	}
+	sort.SliceStable(indexes, func(a, b int) bool {
+		return compare(keys[indexes[a]], keys[indexes[b]]) < 0
+	})
+	result := make([]any, 0, len(items))
+	for _, i := range indexes {
+		result = append(result, items[i])
+	}
+	return result, nil
+}
+
+func groupBy(v any, key func(any) (any, error)) (any, error) {
+	sorted, err := sortBy(v, key)
+	if err != nil {
+		return nil, err
+	}
+	groups := []any{}
+	var lastKey any
+	for i, item := range sorted.([]any) {
+		k, err := key(item)
+		if err != nil {
+			return nil, err
+		}
+		if i == 0 || compare(k, lastKey) != 0 {
+			groups = append(groups, []any{})
+		}
+		groups[len(groups)-1] = append(groups[len(groups)-1].([]any), item)
+		lastKey = k
+	}
+	return groups, nil
+}
+
+func uniqueBy(v any, key func(any) (any, error)) (any, error) {
+	groups, err := groupBy(v, key)
+	if err != nil {
+		return nil, err
+	}
+	result := []any{}
+	for _, group := range groups.([]any) {
+		result = append(result, group.([]any)[0])
+	}
+	return result, nil
+}
+
+func unique(v any) (any, error) {
+	return uniqueBy(v, func(item any) (any, error) { return item, nil })
+}
+
+func reverse(v any) (any, error) {
+	if s, ok := v.(string); ok {
+		runes := []rune(s)
+		for i, j := 0, len(runes)-1; i < j; i, j = i+1, j-1 {
+			runes[i], runes[j] = runes[j], runes[i]
+		}
+		return string(runes), nil
+	}
+	if v == nil {
+		return []any{}, nil
+	}
+	items, err := asArray(v, "reverse")
+	if err != nil {
+		return nil, err
+	}
+	result := make([]any, 0, len(items))
+	for i := len(items) - 1; i >= 0; i-- {
+		result = append(result, items[i])
+	}
+	return result, nil
+}
+
+func minMax(v any, sign int) (any, error) {
+	return minMaxBy(v, func(item any) (any, error) { return item, nil }, sign)
+}
+
+func minMaxBy(v any, key func(any) (any, error), sign int) (any, error) {
+	items, err := asArray(v, "min/max")
+	if err != nil {
+		return nil, err
+	}
+	var best, bestKey any
+	for i, item := range items {
+		k, err := key(item)
+		if err != nil {
+			return nil, err
+		}
+		if i == 0 || compare(k, bestKey)*sign >= 0 {
+			best, bestKey = item, k
+		}
+	}
+	return best, nil
+}
+
+func mathFunc(f func(float64) float64) func(v any) (any, error) {
+	return func(v any) (any, error) {
+		n, ok := v.(float64)
+		if !ok {
+			return nil, fmt.Errorf("%s is not a number", typeName(v))
+		}
+		return f(n), nil
+	}
+}
+
+func stringFunc(f func(string) string) func(v any) (any, error) {
+	return func(v any) (any, error) {
+		s, ok := v.(string)
+		if !ok {
+			return nil, fmt.Errorf("%s is not a string", typeName(v))
+		}
+		return f(s), nil
+	}
+}
+
+func toString(v any) (any, error) {
+	if s, ok := v.(string); ok {
+		return s, nil
+	}
+	b, err := json.Marshal(v)
+	return string(b), err
+}
+
+func toNumber(v any) (any, error) {
+	switch v := v.(type) {
+	case float64:
+		return v, nil
+	case string:
+		n, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse %q as number", v)
+		}
+		return n, nil
+	}
+	return nil, fmt.Errorf("%s cannot be parsed as a number", typeName(v))
+}
+
+func toEntries(v any) (any, error) {
+	if arr, ok := v.([]any); ok { // the keys of arrays are the indexes, the same as jq
+		entries := make([]any, 0, len(arr))
+		for i, item := range arr {
+			entries = append(entries, map[string]any{"key": float64(i), "value": item})
+		}
+		return entries, nil
+	}
+	obj, ok := v.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("%s has no keys", typeName(v))
+	}
+	entries := make([]any, 0, len(obj))
+	for _, key := range sortedKeys(obj) {
+		entries = append(entries, map[string]any{"key": key, "value": obj[key]})
+	}
+	return entries, nil
+}
+
+func fromEntries(v any) (any, error) {
+	items, err := asArray(v, "from_entries")
+	if err != nil {
+		return nil, err
+	}
+	obj := make(map[string]any, len(items))
+	for _, item := range items {
+		entry, ok := item.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("cannot use %s as object entry", typeName(item))
+		}
+		// the same key and value names as jq
+		key := entry["key"]
+		for _, name := range []string{"k", "name", "Name", "K", "Key"} {
+			if key != nil && key != false {
+				break
+			}
+			key = entry[name]
+		}
+		s, err := toString(key)
+		if err != nil {
+			return nil, err
+		}
+		value, ok := entry["value"]
+		if !ok {
+			if value, ok = entry["v"]; !ok {
+				value = entry["Value"]
+			}
+		}
+		obj[s.(string)] = value
+	}
+	return obj, nil
+}
+
+func mapValues(input any, args []node) ([]any, error) {
+	apply := func(v any) (any, bool, error) {
+		outputs, err := args[0].eval(v)
+		if err != nil || len(outputs) == 0 {
+			return nil, false, err
+		}
+		return outputs[0], true, nil
+	}
+	switch v := input.(type) {
+	case []any:
+		result := []any{}
+		for _, item := range v {
+			mapped, ok, err := apply(item)
+			if err != nil {
+				return nil, err
+			}
+			if ok {
+				result = append(result, mapped)
+			}
+		}
+		return []any{result}, nil
+	case map[string]any:
+		result := map[string]any{}
+		for key, item := range v {
+			mapped, ok, err := apply(item)
+			if err != nil {
+				return nil, err
+			}
+			if ok {
+				result[key] = mapped
+			}
+		}
+		return []any{result}, nil
+	}
+	return nil, fmt.Errorf("cannot iterate over %s", typeName(input))
+}
+
+func has(input, arg any) (any, error) {
+	switch v := input.(type) {
+	case map[string]any:
+		key, ok := arg.(string)
+		if !ok {
+			return nil, fmt.Errorf("cannot check whether object has a key of type %s", typeName(arg))
+		}
+		_, found := v[key]
+		return found, nil
+	case []any:
+		i, ok := arg.(float64)
+		if !ok {
+			return nil, fmt.Errorf("cannot check whether array has a key of type %s", typeName(arg))
+		}
+		return i >= 0 && int(i) < len(v), nil
+	}
+	return nil, fmt.Errorf("cannot check whether %s has a key", typeName(input))
+}
+
+// containsJSON returns true if b is contained in a, with the same semantics as jq contains
+func containsJSON(a, b any) bool {
+	switch a := a.(type) {
+	case string:
+		bs, ok := b.(string)
+		return ok && strings.Contains(a, bs)
+	case []any:
+		bs, ok := b.([]any)
+		if !ok {
+			return false
+		}
+		for _, bItem := range bs {
+			found := false
+			for _, aItem := range a {
+				if containsJSON(aItem, bItem) {
+					found = true
+					break
+				}
+			}
+			if !found {
+				return false
+			}
+		}
+		return true
+	case map[string]any:
+		bm, ok := b.(map[string]any)
+		if !ok {
+			return false
+		}
+		for key, bValue := range bm {
+			aValue, found := a[key]
+			if !found || !containsJSON(aValue, bValue) {
+				return false
+			}
+		}
+		return true
+	}
+	return compare(a, b) == 0
+}
@@ -0,0 +1,154 @@
+package query
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenDot
+	tokenRecurse
+	tokenField
+	tokenIdent
+	tokenString
+	tokenNumber
+	tokenOp
+)
+
+type token struct {
+	kind tokenKind
+	text string // operator, identifier, field name or unquoted string
+	num  float64
+	pos  int
+}
+
+// ParseError is returned when an expression can't be parsed, Pos is the byte offset of the error in the expression
+type ParseError struct {
+	Expr string
+	Pos  int
+	Msg  string
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("%s at position %d in %q", e.Msg, e.Pos+1, e.Expr)
+}
+
+// operators sorted so that longer operators are matched first
+var operators = []string{"==", "!=", "<=", ">=", "//", "|", ",", "(", ")", "[", "]", "{", "}", ":", ";", "<", ">", "+", "-", "*", "/", "%", "?"}
+
+func tokenize(expr string) ([]token, error) {
+	var tokens []token
+	i := 0
+	for i < len(expr) {
+		c := expr[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+
+		case c == '.':
+			if strings.HasPrefix(expr[i:], "..") {
+				tokens = append(tokens, token{kind: tokenRecurse, pos: i})
+				i += 2
+				continue
+			}
+			if i+1 < len(expr) && isIdentStart(rune(expr[i+1])) {
+				end := identEnd(expr, i+1)
+				tokens = append(tokens, token{kind: tokenField, text: expr[i+1 : end], pos: i})
+				i = end
+				continue
+			}
+			if i+1 < len(expr) && expr[i+1] == '"' {
+				s, end, err := readString(expr, i+1)
+				if err != nil {
+					return nil, err
+				}
+				tokens = append(tokens, token{kind: tokenField, text: s, pos: i})
+				i = end
+				continue
+			}
+			tokens = append(tokens, token{kind: tokenDot, pos: i})
+			i++
+
+		case c == '"':
+			s, end, err := readString(expr, i)
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, token{kind: tokenString, text: s, pos: i})
+			i = end
+
+		case c >= '0' && c <= '9':
+			end := i
+			for end < len(expr) && (expr[end] >= '0' && expr[end] <= '9' || expr[end] == '.' || expr[end] == 'e' || expr[end] == 'E') {
+				end++
+			}
+			n, err := strconv.ParseFloat(expr[i:end], 64)
+			if err != nil {
+				return nil, &ParseError{Expr: expr, Pos: i, Msg: fmt.Sprintf("invalid number %q", expr[i:end])}
+			}
+			tokens = append(tokens, token{kind: tokenNumber, num: n, text: expr[i:end], pos: i})
+			i = end
+
+		case isIdentStart(rune(c)):
+			end := identEnd(expr, i)
+			tokens = append(tokens, token{kind: tokenIdent, text: expr[i:end], pos: i})
+			i = end
+
+		default:
+			matched := false
+			for _, op := range operators {
+				if strings.HasPrefix(expr[i:], op) {
+					tokens = append(tokens, token{kind: tokenOp, text: op, pos: i})
+					i += len(op)
+					matched = true
+					break
+				}
+			}
+			if !matched && c == '$' {
+				return nil, &ParseError{Expr: expr, Pos: i, Msg: `variables ("as $x", "reduce" and "foreach") are not supported`}
+			}
+			if !matched {
+				return nil, &ParseError{Expr: expr, Pos: i, Msg: fmt.Sprintf("unexpected character %q", c)}
+			}
+		}
+	}
+	tokens = append(tokens, token{kind: tokenEOF, pos: len(expr)})
+	return tokens, nil
+}
+
+func isIdentStart(r rune) bool {
+	return r == '_' || unicode.IsLetter(r)
+}
+
+func identEnd(expr string, start int) int {
+	end := start
+	for end < len(expr) && (expr[end] == '_' || unicode.IsLetter(rune(expr[end])) || unicode.IsDigit(rune(expr[end]))) {
+		end++
+	}
+	return end
+}
+
+// readString reads a double-quoted string starting at start, returns the unquoted string and the end offset
+func readString(expr string, start int) (string, int, error) {
+	escaped := false
+	for end := start + 1; end < len(expr); end++ {
+		switch {
+		case escaped:
+			escaped = false
+		case expr[end] == '\\':
+			escaped = true
+		case expr[end] == '"':
+			s, err := strconv.Unquote(expr[start : end+1])
+			if err != nil {
+				return "", 0, &ParseError{Expr: expr, Pos: start, Msg: fmt.Sprintf("invalid string %s", expr[start:end+1])}
+			}
+			return s, end + 1, nil
+		}
+	}
+	return "", 0, &ParseError{Expr: expr, Pos: start, Msg: "unterminated string"}
+}
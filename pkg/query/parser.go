@@ -0,0 +1,471 @@
+package query
+
+import "fmt"
+
+type parser struct {
+	expr   string
+	tokens []token
+	pos    int
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokenEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *parser) isOp(ops ...string) bool {
+	t := p.peek()
+	if t.kind != tokenOp {
+		return false
+	}
+	for _, op := range ops {
+		if t.text == op {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *parser) isKeyword(keyword string) bool {
+	t := p.peek()
+	return t.kind == tokenIdent && t.text == keyword
+}
+
+func (p *parser) expectOp(op string) error {
+	if !p.isOp(op) {
+		return p.errorf("expected %q", op)
+	}
+	p.next()
+	return nil
+}
+
+func (p *parser) expectKeyword(keyword string) error {
+	if !p.isKeyword(keyword) {
+		return p.errorf("expected %q", keyword)
+	}
+	p.next()
+	return nil
+}
+
+func (p *parser) errorf(format string, args ...any) error {
+	t := p.peek()
+	msg := fmt.Sprintf(format, args...)
+	if t.kind == tokenEOF {
+		msg += ", got end of expression"
+	} else {
+		msg += fmt.Sprintf(", got %q", p.expr[t.pos:min(len(p.expr), t.pos+max(len(t.text), 1))])
+	}
+	return &ParseError{Expr: p.expr, Pos: t.pos, Msg: msg}
+}
+
+// parsePipe parses "a | b", the operator with the lowest precedence
+func (p *parser) parsePipe() (node, error) {
+	left, err := p.parseComma()
+	if err != nil {
+		return nil, err
+	}
+	if p.isOp("|") {
+		p.next()
+		right, err := p.parsePipe()
+		if err != nil {
+			return nil, err
+		}
+		return &pipeNode{left: left, right: right}, nil
+	}
+	return left, nil
+}
+
+func (p *parser) parseComma() (node, error) {
+	left, err := p.parseAlternative()
+	if err != nil {
+		return nil, err
+	}
+	for p.isOp(",") {
+		p.next()
+		right, err := p.parseAlternative()
+		if err != nil {
+			return nil, err
+		}
+		left = &commaNode{left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseAlternative() (node, error) {
+	left, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.isOp("//") {
+		p.next()
+		right, err := p.parseAlternative()
+		if err != nil {
+			return nil, err
+		}
+		return &alternativeNode{left: left, right: right}, nil
+	}
+	return left, nil
+}
+
+func (p *parser) parseOr() (node, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.isKeyword("or") {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &orNode{left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseAnd() (node, error) {
+	left, err := p.parseCompare()
+	if err != nil {
+		return nil, err
+	}
+	for p.isKeyword("and") {
+		p.next()
+		right, err := p.parseCompare()
+		if err != nil {
+			return nil, err
+		}
+		left = &andNode{left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseCompare() (node, error) {
+	left, err := p.parseAdditive()
+	if err != nil {
+		return nil, err
+	}
+	if p.isOp("==", "!=", "<", "<=", ">", ">=") {
+		op := p.next().text
+		right, err := p.parseAdditive()
+		if err != nil {
+			return nil, err
+		}
+		return &binaryNode{op: op, left: left, right: right}, nil
+	}
+	return left, nil
+}
+
+func (p *parser) parseAdditive() (node, error) {
+	left, err := p.parseMultiplicative()
+	if err != nil {
+		return nil, err
+	}
+	for p.isOp("+", "-") {
+		op := p.next().text
+		right, err := p.parseMultiplicative()
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryNode{op: op, left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseMultiplicative() (node, error) {
+	left, err := p.parsePostfix()
+	if err != nil {
+		return nil, err
+	}
+	for p.isOp("*", "/", "%") {
+		op := p.next().text
+		right, err := p.parsePostfix()
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryNode{op: op, left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parsePostfix() (node, error) {
+	target, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		t := p.peek()
+		switch {
+		case t.kind == tokenField:
+			p.next()
+			target = &fieldNode{target: target, name: t.text}
+		case t.kind == tokenDot && p.tokens[p.pos+1].kind == tokenOp && p.tokens[p.pos+1].text == "[":
+			p.next() // .a.[0] is the same as .a[0]
+		case p.isOp("["):
+			p.next()
+			target, err = p.parseBracketSuffix(target)
+			if err != nil {
+				return nil, err
+			}
+		case p.isOp("?"):
+			p.next()
+			target = optional(target)
+		default:
+			return target, nil
+		}
+	}
+}
+
+// optional applies the ? operator to target, the same as jq, errors of a path operation only drop the outputs
+// of the failing inputs, e.g. .items[].spec.containers[]? keeps the containers of the other items,
+// other expressions keep the outputs before their first error
+func optional(target node) node {
+	switch n := target.(type) {
+	case *fieldNode:
+		n.optional = true
+	case *indexNode:
+		n.optional = true
+	case *sliceNode:
+		n.optional = true
+	case *iterateNode:
+		n.optional = true
+	default:
+		return &tryNode{body: target}
+	}
+	return target
+}
+
+// parseBracketSuffix parses [], [expr] and [from:to] after the opening bracket
+func (p *parser) parseBracketSuffix(target node) (node, error) {
+	if p.isOp("]") {
+		p.next()
+		return &iterateNode{target: target}, nil
+	}
+
+	var from, to node
+	var err error
+	if !p.isOp(":") {
+		from, err = p.parsePipe()
+		if err != nil {
+			return nil, err
+		}
+		if p.isOp("]") {
+			p.next()
+			return &indexNode{target: target, index: from}, nil
+		}
+		if !p.isOp(":") {
+			return nil, p.errorf("expected %q", "]")
+		}
+	}
+	if err := p.expectOp(":"); err != nil {
+		return nil, err
+	}
+	if !p.isOp("]") {
+		to, err = p.parsePipe()
+		if err != nil {
+			return nil, err
+		}
+	}
+	if err := p.expectOp("]"); err != nil {
+		return nil, err
+	}
+	return &sliceNode{target: target, from: from, to: to}, nil
+}
+
+func (p *parser) parsePrimary() (node, error) {
+	t := p.peek()
+	switch t.kind {
+	case tokenDot:
+		p.next()
+		return &identityNode{}, nil
+	case tokenRecurse:
+		p.next()
+		return &recurseNode{}, nil
+	case tokenField:
+		p.next()
+		return &fieldNode{target: &identityNode{}, name: t.text}, nil
+	case tokenString:
+		p.next()
+		return &literalNode{value: t.text}, nil
+	case tokenNumber:
+		p.next()
+		return &literalNode{value: t.num}, nil
+	case tokenIdent:
+		return p.parseIdent()
+	case tokenOp:
+		switch t.text {
+		case "-":
+			p.next()
+			operand, err := p.parsePostfix()
+			if err != nil {
+				return nil, err
+			}
+			return &binaryNode{op: "-", left: &literalNode{value: float64(0)}, right: operand}, nil
+		case "(":
+			p.next()
+			body, err := p.parsePipe()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expectOp(")"); err != nil {
+				return nil, err
+			}
+			return body, nil
+		case "[":
+			p.next()
+			if p.isOp("]") {
+				p.next()
+				return &arrayNode{}, nil
+			}
+			body, err := p.parsePipe()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expectOp("]"); err != nil {
+				return nil, err
+			}
+			return &arrayNode{body: body}, nil
+		case "{":
+			p.next()
+			return p.parseObject()
+		}
+	}
+	return nil, p.errorf("unexpected token")
+}
+
+func (p *parser) parseIdent() (node, error) {
+	t := p.next()
+	switch t.text {
+	case "true":
+		return &literalNode{value: true}, nil
+	case "false":
+		return &literalNode{value: false}, nil
+	case "null":
+		return &literalNode{value: nil}, nil
+	case "if":
+		return p.parseIf()
+	case "and", "or", "then", "elif", "else", "end":
+		p.pos--
+		return nil, p.errorf("unexpected keyword")
+	case "try", "catch":
+		return nil, &ParseError{Expr: p.expr, Pos: t.pos, Msg: fmt.Sprintf("%q is not supported, use the ? operator instead", t.text)}
+	case "reduce", "foreach", "def", "label", "import", "include":
+		return nil, &ParseError{Expr: p.expr, Pos: t.pos, Msg: fmt.Sprintf("%q is not supported", t.text)}
+	}
+
+	call := &callNode{name: t.text, pos: t.pos}
+	if p.isOp("(") {
+		p.next()
+		for {
+			arg, err := p.parsePipe()
+			if err != nil {
+				return nil, err
+			}
+			call.args = append(call.args, arg)
+			if !p.isOp(";") {
+				break
+			}
+			p.next()
+		}
+		if err := p.expectOp(")"); err != nil {
+			return nil, err
+		}
+	}
+	if err := checkFunction(call); err != nil {
+		return nil, &ParseError{Expr: p.expr, Pos: t.pos, Msg: err.Error()}
+	}
+	return call, nil
+}
+
+// parseIf parses "if cond then a elif cond then b else c end", the "if" keyword is already consumed
+func (p *parser) parseIf() (node, error) {
+	cond, err := p.parsePipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expectKeyword("then"); err != nil {
+		return nil, err
+	}
+	then, err := p.parsePipe()
+	if err != nil {
+		return nil, err
+	}
+
+	n := &ifNode{cond: cond, then: then}
+	switch {
+	case p.isKeyword("elif"):
+		p.next()
+		n.otherwise, err = p.parseIf()
+		if err != nil {
+			return nil, err
+		}
+		return n, nil
+	case p.isKeyword("else"):
+		p.next()
+		n.otherwise, err = p.parsePipe()
+		if err != nil {
+			return nil, err
+		}
+	}
+	if err := p.expectKeyword("end"); err != nil {
+		return nil, err
+	}
+	return n, nil
+}
+
+// parseObject parses object construction, the opening brace is already consumed
+func (p *parser) parseObject() (node, error) {
+	obj := &objectNode{}
+	if p.isOp("}") {
+		p.next()
+		return obj, nil
+	}
+	for {
+		var entry objectEntry
+		t := p.peek()
+		switch {
+		case t.kind == tokenIdent || t.kind == tokenString:
+			p.next()
+			entry.key = &literalNode{value: t.text}
+			entry.value = &fieldNode{target: &identityNode{}, name: t.text}
+		case p.isOp("("):
+			p.next()
+			key, err := p.parsePipe()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expectOp(")"); err != nil {
+				return nil, err
+			}
+			entry.key = key
+		default:
+			return nil, p.errorf("expected object key")
+		}
+
+		if p.isOp(":") {
+			p.next()
+			value, err := p.parseAlternative()
+			if err != nil {
+				return nil, err
+			}
+			entry.value = value
+		} else if entry.value == nil {
+			return nil, p.errorf("expected %q", ":")
+		}
+		obj.entries = append(obj.entries, entry)
+
+		if p.isOp("}") {
+			p.next()
+			return obj, nil
+		}
+		if err := p.expectOp(","); err != nil {
+			return nil, err
+		}
+	}
+}
@@ -0,0 +1,66 @@
+// Package query implements a subset of the jq language, which is used to query the JSON output of kubectl in-process.
+//
+// Supported: paths (.a.b, .["a"], .[0], .[1:3], .[], ..), the optional operator ?, pipes, commas, literals,
+// array and object construction, arithmetic, comparisons, and/or/not, the alternative operator //,
+// if-then-elif-else-end, and common functions like select, map, length, keys, has, test, sort_by and group_by.
+//
+// Not supported: variables (as $x), reduce, foreach, try/catch (? is supported), def, and functions like del and paths,
+// they are rejected by Parse with an error.
+package query
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Query is a parsed expression
+type Query struct {
+	expr string
+	root node
+}
+
+// Parse parses the expression, a *ParseError is returned with the position if the expression is invalid
+func Parse(expr string) (*Query, error) {
+	tokens, err := tokenize(expr)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{expr: expr, tokens: tokens}
+	if p.peek().kind == tokenEOF {
+		return nil, &ParseError{Expr: expr, Pos: 0, Msg: "empty expression"}
+	}
+	root, err := p.parsePipe()
+	if err != nil {
+		return nil, err
+	}
+	if p.peek().kind != tokenEOF {
+		return nil, p.errorf("unexpected token")
+	}
+
+	return &Query{expr: expr, root: root}, nil
+}
+
+// String returns the original expression
+func (q *Query) String() string {
+	return q.expr
+}
+
+// Run evaluates the query with the input, which must be a value decoded by encoding/json,
+// all outputs of the query are returned, the same as jq, a query may produce zero or more outputs.
+func (q *Query) Run(input any) ([]any, error) {
+	outputs, err := q.root.eval(input)
+	if err != nil {
+		return nil, fmt.Errorf("failed to evaluate %q: %v", q.expr, err)
+	}
+	return outputs, nil
+}
+
+// RunJSON decodes the JSON document and evaluates the query with it
+func (q *Query) RunJSON(data []byte) ([]any, error) {
+	var input any
+	if err := json.Unmarshal(data, &input); err != nil {
+		return nil, fmt.Errorf("failed to parse JSON: %v", err)
+	}
+	return q.Run(input)
+}
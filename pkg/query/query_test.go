@@ -0,0 +1,355 @@
+package query
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// pods is a kubectl List output used as input of most tests
+const pods = `{
+  "apiVersion": "v1",
+  "kind": "List",
+  "items": [
+    {"metadata": {"name": "web-1", "namespace": "default", "labels": {"app": "web"}}, "status": {"phase": "Running", "restarts": 0}},
+    {"metadata": {"name": "web-2", "namespace": "default", "labels": {"app": "web"}}, "status": {"phase": "Pending", "restarts": 3}},
+    {"metadata": {"name": "dns-1", "namespace": "kube-system"}, "status": {"phase": "Running", "restarts": 12}}
+  ]
+}`
+
+type runTest struct {
+	expr  string
+	input string
+	want  string // the outputs as a JSON array
+}
+
+func runTests(t *testing.T, tests []runTest) {
+	t.Helper()
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			q, err := Parse(tt.expr)
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			outputs, err := q.RunJSON([]byte(tt.input))
+			if err != nil {
+				t.Fatalf("RunJSON() error = %v", err)
+			}
+			if outputs == nil {
+				outputs = []any{}
+			}
+			got, err := json.Marshal(outputs)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var want any
+			if err := json.Unmarshal([]byte(tt.want), &want); err != nil {
+				t.Fatalf("invalid want %s: %v", tt.want, err)
+			}
+			wantJSON, _ := json.Marshal(want)
+			if string(got) != string(wantJSON) {
+				t.Errorf("RunJSON() = %s, want %s", got, wantJSON)
+			}
+		})
+	}
+}
+
+func TestPaths(t *testing.T) {
+	runTests(t, []runTest{
+		{expr: ".", input: `{"a":1}`, want: `[{"a":1}]`},
+		{expr: ".kind", input: pods, want: `["List"]`},
+		{expr: ".items[0].metadata.name", input: pods, want: `["web-1"]`},
+		{expr: ".items[-1].metadata.name", input: pods, want: `["dns-1"]`},
+		{expr: ".items[5]", input: pods, want: `[null]`},
+		{expr: `.["kind"]`, input: pods, want: `["List"]`},
+		{expr: `."api-version"`, input: `{"api-version":"v1"}`, want: `["v1"]`},
+		{expr: ".items.[0].metadata.name", input: pods, want: `["web-1"]`},
+		{expr: ".missing", input: pods, want: `[null]`},
+		{expr: ".missing.deeper", input: pods, want: `[null]`},
+		{expr: ".a", input: `null`, want: `[null]`},
+		{expr: ".items[].metadata.name", input: pods, want: `["web-1","web-2","dns-1"]`},
+		{expr: ".[]", input: `{"a":1,"b":2}`, want: `[1,2]`},
+		{expr: ".[1:3]", input: `[0,1,2,3]`, want: `[[1,2]]`},
+		{expr: ".[:2]", input: `[0,1,2,3]`, want: `[[0,1]]`},
+		{expr: ".[-2:]", input: `[0,1,2,3]`, want: `[[2,3]]`},
+		{expr: ".[1:10]", input: `[0,1,2]`, want: `[[1,2]]`},
+		{expr: ".[1:3]", input: `"abcd"`, want: `["bc"]`},
+		{expr: "[..|numbers]", input: `{"a":1,"b":[2,{"c":3}]}`, want: `[[1,2,3]]`},
+		{expr: ".a[]?", input: `{"a":1}`, want: `[]`},
+		{expr: ".a.b?", input: `{"a":"x"}`, want: `[]`},
+		{expr: "[.[] | .a?]", input: `[1,{"a":2}]`, want: `[[2]]`},
+		{expr: ".[].a?", input: `[{"a":1},"x",{"a":2}]`, want: `[1,2]`},
+		{expr: ".[][]?", input: `[[1],2,[3]]`, want: `[1,3]`},
+		{expr: ".[][0]?", input: `[[1],{"a":2},[3]]`, want: `[1,3]`},
+		{expr: ".[][1:]?", input: `["ab",1,"cd"]`, want: `["b","d"]`},
+		{expr: "(.[] | .a)?", input: `[{"a":1},"x",{"a":2}]`, want: `[1]`},
+		{expr: "[.[] | (1, .a, 2)?]", input: `[0]`, want: `[[1]]`},
+		{expr: `.items[] | .metadata.labels.app // "none"`, input: pods, want: `["web","web","none"]`},
+		{expr: `.items[].metadata.labels.app // "none"`, input: pods, want: `["web","web"]`},
+	})
+}
+
+func TestPipesAndCommas(t *testing.T) {
+	runTests(t, []runTest{
+		{expr: ".items[] | .metadata.name", input: pods, want: `["web-1","web-2","dns-1"]`},
+		{expr: ".items[] | .metadata | .namespace", input: pods, want: `["default","default","kube-system"]`},
+		{expr: ".a, .b", input: `{"a":1,"b":2}`, want: `[1,2]`},
+		{expr: ".[] | . * 2, . + 1", input: `[1,2]`, want: `[2,2,4,3]`},
+		{expr: "(.a, .b) | . + 10", input: `{"a":1,"b":2}`, want: `[11,12]`},
+		{expr: "[.[] | select(. > 1)] | length", input: `[1,2,3]`, want: `[2]`},
+		{expr: ".[] | empty", input: `[1,2]`, want: `[]`},
+		{expr: "[.[] | (., .)]", input: `[1,2]`, want: `[[1,1,2,2]]`},
+	})
+}
+
+func TestOperators(t *testing.T) {
+	runTests(t, []runTest{
+		{expr: "1 + 2 * 3", input: `null`, want: `[7]`},
+		{expr: "(1 + 2) * 3", input: `null`, want: `[9]`},
+		{expr: "10 / 4", input: `null`, want: `[2.5]`},
+		{expr: "10 % 3", input: `null`, want: `[1]`},
+		{expr: "-.a", input: `{"a":2}`, want: `[-2]`},
+		{expr: "1 - -1", input: `null`, want: `[2]`},
+		{expr: `"a" + "b"`, input: `null`, want: `["ab"]`},
+		{expr: "[1] + [2]", input: `null`, want: `[[1,2]]`},
+		{expr: `{"a":1} + {"b":2}`, input: `null`, want: `[{"a":1,"b":2}]`},
+		{expr: "null + 1", input: `null`, want: `[1]`},
+		{expr: "[1,2,3] - [2]", input: `null`, want: `[[1,3]]`},
+		{expr: ".a == 1", input: `{"a":1}`, want: `[true]`},
+		{expr: ".a != 1", input: `{"a":1}`, want: `[false]`},
+		{expr: `"b" > "a"`, input: `null`, want: `[true]`},
+		{expr: "1 <= 1, 1 < 1, 2 >= 3", input: `null`, want: `[true,false,false]`},
+		{expr: "null < false, false < 0, 0 < \"\", \"\" < [], [] < {}", input: `null`, want: `[true,true,true,true,true]`},
+		{expr: `{"a":[1]} == {"a":[1]}`, input: `null`, want: `[true]`},
+		{expr: "true and false, true or false", input: `null`, want: `[false,true]`},
+		{expr: "null and (1 / 0), 1 or (1 / 0)", input: `null`, want: `[false,true]`},
+		{expr: "(true, false) and true", input: `null`, want: `[true,false]`},
+		{expr: "not", input: `null`, want: `[true]`},
+		{expr: ".a // .b", input: `{"a":false,"b":2}`, want: `[2]`},
+		{expr: "(.a, .b) // 3", input: `{"a":null,"b":1}`, want: `[1]`},
+		{expr: "empty // 3", input: `null`, want: `[3]`},
+		{expr: `.items[] | select(.status.phase == "Running" and .status.restarts > 5) | .metadata.name`, input: pods, want: `["dns-1"]`},
+	})
+}
+
+func TestConstruction(t *testing.T) {
+	runTests(t, []runTest{
+		{expr: "[]", input: `null`, want: `[[]]`},
+		{expr: "[.items[].status.restarts]", input: pods, want: `[[0,3,12]]`},
+		{expr: "{}", input: `null`, want: `[{}]`},
+		{expr: "{a: 1, \"b\": 2}", input: `null`, want: `[{"a":1,"b":2}]`},
+		{expr: "{kind, apiVersion}", input: pods, want: `[{"kind":"List","apiVersion":"v1"}]`},
+		{expr: "{(.kind): 1}", input: pods, want: `[{"List":1}]`},
+		{expr: ".items[0] | {name: .metadata.name, phase: .status.phase}", input: pods, want: `[{"name":"web-1","phase":"Running"}]`},
+		{expr: "{a: (1, 2)}", input: `null`, want: `[{"a":1},{"a":2}]`},
+		{expr: "{a: 1 // 2}", input: `null`, want: `[{"a":1}]`},
+		{expr: `"x", 1.5, 1e2, true, false, null`, input: `null`, want: `["x",1.5,100,true,false,null]`},
+		{expr: `"tab\tquote\" é"`, input: `null`, want: `["tab\tquote\" é"]`},
+		{expr: `if . > 1 then "big" elif . == 1 then "one" else "small" end`, input: `1`, want: `["one"]`},
+		{expr: `.[] | if . then "yes" else "no" end`, input: `[true,null,0]`, want: `["yes","no","yes"]`},
+		{expr: `if . then 1 end`, input: `false`, want: `[false]`},
+		{expr: `if (true, false) then 1 else 2 end`, input: `null`, want: `[1,2]`},
+	})
+}
+
+func TestFunctions(t *testing.T) {
+	runTests(t, []runTest{
+		{expr: "empty", input: `1`, want: `[]`},
+		{expr: "not", input: `1`, want: `[false]`},
+		{expr: "[.[] | type]", input: `[null,true,1,"s",[],{}]`, want: `[["null","boolean","number","string","array","object"]]`},
+		{expr: "[.[] | length]", input: `[null,-3,"héllo",[1,2],{"a":1}]`, want: `[[0,3,5,2,1]]`},
+		{expr: "keys", input: `{"b":1,"a":2}`, want: `[["a","b"]]`},
+		{expr: "keys", input: `[5,6]`, want: `[[0,1]]`},
+		{expr: "[values]", input: `[1,null,2]`, want: `[[1,2]]`},
+		{expr: "add", input: `[1,2,3]`, want: `[6]`},
+		{expr: "add", input: `["a","b"]`, want: `["ab"]`},
+		{expr: "add", input: `[]`, want: `[null]`},
+		{expr: "any, all", input: `[true,false]`, want: `[true,false]`},
+		{expr: "any, all", input: `[]`, want: `[false,true]`},
+		{expr: "sort", input: `[3,"a",null,1,[1],{"a":1},true]`, want: `[[null,true,1,3,"a",[1],{"a":1}]]`},
+		{expr: "unique", input: `[2,1,2,1]`, want: `[[1,2]]`},
+		{expr: "reverse", input: `[1,2,3]`, want: `[[3,2,1]]`},
+		{expr: "reverse", input: `"abc"`, want: `["cba"]`},
+		{expr: "min, max", input: `[3,1,2]`, want: `[1,3]`},
+		{expr: "min", input: `[]`, want: `[null]`},
+		{expr: "[.[] | floor], [.[] | ceil], [.[] | round]", input: `[1.5,-1.5]`, want: `[[1,-2],[2,-1],[2,-2]]`},
+		{expr: "[.[] | tostring]", input: `[1,"s",[1],null]`, want: `[["1","s","[1]","null"]]`},
+		{expr: "[.[] | tonumber]", input: `["1.5",2]`, want: `[[1.5,2]]`},
+		{expr: "tojson", input: `{"a":[1,"x"]}`, want: `["{\"a\":[1,\"x\"]}"]`},
+		{expr: "fromjson", input: `"{\"a\":1}"`, want: `[{"a":1}]`},
+		{expr: "ascii_downcase, ascii_upcase", input: `"AbC"`, want: `["abc","ABC"]`},
+		{expr: "to_entries", input: `{"a":1,"b":2}`, want: `[[{"key":"a","value":1},{"key":"b","value":2}]]`},
+		{expr: "to_entries", input: `["a","b"]`, want: `[[{"key":0,"value":"a"},{"key":1,"value":"b"}]]`},
+		{expr: "from_entries", input: `[{"key":"a","value":1},{"name":"b","value":2},{"k":"c","v":3}]`, want: `[{"a":1,"b":2,"c":3}]`},
+		{expr: "with_entries({key: .key, value: (.value + 1)})", input: `{"a":1}`, want: `[{"a":2}]`},
+		{expr: "first, last", input: `[1,2,3]`, want: `[1,3]`},
+		{expr: "first(.[]), last(.[])", input: `[1,2,3]`, want: `[1,3]`},
+		{expr: "[first(empty)]", input: `null`, want: `[[]]`},
+		{expr: "[.[] | select(. % 2 == 0)]", input: `[1,2,3,4]`, want: `[[2,4]]`},
+		{expr: "map(. * 10)", input: `[1,2]`, want: `[[10,20]]`},
+		{expr: "map(.a)", input: `[{"a":1},{"b":2}]`, want: `[[1,null]]`},
+		{expr: "map_values(. + 1)", input: `{"a":1,"b":2}`, want: `[{"a":2,"b":3}]`},
+		{expr: "map_values(empty)", input: `[1,2]`, want: `[[]]`},
+		{expr: `has("a"), has("z")`, input: `{"a":1}`, want: `[true,false]`},
+		{expr: "has(1), has(5)", input: `[0,1]`, want: `[true,false]`},
+		{expr: `contains("bar")`, input: `"foobar"`, want: `[true]`},
+		{expr: `contains(["b"]), contains(["z"])`, input: `["a","bc"]`, want: `[true,false]`},
+		{expr: `contains({a: {b: 1}})`, input: `{"a":{"b":1,"c":2},"d":3}`, want: `[true]`},
+		{expr: `startswith("web"), endswith("-1")`, input: `"web-1"`, want: `[true,true]`},
+		{expr: `ltrimstr("web-"), rtrimstr("-1")`, input: `"web-1"`, want: `["1","web"]`},
+		{expr: `ltrimstr("x")`, input: `"web"`, want: `["web"]`},
+		{expr: `split(",")`, input: `"a,b,,c"`, want: `[["a","b","","c"]]`},
+		{expr: `split("")`, input: `"ab"`, want: `[["a","b"]]`},
+		{expr: `test("^web-\\d")`, input: `"web-1"`, want: `[true]`},
+		{expr: `test("WEB"), test("WEB"; "i")`, input: `"web"`, want: `[false,true]`},
+		{expr: `join(", ")`, input: `["a",1,null,true]`, want: `["a, 1, , true"]`},
+		{expr: "[.[] | numbers], [.[] | strings], [.[] | booleans]", input: `[1,"a",true,null]`, want: `[[1],["a"],[true]]`},
+		{expr: "[.[] | nulls], [.[] | arrays], [.[] | objects]", input: `[null,[1],{"a":1}]`, want: `[[null],[[1]],[{"a":1}]]`},
+		{expr: "sort_by(.status.restarts) | map(.metadata.name)", input: `[{"metadata":{"name":"a"},"status":{"restarts":5}},{"metadata":{"name":"b"},"status":{"restarts":1}}]`, want: `[["b","a"]]`},
+		{expr: `[.items[]] | group_by(.metadata.namespace) | map({ns: .[0].metadata.namespace, count: length})`, input: pods, want: `[[{"ns":"default","count":2},{"ns":"kube-system","count":1}]]`},
+		{expr: "unique_by(length)", input: `["a","bb","c"]`, want: `[["a","bb"]]`},
+		{expr: "min_by(.n).id, max_by(.n).id", input: `[{"id":1,"n":3},{"id":2,"n":1},{"id":3,"n":9}]`, want: `[2,3]`},
+		{expr: "[limit(2; .[])]", input: `[1,2,3]`, want: `[[1,2]]`},
+		{expr: "[limit(0; .[])]", input: `[1,2,3]`, want: `[[]]`},
+	})
+}
+
+// kubectlQueries are the examples from the README
+// containerPods is a kubectl List output with a pod without containerStatuses in the middle
+const containerPods = `{"kind":"List","items":[
+  {"metadata":{"name":"web-1"},"status":{"phase":"Running","containerStatuses":[{"name":"web","restartCount":1}]}},
+  {"metadata":{"name":"web-2"},"status":{"phase":"Pending"}},
+  {"metadata":{"name":"web-3"},"status":{"phase":"Running","containerStatuses":[{"name":"web","restartCount":6}]}}
+]}`
+
+func TestKubectlQueries(t *testing.T) {
+	runTests(t, []runTest{
+		{expr: `[.items[] | select(.status.phase != "Running")] | length`, input: pods, want: `[1]`},
+		{expr: `.items | map(select(.metadata.labels.app == "web") | .metadata.name)`, input: pods, want: `[["web-1","web-2"]]`},
+		{expr: `.items | map(.status.restarts) | add`, input: pods, want: `[15]`},
+		{expr: `[.items[].metadata.namespace] | unique`, input: pods, want: `[["default","kube-system"]]`},
+		{expr: `.items[] | select(.metadata.name | test("^dns")) | .status.restarts`, input: pods, want: `[12]`},
+		// a pod without containerStatuses, e.g. a pending one, only drops its own restart counts
+		{expr: `.items[].status.containerStatuses[]?.restartCount`, input: containerPods, want: `[1,6]`},
+		{expr: `[.items[].status.containerStatuses[]?.restartCount] | add`, input: containerPods, want: `[7]`},
+	})
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		expr    string
+		wantPos int
+		wantMsg string
+	}{
+		{expr: "", wantPos: 0, wantMsg: "empty expression"},
+		{expr: "   ", wantPos: 0, wantMsg: "empty expression"},
+		{expr: ".a |", wantPos: 4, wantMsg: "unexpected token, got end of expression"},
+		{expr: ".a ]", wantPos: 3, wantMsg: `unexpected token, got "]"`},
+		{expr: ".[1", wantPos: 3, wantMsg: `expected "]", got end of expression`},
+		{expr: ".[1;2]", wantPos: 3, wantMsg: `expected "]", got ";"`},
+		{expr: "(.a", wantPos: 3, wantMsg: `expected ")", got end of expression`},
+		{expr: "[.a", wantPos: 3, wantMsg: `expected "]", got end of expression`},
+		{expr: "{a: 1", wantPos: 5, wantMsg: `expected ",", got end of expression`},
+		{expr: "{1: 2}", wantPos: 1, wantMsg: `expected object key, got "1"`},
+		{expr: `"abc`, wantPos: 0, wantMsg: "unterminated string"},
+		{expr: `.a == "\q"`, wantPos: 6, wantMsg: `invalid string "\q"`},
+		{expr: ".a # comment", wantPos: 3, wantMsg: `unexpected character '#'`},
+		{expr: "1.2.3", wantPos: 0, wantMsg: `invalid number "1.2.3"`},
+		{expr: "if . then 1", wantPos: 11, wantMsg: `expected "end", got end of expression`},
+		{expr: "if . 1 end", wantPos: 5, wantMsg: `expected "then", got "1"`},
+		{expr: ". | end", wantPos: 4, wantMsg: `unexpected keyword, got "end"`},
+		{expr: "and", wantPos: 0, wantMsg: `unexpected keyword, got "and"`},
+		{expr: ".items[] | nope", wantPos: 11, wantMsg: "unknown function nope/0"},
+		{expr: "map", wantPos: 0, wantMsg: "function map does not accept 0 arguments"},
+		{expr: "length(1)", wantPos: 0, wantMsg: "function length does not accept 1 arguments"},
+		{expr: "test(1; 2; 3)", wantPos: 0, wantMsg: "function test does not accept 3 arguments"},
+		{expr: "select(.a", wantPos: 9, wantMsg: `expected ")", got end of expression`},
+		{expr: ".items[] as $item | $item", wantPos: 12, wantMsg: `variables ("as $x", "reduce" and "foreach") are not supported`},
+		{expr: "reduce .[] as $x (0; . + $x)", wantPos: 14, wantMsg: `variables ("as $x", "reduce" and "foreach") are not supported`},
+		{expr: `.a | try .b catch "x"`, wantPos: 5, wantMsg: `"try" is not supported, use the ? operator instead`},
+		{expr: "def f: .; f", wantPos: 0, wantMsg: `"def" is not supported`},
+		{expr: "del(.a)", wantPos: 0, wantMsg: "unknown function del/1"},
+		{expr: "[paths]", wantPos: 1, wantMsg: "unknown function paths/0"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			_, err := Parse(tt.expr)
+			var parseErr *ParseError
+			if !errors.As(err, &parseErr) {
+				t.Fatalf("Parse() error = %v, want a ParseError", err)
+			}
+			if parseErr.Pos != tt.wantPos || parseErr.Msg != tt.wantMsg {
+				t.Errorf("Parse() error at %d %q, want at %d %q", parseErr.Pos, parseErr.Msg, tt.wantPos, tt.wantMsg)
+			}
+		})
+	}
+}
+
+func TestParseErrorMessage(t *testing.T) {
+	_, err := Parse(".items[] | nope")
+	if got, want := fmt.Sprint(err), `unknown function nope/0 at position 12 in ".items[] | nope"`; got != want {
+		t.Errorf("Parse() error = %q, want %q", got, want)
+	}
+}
+
+func TestRunErrors(t *testing.T) {
+	tests := []struct {
+		expr    string
+		input   string
+		wantErr string
+	}{
+		{expr: ".a", input: `[1]`, wantErr: `cannot index array with "a"`},
+		{expr: ".[0]", input: `{"a":1}`, wantErr: "cannot index object with number"},
+		{expr: ".[]", input: `1`, wantErr: "cannot iterate over number"},
+		{expr: `1 + "a"`, input: `null`, wantErr: "cannot be added"},
+		{expr: `{} - 1`, input: `null`, wantErr: `object (map[]) and number (1) cannot be used with "-"`},
+		{expr: "1 / 0", input: `null`, wantErr: "cannot divide 1 by zero"},
+		{expr: "1 % 0", input: `null`, wantErr: "cannot divide 1 by zero"},
+		{expr: "length", input: `true`, wantErr: "boolean (true) has no length"},
+		{expr: "keys", input: `1`, wantErr: "number has no keys"},
+		{expr: "sort", input: `{"a":1}`, wantErr: "object cannot be used with sort, it must be an array"},
+		{expr: "add", input: `[1,"a"]`, wantErr: "cannot be added"},
+		{expr: "tonumber", input: `"abc"`, wantErr: `cannot parse "abc" as number`},
+		{expr: "fromjson", input: `1`, wantErr: "number cannot be parsed as JSON"},
+		{expr: `test("(")`, input: `"a"`, wantErr: "invalid regex"},
+		{expr: "test(1)", input: `"a"`, wantErr: "argument must be a string, got number"},
+		{expr: `test("a")`, input: `1`, wantErr: "number cannot be matched, as it is not a string"},
+		{expr: `startswith("a")`, input: `1`, wantErr: "input must be a string, got number"},
+		{expr: "join(1)", input: `["a"]`, wantErr: "join separator must be a string, got number"},
+		{expr: `join(",")`, input: `"a"`, wantErr: "cannot join string"},
+		{expr: "limit(\"a\"; .[])", input: `[1]`, wantErr: "limit must be a number, got string"},
+		{expr: `has("a")`, input: `[1]`, wantErr: "cannot check whether array has a key of type string"},
+		{expr: "from_entries", input: `[1]`, wantErr: "cannot use number as object entry"},
+		{expr: ".[] | .a", input: `[{"a":1},2]`, wantErr: `cannot index number with "a"`},
+		{expr: ".a.b?", input: `"x"`, wantErr: `cannot index string with "a"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			q, err := Parse(tt.expr)
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			_, err = q.RunJSON([]byte(tt.input))
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("RunJSON() error = %v, want %q", err, tt.wantErr)
+			}
+			if err != nil && !strings.HasPrefix(err.Error(), fmt.Sprintf("failed to evaluate %q", tt.expr)) {
+				t.Errorf("RunJSON() error %q doesn't name the expression", err)
+			}
+		})
+	}
+}
+
+func TestRunJSONMalformedInput(t *testing.T) {
+	q, err := Parse(".a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, input := range []string{"", "{", `{"a":}`, "not json", `{"a":1} trailing`} {
+		if _, err := q.RunJSON([]byte(input)); err == nil || !strings.HasPrefix(err.Error(), "failed to parse JSON") {
+			t.Errorf("RunJSON(%q) error = %v, want a JSON parse error", input, err)
+		}
+	}
+}
@@ -0,0 +1,235 @@
+package query
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+func typeName(v any) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		return "number"
+	case string:
+		return "string"
+	case []any:
+		return "array"
+	case map[string]any:
+		return "object"
+	default:
+		return fmt.Sprintf("%T", v)
+	}
+}
+
+func isTruthy(v any) bool {
+	if v == nil {
+		return false
+	}
+	if b, ok := v.(bool); ok {
+		return b
+	}
+	return true
+}
+
+// typeOrder is the order of types when comparing values of different types, the same as jq
+func typeOrder(v any) int {
+	switch v := v.(type) {
+	case nil:
+		return 0
+	case bool:
+		if !v {
+			return 1
+		}
+		return 2
+	case float64:
+		return 3
+	case string:
+		return 4
+	case []any:
+		return 5
+	default:
+		return 6
+	}
+}
+
+// compare compares two JSON values, returns -1, 0 or 1
+func compare(a, b any) int {
+	if ta, tb := typeOrder(a), typeOrder(b); ta != tb {
+		if ta < tb {
+			return -1
+		}
+		return 1
+	}
+
+	switch a := a.(type) {
+	case float64:
+		b := b.(float64)
+		switch {
+		case a < b:
+			return -1
+		case a > b:
+			return 1
+		}
+		return 0
+	case string:
+		return strings.Compare(a, b.(string))
+	case []any:
+		b := b.([]any)
+		for i := 0; i < len(a) && i < len(b); i++ {
+			if c := compare(a[i], b[i]); c != 0 {
+				return c
+			}
+		}
+		return compare(float64(len(a)), float64(len(b)))
+	case map[string]any:
+		b := b.(map[string]any)
+		if c := compare(keysAsValues(a), keysAsValues(b)); c != 0 {
+			return c
+		}
+		for _, key := range sortedKeys(a) {
+			if c := compare(a[key], b[key]); c != 0 {
+				return c
+			}
+		}
+	}
+	return 0
+}
+
+func keysAsValues(m map[string]any) []any {
+	keys := sortedKeys(m)
+	values := make([]any, 0, len(keys))
+	for _, key := range keys {
+		values = append(values, key)
+	}
+	return values
+}
+
+func binaryOp(op string, l, r any) (any, error) {
+	switch op {
+	case "==":
+		return compare(l, r) == 0, nil
+	case "!=":
+		return compare(l, r) != 0, nil
+	case "<":
+		return compare(l, r) < 0, nil
+	case "<=":
+		return compare(l, r) <= 0, nil
+	case ">":
+		return compare(l, r) > 0, nil
+	case ">=":
+		return compare(l, r) >= 0, nil
+	case "+":
+		return add(l, r)
+	}
+
+	if lf, ok := l.(float64); ok {
+		if rf, ok := r.(float64); ok {
+			switch op {
+			case "-":
+				return lf - rf, nil
+			case "*":
+				return lf * rf, nil
+			case "/":
+				if rf == 0 {
+					return nil, fmt.Errorf("cannot divide %v by zero", lf)
+				}
+				return lf / rf, nil
+			case "%":
+				if int64(rf) == 0 {
+					return nil, fmt.Errorf("cannot divide %v by zero", lf)
+				}
+				return float64(int64(lf) % int64(math.Abs(rf))), nil
+			}
+		}
+	}
+
+	if op == "-" {
+		if la, ok := l.([]any); ok {
+			if ra, ok := r.([]any); ok {
+				result := []any{}
+				for _, item := range la {
+					if !containsValue(ra, item) {
+						result = append(result, item)
+					}
+				}
+				return result, nil
+			}
+		}
+	}
+	if op == "/" {
+		if ls, ok := l.(string); ok {
+			if rs, ok := r.(string); ok {
+				return splitString(ls, rs), nil
+			}
+		}
+	}
+
+	return nil, fmt.Errorf("%s (%s) and %s (%s) cannot be used with %q", typeName(l), short(l), typeName(r), short(r), op)
+}
+
+func add(l, r any) (any, error) {
+	if l == nil {
+		return r, nil
+	}
+	if r == nil {
+		return l, nil
+	}
+	switch l := l.(type) {
+	case float64:
+		if r, ok := r.(float64); ok {
+			return l + r, nil
+		}
+	case string:
+		if r, ok := r.(string); ok {
+			return l + r, nil
+		}
+	case []any:
+		if r, ok := r.([]any); ok {
+			result := make([]any, 0, len(l)+len(r))
+			return append(append(result, l...), r...), nil
+		}
+	case map[string]any:
+		if r, ok := r.(map[string]any); ok {
+			result := make(map[string]any, len(l)+len(r))
+			for k, v := range l {
+				result[k] = v
+			}
+			for k, v := range r {
+				result[k] = v
+			}
+			return result, nil
+		}
+	}
+	return nil, fmt.Errorf("%s (%s) and %s (%s) cannot be added", typeName(l), short(l), typeName(r), short(r))
+}
+
+func containsValue(items []any, v any) bool {
+	for _, item := range items {
+		if compare(item, v) == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func splitString(s, sep string) []any {
+	parts := strings.Split(s, sep)
+	result := make([]any, 0, len(parts))
+	for _, part := range parts {
+		result = append(result, part)
+	}
+	return result
+}
+
+// short returns a short representation of the value for error messages
+func short(v any) string {
+	s := fmt.Sprintf("%v", v)
+	if len(s) > 20 {
+		return s[:17] + "..."
+	}
+	return s
+}
@@ -0,0 +1,168 @@
+package utils
+
+import (
+	"fmt"
+	"strings"
+)
+
+// DiffOp is one line of a line-based diff
+type DiffOp struct {
+	// Kind is ' ' for an unchanged line, '-' for a line only in a, '+' for a line only in b
+	Kind byte
+	Line string
+}
+
+// DiffMaxEdits is the max number of edits DiffLines looks for, the memory used is quadratic to it,
+// texts with more differences are diffed as all lines removed and added
+const DiffMaxEdits = 2000
+
+// DiffLines returns the shortest edit script from a to b with the Myers algorithm
+func DiffLines(a, b []string) []DiffOp {
+	n, m := len(a), len(b)
+	maxD := min(n+m, DiffMaxEdits)
+	offset := maxD + 1
+	v := make([]int, 2*maxD+3)
+	var trace [][]int // trace[d] is v[-d-1:d+1] before step d, which is all that's needed to backtrack step d
+
+	found := false
+	for d := 0; d <= maxD && !found; d++ {
+		trace = append(trace, append([]int{}, v[offset-d-1:offset+d+2]...))
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1] // down, insertion
+			} else {
+				x = v[offset+k-1] + 1 // right, deletion
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				found = true
+				break
+			}
+		}
+	}
+
+	if !found {
+		ops := make([]DiffOp, 0, n+m)
+		for _, line := range a {
+			ops = append(ops, DiffOp{Kind: '-', Line: line})
+		}
+		for _, line := range b {
+			ops = append(ops, DiffOp{Kind: '+', Line: line})
+		}
+		return ops
+	}
+
+	// backtrack from the end to the start
+	var ops []DiffOp
+	x, y := n, m
+	for d := len(trace) - 1; d >= 0; d-- {
+		v := trace[d]
+		k := x - y
+		var prevK int
+		if k == -d || (k != d && v[d+k] < v[d+k+2]) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := v[d+1+prevK]
+		prevY := prevX - prevK
+		for x > prevX && y > prevY {
+			x--
+			y--
+			ops = append(ops, DiffOp{Kind: ' ', Line: a[x]})
+		}
+		if d > 0 {
+			if x == prevX {
+				y--
+				ops = append(ops, DiffOp{Kind: '+', Line: b[y]})
+			} else {
+				x--
+				ops = append(ops, DiffOp{Kind: '-', Line: a[x]})
+			}
+		}
+	}
+
+	for i, j := 0, len(ops)-1; i < j; i, j = i+1, j-1 {
+		ops[i], ops[j] = ops[j], ops[i]
+	}
+	return ops
+}
+
+// UnifiedDiff returns the unified diff of two texts with the given number of context lines, empty if they are the same
+func UnifiedDiff(a, b, nameA, nameB string, context int) string {
+	if a == b {
+		return ""
+	}
+	ops := DiffLines(splitLines(a), splitLines(b))
+
+	out := &strings.Builder{}
+	fmt.Fprintf(out, "--- %s\n+++ %s\n", nameA, nameB)
+
+	// lineA and lineB are the 0-based line numbers before ops[i]
+	lineA, lineB := make([]int, len(ops)+1), make([]int, len(ops)+1)
+	for i, op := range ops {
+		lineA[i+1], lineB[i+1] = lineA[i], lineB[i]
+		if op.Kind != '+' {
+			lineA[i+1]++
+		}
+		if op.Kind != '-' {
+			lineB[i+1]++
+		}
+	}
+
+	for i := 0; i < len(ops); {
+		if ops[i].Kind == ' ' {
+			i++
+			continue
+		}
+		// a hunk starts with context before the change, and ends when there are more than 2*context unchanged lines
+		start := max(0, i-context)
+		end := i
+		for end < len(ops) {
+			if ops[end].Kind != ' ' {
+				end++
+				continue
+			}
+			unchanged := 0
+			for end+unchanged < len(ops) && ops[end+unchanged].Kind == ' ' {
+				unchanged++
+			}
+			if end+unchanged == len(ops) || unchanged > 2*context {
+				end += min(unchanged, context)
+				break
+			}
+			end += unchanged
+		}
+
+		fmt.Fprintf(out, "@@ -%s +%s @@\n", hunkRange(lineA[start], lineA[end]-lineA[start]), hunkRange(lineB[start], lineB[end]-lineB[start]))
+		for _, op := range ops[start:end] {
+			fmt.Fprintf(out, "%c%s\n", op.Kind, op.Line)
+		}
+		i = end
+	}
+	return out.String()
+}
+
+func hunkRange(start, count int) string {
+	if count == 0 {
+		return fmt.Sprintf("%d,0", start)
+	}
+	if count == 1 {
+		return fmt.Sprintf("%d", start+1)
+	}
+	return fmt.Sprintf("%d,%d", start+1, count)
+}
+
+func splitLines(s string) []string {
+	s = strings.TrimSuffix(s, "\n")
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, "\n")
+}
@@ -0,0 +1,146 @@
+package utils
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDiffLines(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b []string
+		want []DiffOp
+	}{
+		{
+			name: "both empty",
+			want: nil,
+		},
+		{
+			name: "same lines",
+			a:    []string{"a", "b"},
+			b:    []string{"a", "b"},
+			want: []DiffOp{{' ', "a"}, {' ', "b"}},
+		},
+		{
+			name: "all added",
+			b:    []string{"a", "b"},
+			want: []DiffOp{{'+', "a"}, {'+', "b"}},
+		},
+		{
+			name: "all removed",
+			a:    []string{"a", "b"},
+			want: []DiffOp{{'-', "a"}, {'-', "b"}},
+		},
+		{
+			name: "changed line in the middle",
+			a:    []string{"a", "b", "c"},
+			b:    []string{"a", "x", "c"},
+			want: []DiffOp{{' ', "a"}, {'-', "b"}, {'+', "x"}, {' ', "c"}},
+		},
+		{
+			name: "shortest edit script",
+			a:    []string{"a", "b", "c", "a", "b", "b", "a"},
+			b:    []string{"c", "b", "a", "b", "a", "c"},
+			want: []DiffOp{{'-', "a"}, {'-', "b"}, {' ', "c"}, {'+', "b"}, {' ', "a"}, {' ', "b"}, {'-', "b"}, {' ', "a"}, {'+', "c"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := DiffLines(tt.a, tt.b); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("DiffLines() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDiffLinesMaxEdits(t *testing.T) {
+	var a, b []string
+	for i := 0; i <= DiffMaxEdits; i++ {
+		a = append(a, "a")
+		b = append(b, "b")
+	}
+	got := DiffLines(a, b)
+	if len(got) != len(a)+len(b) {
+		t.Fatalf("DiffLines() has %d ops, want %d", len(got), len(a)+len(b))
+	}
+	for i, op := range got {
+		want := byte('-')
+		if i >= len(a) {
+			want = '+'
+		}
+		if op.Kind != want {
+			t.Fatalf("op %d is %c, want all lines removed and then added", i, op.Kind)
+		}
+	}
+}
+
+func TestUnifiedDiff(t *testing.T) {
+	lines := func(n int, changed map[int]string) string {
+		b := &strings.Builder{}
+		for i := 1; i <= n; i++ {
+			if line, ok := changed[i]; ok {
+				b.WriteString(line + "\n")
+				continue
+			}
+			b.WriteString(string(rune('a'+i-1)) + "\n")
+		}
+		return b.String()
+	}
+
+	tests := []struct {
+		name    string
+		a, b    string
+		context int
+		want    string
+	}{
+		{
+			name: "same texts",
+			a:    "a\nb\n",
+			b:    "a\nb\n",
+			want: "",
+		},
+		{
+			name:    "one changed line",
+			a:       lines(5, nil),
+			b:       lines(5, map[int]string{3: "x"}),
+			context: 1,
+			want:    "--- old\n+++ new\n@@ -2,3 +2,3 @@\n b\n-c\n+x\n d\n",
+		},
+		{
+			name:    "added to an empty text",
+			a:       "",
+			b:       "a\nb\n",
+			context: 3,
+			want:    "--- old\n+++ new\n@@ -0,0 +1,2 @@\n+a\n+b\n",
+		},
+		{
+			name:    "one removed line",
+			a:       "a\n",
+			b:       "",
+			context: 3,
+			want:    "--- old\n+++ new\n@@ -1 +0,0 @@\n-a\n",
+		},
+		{
+			name:    "close changes are in one hunk",
+			a:       lines(8, nil),
+			b:       lines(8, map[int]string{2: "x", 5: "y"}),
+			context: 1,
+			want:    "--- old\n+++ new\n@@ -1,6 +1,6 @@\n a\n-b\n+x\n c\n d\n-e\n+y\n f\n",
+		},
+		{
+			name:    "far changes are in separate hunks",
+			a:       lines(10, nil),
+			b:       lines(10, map[int]string{2: "x", 9: "y"}),
+			context: 1,
+			want:    "--- old\n+++ new\n@@ -1,3 +1,3 @@\n a\n-b\n+x\n c\n@@ -8,3 +8,3 @@\n h\n-i\n+y\n j\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := UnifiedDiff(tt.a, tt.b, "old", "new", tt.context); got != tt.want {
+				t.Errorf("UnifiedDiff() =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
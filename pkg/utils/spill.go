@@ -0,0 +1,96 @@
+package utils
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"unicode/utf8"
+)
+
+// SpillBuffer is an io.Writer that keeps data in memory until it grows beyond Threshold bytes,
+// after that everything is streamed to the file at Path and only the first PreviewSize bytes are kept in memory.
+type SpillBuffer struct {
+	// Threshold is the maximum number of bytes kept in memory, 0 or negative means never spill
+	Threshold int
+
+	// PreviewSize is the number of bytes kept in memory after spilling
+	PreviewSize int
+
+	// Path is the file to spill to, it's created only when the threshold is exceeded
+	Path string
+
+	buf     bytes.Buffer
+	preview []byte
+	file    *os.File
+	size    int
+}
+
+func (b *SpillBuffer) Write(p []byte) (int, error) {
+	b.size += len(p)
+
+	if b.file != nil {
+		return b.file.Write(p)
+	}
+
+	if b.Threshold <= 0 || b.buf.Len()+len(p) <= b.Threshold {
+		return b.buf.Write(p)
+	}
+
+	f, err := os.OpenFile(b.Path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create spill file %s: %v", b.Path, err)
+	}
+	if _, err := f.Write(b.buf.Bytes()); err != nil {
+		f.Close()
+		return 0, fmt.Errorf("failed to write spill file %s: %v", b.Path, err)
+	}
+	b.file = f
+
+	// Keep the head of the output as preview, and release the in-memory buffer,
+	// a few more bytes are taken, so that the preview is cut at a rune boundary
+	head := b.buf.Bytes()[:min(b.buf.Len(), b.PreviewSize+utf8.UTFMax)]
+	if len(head) < b.PreviewSize+utf8.UTFMax {
+		head = append(head[:len(head):len(head)], p[:min(len(p), b.PreviewSize+utf8.UTFMax-len(head))]...)
+	}
+	b.preview = []byte(HeadUTF8(string(head), b.PreviewSize))
+	b.buf = bytes.Buffer{}
+
+	return b.file.Write(p)
+}
+
+// Close closes the spill file if there is one, it's safe to call Close when nothing was spilled
+func (b *SpillBuffer) Close() error {
+	if b.file == nil {
+		return nil
+	}
+	return b.file.Close()
+}
+
+// Spilled returns true if the data was written to the spill file
+func (b *SpillBuffer) Spilled() bool {
+	return b.file != nil
+}
+
+// Bytes returns all data if it was not spilled, otherwise the preview
+func (b *SpillBuffer) Bytes() []byte {
+	if b.file != nil {
+		return b.preview
+	}
+	return b.buf.Bytes()
+}
+
+// Size returns the total number of bytes written
+func (b *SpillBuffer) Size() int {
+	return b.size
+}
+
+// HeadUTF8 returns the first n bytes of s at most, without splitting a UTF-8 encoded rune at the end
+func HeadUTF8(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
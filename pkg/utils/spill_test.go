@@ -0,0 +1,63 @@
+package utils
+
+import (
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestHeadUTF8(t *testing.T) {
+	tests := []struct {
+		s    string
+		n    int
+		want string
+	}{
+		{s: "abc", n: 5, want: "abc"},
+		{s: "abc", n: 2, want: "ab"},
+		{s: "aé", n: 2, want: "a"},  // é is 2 bytes
+		{s: "aé", n: 3, want: "aé"}, // the whole string
+		{s: "a世界", n: 3, want: "a"}, // 世 is 3 bytes
+		{s: "a世界", n: 4, want: "a世"},
+		{s: "世", n: 1, want: ""},
+		{s: "", n: 0, want: ""},
+	}
+	for _, tt := range tests {
+		if got := HeadUTF8(tt.s, tt.n); got != tt.want {
+			t.Errorf("HeadUTF8(%q, %d) = %q, want %q", tt.s, tt.n, got, tt.want)
+		}
+	}
+}
+
+func TestSpillBufferPreviewUTF8(t *testing.T) {
+	// the preview size falls in the middle of a 3 byte rune
+	data := "a" + strings.Repeat("世", 100)
+	for _, chunk := range []int{1, 7, len(data)} {
+		file := path.Join(t.TempDir(), "out.spill")
+		b := &SpillBuffer{Threshold: 32, PreviewSize: 11, Path: file}
+		for i := 0; i < len(data); i += chunk {
+			if _, err := b.Write([]byte(data[i:min(len(data), i+chunk)])); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := b.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		if !b.Spilled() {
+			t.Fatalf("writes of %d bytes: data is not spilled", chunk)
+		}
+		preview := b.Bytes()
+		if string(preview) != "a世世世" || !utf8.Valid(preview) {
+			t.Errorf("writes of %d bytes: preview = %q, want %q", chunk, preview, "a世世世")
+		}
+		content, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(content) != data || b.Size() != len(data) {
+			t.Errorf("writes of %d bytes: spill file has %d bytes, size is %d, want %d", chunk, len(content), b.Size(), len(data))
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package utils
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"unicode"
+)
+
+// Table is a table parsed from kubectl table output
+type Table struct {
+	Header []string
+	Rows   [][]string
+}
+
+// ColumnIndex returns the index of the column with the given name (case-insensitive), or -1 if not found
+func (t *Table) ColumnIndex(name string) int {
+	for i, column := range t.Header {
+		if strings.EqualFold(column, name) {
+			return i
+		}
+	}
+	return -1
+}
+
+// ParseTables parses kubectl table output (default and -o wide), multiple tables are separated by blank lines
+// (e.g. get pods,services), columns are located by the positions of the header names, a column starts after
+// at least two spaces (kubectl pads with three), so header names with a single space (e.g. NOMINATED NODE) are kept together.
+func ParseTables(text string) []Table {
+	var tables []Table
+	var current *Table
+	var starts []int
+
+	for line := range strings.SplitSeq(text, "\n") {
+		line = strings.TrimRight(line, " \t\r")
+		if line == "" {
+			current = nil
+			continue
+		}
+
+		runes := []rune(line)
+		if current == nil {
+			starts = columnStarts(runes)
+			header := splitColumns(runes, starts)
+			tables = append(tables, Table{Header: header, Rows: [][]string{}})
+			current = &tables[len(tables)-1]
+			continue
+		}
+
+		current.Rows = append(current.Rows, splitColumns(runes, starts))
+	}
+
+	return tables
+}
+
+// columnStarts returns the positions of the header names, a name starts after at least two spaces
+func columnStarts(header []rune) []int {
+	var starts []int
+	for i, r := range header {
+		if r == ' ' {
+			continue
+		}
+		if i == 0 || (i >= 2 && header[i-1] == ' ' && header[i-2] == ' ') {
+			starts = append(starts, i)
+		}
+	}
+	return starts
+}
+
+func splitColumns(line []rune, starts []int) []string {
+	columns := make([]string, len(starts))
+	for i, start := range starts {
+		if start >= len(line) {
+			continue
+		}
+		end := len(line)
+		if i+1 < len(starts) && starts[i+1] < end {
+			end = starts[i+1]
+		}
+		columns[i] = strings.TrimSpace(string(line[start:end]))
+	}
+	return columns
+}
+
+// RenderTable renders a table with aligned columns separated by three spaces, the same way kubectl does
+func RenderTable(header []string, rows [][]string) string {
+	buf := bytes.Buffer{}
+	w := tabwriter.NewWriter(&buf, 0, 0, 3, ' ', 0)
+	for _, row := range append([][]string{header}, rows...) {
+		w.Write([]byte(strings.Join(row, "\t") + "\n"))
+	}
+	w.Flush()
+	return buf.String()
+}
+
+// CompareNatural compares two table cells, numbers at the beginning of the cells are compared by value
+// (e.g. RESTARTS "3 (2m ago)" < "12"), other cells are compared as strings.
+func CompareNatural(a, b string) int {
+	numA, restA, okA := leadingNumber(a)
+	numB, restB, okB := leadingNumber(b)
+	if okA && okB {
+		if numA != numB {
+			if numA < numB {
+				return -1
+			}
+			return 1
+		}
+		return strings.Compare(restA, restB)
+	}
+	return strings.Compare(a, b)
+}
+
+func leadingNumber(s string) (int, string, bool) {
+	end := strings.IndexFunc(s, func(r rune) bool { return !unicode.IsDigit(r) })
+	if end == -1 {
+		end = len(s)
+	}
+	if end == 0 {
+		return 0, s, false
+	}
+	n, err := strconv.Atoi(s[:end])
+	if err != nil {
+		return 0, s, false
+	}
+	return n, s[end:], true
+}
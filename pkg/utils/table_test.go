@@ -0,0 +1,99 @@
+package utils
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseTables(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want []Table
+	}{
+		{
+			name: "header names with a single space are kept together",
+			text: "NAME    READY   NOMINATED NODE   READINESS GATES\n" +
+				"web-1   1/1     <none>           <none>\n",
+			want: []Table{{
+				Header: []string{"NAME", "READY", "NOMINATED NODE", "READINESS GATES"},
+				Rows:   [][]string{{"web-1", "1/1", "<none>", "<none>"}},
+			}},
+		},
+		{
+			name: "columns separated by two spaces",
+			text: "NAME  NOMINATED NODE  AGE\n" +
+				"a     node-1          5d\n",
+			want: []Table{{
+				Header: []string{"NAME", "NOMINATED NODE", "AGE"},
+				Rows:   [][]string{{"a", "node-1", "5d"}},
+			}},
+		},
+		{
+			name: "empty cells",
+			text: "NAME   IP      AGE\n" +
+				"a              5d\n",
+			want: []Table{{
+				Header: []string{"NAME", "IP", "AGE"},
+				Rows:   [][]string{{"a", "", "5d"}},
+			}},
+		},
+		{
+			name: "multiple tables are separated by blank lines",
+			text: "NAME   READY\n" +
+				"pod/a  1/1\n" +
+				"\n" +
+				"NAME        TYPE\n" +
+				"service/b   ClusterIP\n",
+			want: []Table{
+				{Header: []string{"NAME", "READY"}, Rows: [][]string{{"pod/a", "1/1"}}},
+				{Header: []string{"NAME", "TYPE"}, Rows: [][]string{{"service/b", "ClusterIP"}}},
+			},
+		},
+		{
+			name: "header only",
+			text: "NAME   READY\n",
+			want: []Table{{Header: []string{"NAME", "READY"}, Rows: [][]string{}}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ParseTables(tt.text); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseTables() = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRenderTable(t *testing.T) {
+	got := RenderTable([]string{"NAME", "NOMINATED NODE"}, [][]string{{"a", "node-1"}})
+	want := "NAME   NOMINATED NODE\n" +
+		"a      node-1\n"
+	if got != want {
+		t.Errorf("RenderTable() = %q, want %q", got, want)
+	}
+
+	// rendered tables are parsed back to the same cells
+	tables := ParseTables(got)
+	if len(tables) != 1 || !reflect.DeepEqual(tables[0].Header, []string{"NAME", "NOMINATED NODE"}) {
+		t.Errorf("ParseTables(RenderTable()) = %#v", tables)
+	}
+}
+
+func TestCompareNatural(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"3 (2m ago)", "12", -1},
+		{"12", "3", 1},
+		{"5", "5", 0},
+		{"abc", "abd", -1},
+		{"10", "abc", -1},
+	}
+	for _, tt := range tests {
+		if got := CompareNatural(tt.a, tt.b); got != tt.want {
+			t.Errorf("CompareNatural(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
@@ -2,8 +2,10 @@ package utils
 
 import (
 	"bytes"
+	"encoding/csv"
 	"encoding/json"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
 	"strings"
@@ -23,6 +25,12 @@ func init() {
 	}
 }
 
+// SetColorOutput sets the color profile of styles for the writer styled text is printed to,
+// colors are dropped if it's not a terminal or NO_COLOR is set
+func SetColorOutput(w io.Writer) {
+	lipgloss.SetColorProfile(termenv.NewOutput(w).EnvColorProfile())
+}
+
 // Style contains all the styled output definitions
 var Style = struct {
 	Info    lipgloss.Style
@@ -78,6 +86,14 @@ func Exec(name string, arg ...string) ([]byte, []byte, error) {
 	return stdout.Bytes(), stderr.Bytes(), err
 }
 
+// ExecWithWriters runs the command and streams stdout/stderr to the given writers instead of buffering them
+func ExecWithWriters(stdout, stderr io.Writer, name string, arg ...string) error {
+	cmd := exec.Command(name, arg...)
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	return cmd.Run()
+}
+
 func ExecWithStdin(stdin string, name string, arg ...string) ([]byte, []byte, error) {
 	var stdout = bytes.Buffer{}
 	var stderr = bytes.Buffer{}
@@ -90,15 +106,58 @@ func ExecWithStdin(stdin string, name string, arg ...string) ([]byte, []byte, er
 }
 
 func FileExt(format string) string {
-	if format == "json" {
+	if format == "json" || format == "ndjson" {
 		return ".json"
 	}
 	if format == "yaml" || format == "yml" {
 		return ".yaml"
 	}
+	if format == "csv" || format == "tsv" {
+		return "." + format
+	}
+	if format == "html" {
+		return ".html"
+	}
+	if format == "markdown" {
+		return ".md"
+	}
 	return ".txt"
 }
 
+// IsReportFormat returns true for formats which render all results as one human readable report, i.e. html and markdown
+func IsReportFormat(format string) bool {
+	return format == "html" || format == "markdown"
+}
+
+// ShellJoin joins args into a command line which can be pasted to a shell, args are single-quoted when needed
+func ShellJoin(args []string) string {
+	quoted := make([]string, 0, len(args))
+	for _, arg := range args {
+		if arg != "" && strings.IndexFunc(arg, func(r rune) bool {
+			return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || strings.ContainsRune("-_./:=,@%+", r))
+		}) < 0 {
+			quoted = append(quoted, arg)
+			continue
+		}
+		quoted = append(quoted, "'"+strings.ReplaceAll(arg, "'", `'\''`)+"'")
+	}
+	return strings.Join(quoted, " ")
+}
+
+// IsDelimitedFormat returns true for formats which hold rows of fields, i.e. csv and tsv
+func IsDelimitedFormat(format string) bool {
+	return format == "csv" || format == "tsv"
+}
+
+// NewDelimitedWriter returns a csv writer, or tsv writer if format is "tsv", fields are quoted when needed
+func NewDelimitedWriter(w io.Writer, format string) *csv.Writer {
+	cw := csv.NewWriter(w)
+	if format == "tsv" {
+		cw.Comma = '\t'
+	}
+	return cw
+}
+
 func PutFileWithFormat(path string, data any, format string, textFunc func() string) error {
 	if format == "json" {
 		jsonData, err := json.MarshalIndent(data, "", "  ")
@@ -107,6 +166,13 @@ func PutFileWithFormat(path string, data any, format string, textFunc func() str
 		}
 		return os.WriteFile(path, jsonData, 0600)
 	}
+	if format == "ndjson" {
+		jsonData, err := json.Marshal(data)
+		if err != nil {
+			return fmt.Errorf("failed to marshal data to json: %v", err)
+		}
+		return os.WriteFile(path, append(jsonData, '\n'), 0600)
+	}
 	if format == "yaml" || format == "yml" {
 		yamlData, err := yaml.Marshal(data)
 		if err != nil {